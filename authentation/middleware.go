@@ -1,13 +1,25 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/database"
 )
 
-func AuthMiddleware() func(http.Handler) http.Handler {
+type contextKey string
+
+const (
+	claimsContextKey contextKey = "claims"
+	userIDContextKey contextKey = "user_id"
+)
+
+// AuthMiddleware lets through requests with a valid token of an open account, tokens of closed
+// accounts and of an email that has since been changed are refused
+func AuthMiddleware(db database.Database) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tokenString := r.Header.Get("Authorization")
@@ -19,13 +31,61 @@ func AuthMiddleware() func(http.Handler) http.Handler {
 			tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
 			// Validate token
-			_, err := ValidateToken(tokenString)
+			claims, err := ValidateToken(tokenString)
 			if err != nil {
 				utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized: invalid token"})
 				return
 			}
 
+			user, err := db.GetUserByEmail(r.Context(), claims.Username, nil)
+			if errors.Is(err, database.ErrTimeout) {
+				utils.RespondWithJSON(w, http.StatusGatewayTimeout, map[string]string{"error": err.Error()})
+				return
+			} else if err != nil {
+				utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized: account not found or closed"})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			ctx = context.WithValue(ctx, userIDContextKey, user.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AdminMiddleware only lets through users listed in adminEmails, it must run after AuthMiddleware
+func AdminMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok || !IsAdmin(claims.Username) {
+				utils.RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": "Forbidden: admin access required"})
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// ClaimsFromContext returns the token claims stored by AuthMiddleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*Claims)
+	return claims, ok
+}
+
+// UserIDFromContext returns the ID of the account AuthMiddleware authenticated
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(int)
+	return userID, ok
+}
+
+// IsAdmin reports whether the email is listed in adminEmails
+func IsAdmin(email string) bool {
+	for _, admin := range cfg.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// command is a single CLI subcommand
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error
+}
+
+var commands = map[string]command{
+	"export-user":         {"export-user -user <id> [-out <file.zip>]", exportUser},
+	"migrate":             {"migrate up|down|status|to <version>", migrateSchema},
+	"import-transactions": {"import-transactions -file <transactions.csv|.ndjson> [-format csv|ndjson] [-batch <rows>] [-report <file>]", importTransactions},
+	"rebuild-balances":    {"rebuild-balances [-apply]", rebuildBalances},
+	"reconcile":           {"reconcile [-format csv|json] [-out <file>] [-fix]", reconcileBalances},
+}
+
+// Run executes the subcommand named by args[0], a command stops once ctx is done
+func Run(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given\n%s", usage())
+	}
+
+	cmd, exists := commands[args[0]]
+	if !exists {
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage())
+	}
+
+	db = db.WithAuditMeta(models.AuditMeta{Actor: "cli:" + args[0]})
+	return cmd.run(ctx, args[1:], cfg, db)
+}
+
+func usage() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"usage: go run main.go <command> [flags]", "commands:"}
+	for _, name := range names {
+		lines = append(lines, "  "+commands[name].usage)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/dataexport"
+)
+
+func exportUser(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	flags := newFlagSet("export-user")
+	userID := flags.Int("user", 0, "ID of the user to export")
+	out := flags.String("out", "", "archive path, defaults to a file in the configured export directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID <= 0 {
+		return fmt.Errorf("-user is required")
+	}
+
+	if *out == "" {
+		path, err := dataexport.WriteUserArchiveFile(ctx, db, *userID, cfg.ExportConfig.Directory, nil)
+		if err != nil {
+			return err
+		}
+		log.Println("User data exported to", path)
+		return nil
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %v", *out, err)
+	}
+	defer file.Close()
+
+	if err := dataexport.WriteUserArchive(ctx, db, *userID, file, nil); err != nil {
+		return err
+	}
+	log.Println("User data exported to", *out)
+	return file.Close()
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/importer"
+)
+
+func importTransactions(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	flags := newFlagSet("import-transactions")
+	path := flags.String("file", "", "CSV or NDJSON file of transactions")
+	format := flags.String("format", "", "csv or ndjson, detected from the file extension when empty")
+	batchSize := flags.Int("batch", cfg.ImportConfig.BatchSize, "rows per batch")
+	out := flags.String("report", "", "write the per-row report to this file, defaults to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	detected, err := importer.DetectFormat(*format, "", *path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", *path, err)
+	}
+	defer file.Close()
+
+	report, err := importer.Import(ctx, db, file, detected, importer.Options{
+		BatchSize: *batchSize,
+		Progress: func(done, _ int) {
+			log.Printf("Imported %d rows...", done)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		reportFile, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %v", *out, err)
+		}
+		defer reportFile.Close()
+		output = reportFile
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	log.Printf("Import finished: %d rows, %d imported, %d duplicates, %d invalid, %d failed",
+		report.Rows, report.Imported, report.Duplicates, report.Invalid, report.Failed)
+	return nil
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/ledger"
+)
+
+// rebuildBalances replays the points ledger and reports balances that drifted from it
+func rebuildBalances(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	flags := newFlagSet("rebuild-balances")
+	apply := flags.Bool("apply", false, "overwrite points_balance with the projected balances")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := ledger.Rebuild(ctx, db, *apply)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	log.Printf("Checked %d users, %d discrepancies found, %d changed while checked", report.UsersChecked, len(report.Discrepancies), len(report.Changed))
+	return nil
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+)
+
+// migrateSchema applies, reverts or lists the embedded schema migrations
+func migrateSchema(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	migrator, ok := database.AsMigrator(db)
+	if !ok {
+		return fmt.Errorf("the %s driver has no schema to migrate", cfg.Database.Driver)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("migrate needs one of up, down, status or to <version>")
+	}
+
+	current, latest, err := migrator.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target int
+	switch args[0] {
+	case "status":
+		migrations, err := migrator.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			applied := "pending"
+			if m.AppliedOn != nil {
+				applied = "applied " + m.AppliedOn.Format("2006-01-02 15:04:05")
+			}
+			log.Printf("%04d %-30s %s", m.Version, m.Name, applied)
+		}
+		log.Printf("Schema is at version %d of %d", current, latest)
+		return nil
+	case "up":
+		target = latest
+	case "down":
+		// revert the latest applied migration only
+		migrations, err := migrator.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.AppliedOn != nil && m.Version < current {
+				target = m.Version
+			}
+		}
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("migrate to needs a version")
+		}
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down, status or to <version>", args[0])
+	}
+
+	ran, err := migrator.MigrateTo(ctx, target)
+	for _, m := range ran {
+		if m.AppliedOn != nil {
+			log.Printf("Applied migration %04d %s", m.Version, m.Name)
+		} else {
+			log.Printf("Reverted migration %04d %s", m.Version, m.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	current, _, err = migrator.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Schema is at version %d of %d", current, latest)
+	return nil
+}
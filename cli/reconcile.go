@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/reconcile"
+)
+
+// reconcileBalances recomputes balances from transactions and points history and reports drift
+func reconcileBalances(ctx context.Context, args []string, cfg *config.AppConfig, db database.Database) error {
+	flags := newFlagSet("reconcile")
+	format := flags.String("format", "json", "report format, csv or json")
+	out := flags.String("out", "", "report file, defaults to stdout")
+	fix := flags.Bool("fix", false, "write correcting adjustments for mismatched balances")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := reconcile.Run(ctx, db, *fix)
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %v", *out, err)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	if err := reconcile.Write(output, report, *format); err != nil {
+		return err
+	}
+
+	log.Printf("Reconciled %d users, %d mismatches found", report.UsersChecked, len(report.Mismatches))
+	return nil
+}
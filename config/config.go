@@ -16,6 +16,32 @@ type DatabaseConfig struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+	// Path is the database file of the sqlite driver
+	Path string `yaml:"path"`
+	// Migrations is what a service does about schema migrations on start: off, check (refuse to
+	// start while the schema is behind) or up (apply pending migrations)
+	Migrations string `yaml:"migrations"`
+	// Timeouts bound how long each database call may run before it is cancelled
+	Timeouts QueryTimeoutConfig `yaml:"timeouts"`
+	// Replicas serve balance and history reads of the postgres driver, writes stay on the database above
+	Replicas ReplicaConfig `yaml:"replicas"`
+}
+
+type ReplicaConfig struct {
+	// DSNs of the read only standbys, such as "host=replica-1 port=5432 user=... dbname=... sslmode=disable"
+	DSNs []string `yaml:"dsns"`
+	// MaxLagInSec is how far a replica may fall behind the primary and still serve reads
+	MaxLagInSec int `yaml:"maxLagInSec"`
+	// CheckIntervalInSec is how often every replica's health and lag are checked
+	CheckIntervalInSec int `yaml:"checkIntervalInSec"`
+}
+
+type QueryTimeoutConfig struct {
+	// DefaultInSec applies to the operations missing from OperationsInSec, no timeout when 0
+	DefaultInSec int `yaml:"defaultInSec"`
+	// OperationsInSec overrides the timeout of an operation, keyed by its Database method name such
+	// as StreamPointsHistory, 0 meaning no timeout
+	OperationsInSec map[string]int `yaml:"operationsInSec"`
 }
 
 type RestServerConfig struct {
@@ -27,15 +53,175 @@ type SchedulerConfig struct {
 	ExpireTimeYear           int `yaml:"expireTimeYear"`
 	ExpireTimeMonth          int `yaml:"expireTimeMonth"`
 	ExpireTimeDay            int `yaml:"expireTimeDay"`
+	// ExpiryBatchSize is how many transactions the expiration job expires per committed batch
+	ExpiryBatchSize int `yaml:"expiryBatchSize"`
+
+	// Reconciliation job, disabled when the interval is 0
+	ReconciliationIntervalInMin int    `yaml:"reconciliationIntervalInMin"`
+	ReconciliationReportDir     string `yaml:"reconciliationReportDir"`
+	ReconciliationReportFormat  string `yaml:"reconciliationReportFormat"`
+	ReconciliationAutoFix       bool   `yaml:"reconciliationAutoFix"`
+
+	// Monthly statements are written once the month is over, checked on this interval, disabled when 0
+	StatementIntervalInMin int `yaml:"statementIntervalInMin"`
+
+	// Expiry warnings are sent for lots expiring within each of the windows, disabled when the interval is 0
+	ExpiryWarningIntervalInMin int   `yaml:"expiryWarningIntervalInMin"`
+	ExpiryWarningDays          []int `yaml:"expiryWarningDays"`
+
+	// Jobs overrides the schedule of each job by name, a job missing here runs on its interval above
+	Jobs map[string]JobConfig `yaml:"jobs"`
+	// Runs kept per job in the run history
+	HistorySize int `yaml:"historySize"`
+	// AdminPort serves the job status and control API, admin tokens only, disabled when 0
+	AdminPort int `yaml:"adminPort"`
+
+	// LeaderElection lets several scheduler instances share a database with only one running jobs
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+}
+
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// LockName is the advisory lock the instances compete for, instances with different names don't coordinate
+	LockName string `yaml:"lockName"`
+	// RetryIntervalInSec is how often a follower retries the lock and the leader checks it still holds it
+	RetryIntervalInSec int `yaml:"retryIntervalInSec"`
+}
+
+type JobConfig struct {
+	// Schedule is a cron expression ("0 3 * * *") or a descriptor ("@hourly", "@every 2m")
+	Schedule     string `yaml:"schedule"`
+	TimeoutInSec int    `yaml:"timeoutInSec"`
+	Enabled      bool   `yaml:"enabled"`
+}
+
+type AccountConfig struct {
+	// ClosurePolicy decides what happens to remaining points when an account is closed: forfeit or cashout
+	ClosurePolicy string  `yaml:"closurePolicy"`
+	CashOutRate   float64 `yaml:"cashOutRate"`
+	// Tiers a user can be placed in, new users start in the first one
+	Tiers []string `yaml:"tiers"`
+}
+
+// ExpiryConfig decides when earned points expire. The most specific policy matching a lot's
+// purchase category and its user's tier applies: category and tier, category, tier, then Default.
+type ExpiryConfig struct {
+	// Default applies to lots no policy matches, without it schedulerConfig's expireTime settings are used
+	Default  *ExpiryPolicyConfig  `yaml:"default"`
+	Policies []ExpiryPolicyConfig `yaml:"policies"`
+}
+
+type ExpiryPolicyConfig struct {
+	Category string `yaml:"category"`
+	Tier     string `yaml:"tier"`
+	// Type is fixed (the period after earning), end_of_quarter (the end of the quarter the period
+	// ends in) or inactivity (the period after the user's last activity)
+	Type   string `yaml:"type"`
+	Years  int    `yaml:"years"`
+	Months int    `yaml:"months"`
+	Days   int    `yaml:"days"`
+}
+
+type ExportConfig struct {
+	// Directory where generated data export archives are written
+	Directory string `yaml:"directory"`
+	// RetentionInMin is how long a finished export can be downloaded before it and its archive are removed
+	RetentionInMin int `yaml:"retentionInMin"`
+}
+
+type StatementConfig struct {
+	// Directory where the month end job writes statements, one sub directory per month
+	Directory string `yaml:"directory"`
+	// Format of the files written by the month end job, json or html
+	Format             string `yaml:"format"`
+	ExpiringWithinDays int    `yaml:"expiringWithinDays"`
+}
+
+type NotificationConfig struct {
+	// Notifier is log, file, or service to send through the notification channels below
+	Notifier string `yaml:"notifier"`
+	FilePath string `yaml:"filePath"`
+
+	// Channels the service sends on, any of email, sms and push
+	Channels []string `yaml:"channels"`
+	// Channels a user receives every event on unless they opted out, the others are opt in
+	DefaultChannels []string `yaml:"defaultChannels"`
+	DefaultLocale   string   `yaml:"defaultLocale"`
+	// Stub replaces every channel with a local stand-in writing to StubFilePath
+	Stub         bool   `yaml:"stub"`
+	StubFilePath string `yaml:"stubFilePath"`
+
+	SMTP SMTPConfig           `yaml:"smtp"`
+	SMS  NotificationProvider `yaml:"sms"`
+	Push NotificationProvider `yaml:"push"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// NotificationProvider is an HTTP API messages are posted to as JSON
+type NotificationProvider struct {
+	URL          string `yaml:"url"`
+	APIKey       string `yaml:"apiKey"`
+	From         string `yaml:"from"`
+	TimeoutInSec int    `yaml:"timeoutInSec"`
+}
+
+type OutboxConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Publisher is either inprocess or ndjson
+	Publisher         string `yaml:"publisher"`
+	FilePath          string `yaml:"filePath"`
+	PollIntervalInSec int    `yaml:"pollIntervalInSec"`
+	BatchSize         int    `yaml:"batchSize"`
+	// MaxAttempts is how often an event is tried before it is marked dead and skipped
+	MaxAttempts int `yaml:"maxAttempts"`
+	// ClaimLeaseInSec is how long a relay holds the events it took before another may take them
+	ClaimLeaseInSec int `yaml:"claimLeaseInSec"`
+	// LockName is the lock the API instances compete for, only its holder relays events
+	LockName string `yaml:"lockName"`
+}
+
+type WebhookConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	MaxAttempts       int  `yaml:"maxAttempts"`
+	BaseBackoffInSec  int  `yaml:"baseBackoffInSec"`
+	MaxBackoffInSec   int  `yaml:"maxBackoffInSec"`
+	TimeoutInSec      int  `yaml:"timeoutInSec"`
+	PollIntervalInSec int  `yaml:"pollIntervalInSec"`
+	BatchSize         int  `yaml:"batchSize"`
+}
+
+type ImportConfig struct {
+	BatchSize int `yaml:"batchSize"`
+	// Uploads larger than this run as a background job
+	AsyncThresholdBytes int64 `yaml:"asyncThresholdBytes"`
+	MaxUploadBytes      int64 `yaml:"maxUploadBytes"`
+	// Largest number of transactions accepted by POST /transactions/batch
+	MaxBatchItems int `yaml:"maxBatchItems"`
 }
 
 type AppConfig struct {
-	Database         DatabaseConfig   `yaml:"database"`
-	ServerConfig     RestServerConfig `yaml:"restServerConfig"`
-	SchedulerConfig  SchedulerConfig  `yaml:"schedulerConfig"`
-	JWTSecret        string           `yaml:"jwtSecret"`
-	AccessTokeTime   int              `yaml:"accessTokeTime"`
-	RefreshTokenTime int              `yaml:"refreshTokenTime"`
+	Database           DatabaseConfig     `yaml:"database"`
+	ServerConfig       RestServerConfig   `yaml:"restServerConfig"`
+	SchedulerConfig    SchedulerConfig    `yaml:"schedulerConfig"`
+	AccountConfig      AccountConfig      `yaml:"accountConfig"`
+	ExpiryConfig       ExpiryConfig       `yaml:"expiryConfig"`
+	ExportConfig       ExportConfig       `yaml:"exportConfig"`
+	OutboxConfig       OutboxConfig       `yaml:"outboxConfig"`
+	WebhookConfig      WebhookConfig      `yaml:"webhookConfig"`
+	ImportConfig       ImportConfig       `yaml:"importConfig"`
+	StatementConfig    StatementConfig    `yaml:"statementConfig"`
+	NotificationConfig NotificationConfig `yaml:"notificationConfig"`
+	JWTSecret          string             `yaml:"jwtSecret"`
+	AdminEmails        []string           `yaml:"adminEmails"`
+	AccessTokeTime     int                `yaml:"accessTokeTime"`
+	RefreshTokenTime   int                `yaml:"refreshTokenTime"`
 }
 
 func LoadConfiguration(pathOfYaml string) (*AppConfig, error) {
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// auditGenesisHash is the prev_hash of the first audit event
+var auditGenesisHash = strings.Repeat("0", 64)
+
+// auditActorSystem is used when a write is made without an actor, e.g. by a background job
+const auditActorSystem = "system"
+
+// auditChains is how many hash chains the audit log is split into. An event goes on the chain of its
+// user, so audited writes only wait on each other when their users share a chain.
+const auditChains = 64
+
+// The audit log is never changed, so the personal data a user may ask to have erased stays out of
+// it. Events name users by ID and record whether such a field changed, not its value.
+
+// auditProfileChange records which parts of a profile an update changed
+func auditProfileChange(usernameChanged, emailChangeRequested bool) map[string]bool {
+	return map[string]bool{"username_changed": usernameChanged, "email_change_requested": emailChangeRequested}
+}
+
+// auditNotificationSettings records the settings without the user's phone number and device token
+func auditNotificationSettings(settings models.NotificationSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"locale":           settings.Locale,
+		"phone_set":        settings.Phone != "",
+		"device_token_set": settings.DeviceToken != "",
+	}
+}
+
+func auditChain(userID int) int {
+	if userID < 0 {
+		userID = -userID
+	}
+	return userID % auditChains
+}
+
+// newAuditEvent builds an unchained audit event, timestamps are truncated to what the database stores
+func newAuditEvent(meta models.AuditMeta, action, targetType string, targetID interface{}, userID int, before, after interface{}) (models.AuditEvent, error) {
+	event := models.AuditEvent{
+		Actor:      meta.Actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		UserID:     userID,
+		RequestID:  meta.RequestID,
+		CreatedOn:  time.Now().UTC().Truncate(time.Microsecond),
+		Chain:      auditChain(userID),
+	}
+	if event.Actor == "" {
+		event.Actor = auditActorSystem
+	}
+
+	var err error
+	if before != nil {
+		if event.Before, err = json.Marshal(before); err != nil {
+			return event, fmt.Errorf("failed to encode audit before value: %v", err)
+		}
+	}
+	if after != nil {
+		if event.After, err = json.Marshal(after); err != nil {
+			return event, fmt.Errorf("failed to encode audit after value: %v", err)
+		}
+	}
+	return event, nil
+}
+
+// auditHash chains an event to the previous one, any edit to a stored event or its order breaks the chain
+func auditHash(event models.AuditEvent) string {
+	fields := []string{
+		event.PrevHash,
+		event.Actor,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		fmt.Sprint(event.UserID),
+		string(event.Before),
+		string(event.After),
+		event.RequestID,
+		event.CreatedOn.UTC().Format(time.RFC3339Nano),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyAuditChain checks events given in id order, heads holds the hash each chain got to and is
+// updated as the events are checked
+func verifyAuditChain(events []models.AuditEvent, heads map[int]string, result *models.AuditVerification) {
+	for _, event := range events {
+		result.EventsChecked++
+		prevHash, ok := heads[event.Chain]
+		if !ok {
+			prevHash = auditGenesisHash
+		}
+		if event.PrevHash != prevHash {
+			result.Valid = false
+			result.FirstBrokenID = event.ID
+			result.BrokenReason = "prev_hash does not match the previous event of its chain"
+			return
+		}
+		if auditHash(event) != event.Hash {
+			result.Valid = false
+			result.FirstBrokenID = event.ID
+			result.BrokenReason = "hash does not match the event contents"
+			return
+		}
+		heads[event.Chain] = event.Hash
+	}
+}
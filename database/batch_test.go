@@ -0,0 +1,85 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/dbtest"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// benchBatchSize is how many transactions BenchmarkAddTransactionsBatch records per call
+const benchBatchSize = 200
+
+// benchUser creates the user the synthetic transactions of a benchmark are recorded for, named
+// uniquely as the Postgres database outlives the run
+func benchUser(b *testing.B, db database.Database) int {
+	b.Helper()
+	username := "bench-" + uuid.NewString()
+	user, err := db.CreateUser(context.Background(), &models.User{Username: username, Email: username + "@example.com", UserPassword: "hash"})
+	if err != nil {
+		b.Fatalf("CreateUser: %v", err)
+	}
+	return user.ID
+}
+
+func syntheticTransactions(userID, count int) []models.Transaction {
+	txns := make([]models.Transaction, count)
+	for i := range txns {
+		txns[i] = models.Transaction{
+			TransactionID:     uuid.New().String(),
+			UserID:            userID,
+			TransactionAmount: 10,
+			Category:          "groceries",
+			ProductCode:       "BENCH",
+		}
+	}
+	return txns
+}
+
+// BenchmarkAddTransaction records one transaction per call, the way /transaction/add does
+func BenchmarkAddTransaction(b *testing.B) {
+	for _, target := range dbtest.Targets {
+		b.Run(target.Name, func(b *testing.B) {
+			db := target.Open(b)
+			txns := syntheticTransactions(benchUser(b, db), b.N)
+
+			b.ResetTimer()
+			for i := range txns {
+				if _, err := db.AddTransaction(context.Background(), &txns[i]); err != nil {
+					b.Fatalf("AddTransaction %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAddTransactionsBatch records the same transactions benchBatchSize at a time, the time
+// per operation is still per transaction
+func BenchmarkAddTransactionsBatch(b *testing.B) {
+	for _, target := range dbtest.Targets {
+		b.Run(target.Name, func(b *testing.B) {
+			db := target.Open(b)
+			txns := syntheticTransactions(benchUser(b, db), b.N)
+
+			b.ResetTimer()
+			for offset := 0; offset < len(txns); offset += benchBatchSize {
+				end := offset + benchBatchSize
+				if end > len(txns) {
+					end = len(txns)
+				}
+				results, err := db.AddTransactionsBatch(context.Background(), txns[offset:end])
+				if err != nil {
+					b.Fatalf("AddTransactionsBatch at %d: %v", offset, err)
+				}
+				for _, result := range results {
+					if result.Status != models.BatchItemCreated {
+						b.Fatalf("batch item %d was %s: %s", offset+result.Index, result.Status, result.Error)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1257 @@
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// missingUserID is never handed out, ids start at 1
+const missingUserID = -1
+
+func checkUsers(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	if err := first(
+		expect(user.ID > 0, "CreateUser returned id %d", user.ID),
+		expect(user.Tier == "standard", "CreateUser defaulted tier to %q, want standard", user.Tier),
+		expect(user.UserPassword == "", "CreateUser returned the password"),
+	); err != nil {
+		return err
+	}
+
+	_, err = r.db.CreateUser(r.ctx, &models.User{Username: r.name("conformance-duplicate"), Email: user.Email, UserPassword: "hash"})
+	if err := expect(err != nil, "CreateUser accepted a duplicate email"); err != nil {
+		return err
+	}
+
+	got, err := r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if err := expect(got.Username == user.Username && got.Email == user.Email && got.ClosedOn == nil,
+		"GetUserByID returned %+v for %+v", got, user); err != nil {
+		return err
+	}
+	if _, err := r.db.GetUserByID(r.ctx, missingUserID, nil); err == nil {
+		return fmt.Errorf("GetUserByID found a missing user")
+	}
+
+	byEmail, err := r.db.GetUserByEmail(r.ctx, user.Email, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %v", err)
+	}
+	if err := expect(byEmail.ID == user.ID && byEmail.UserPassword == "hash", "GetUserByEmail returned %+v", byEmail); err != nil {
+		return err
+	}
+	if _, err := r.db.GetUserByEmail(r.ctx, r.name("missing")+"@example.com", nil); err == nil {
+		return fmt.Errorf("GetUserByEmail found a missing email")
+	}
+
+	newName, newEmail := user.Username+"-renamed", r.name("conformance-changed")+"@example.com"
+	updated, token, err := r.db.UpdateUserProfile(r.ctx, &models.User{ID: user.ID, Username: newName, Email: newEmail})
+	if err != nil {
+		return fmt.Errorf("UpdateUserProfile: %v", err)
+	}
+	if err := first(
+		expect(updated.Username == newName, "UpdateUserProfile did not rename, got %q", updated.Username),
+		expect(updated.Email == user.Email && updated.PendingEmail == newEmail, "UpdateUserProfile changed email to %q pending %q", updated.Email, updated.PendingEmail),
+		expect(token != "", "UpdateUserProfile returned no verification token"),
+	); err != nil {
+		return err
+	}
+	if _, err := r.db.VerifyUserEmail(r.ctx, token+"x"); err == nil {
+		return fmt.Errorf("VerifyUserEmail accepted a wrong token")
+	}
+	verified, err := r.db.VerifyUserEmail(r.ctx, token)
+	if err != nil {
+		return fmt.Errorf("VerifyUserEmail: %v", err)
+	}
+	if err := expect(verified.ID == user.ID && verified.Email == newEmail, "VerifyUserEmail returned %+v", verified); err != nil {
+		return err
+	}
+	if _, err := r.db.VerifyUserEmail(r.ctx, token); err == nil {
+		return fmt.Errorf("VerifyUserEmail accepted a token twice")
+	}
+
+	if err := r.db.UpdateUserPassword(r.ctx, user.ID, "new-hash"); err != nil {
+		return fmt.Errorf("UpdateUserPassword: %v", err)
+	}
+	if err := r.db.UpdateUserPassword(r.ctx, missingUserID, "new-hash"); err == nil {
+		return fmt.Errorf("UpdateUserPassword changed a missing user")
+	}
+
+	previous, err := r.db.SetUserTier(r.ctx, user.ID, "gold")
+	if err != nil {
+		return fmt.Errorf("SetUserTier: %v", err)
+	}
+	got, err = r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if err := first(
+		expect(previous == "standard", "SetUserTier returned previous tier %q", previous),
+		expect(got.Tier == "gold", "SetUserTier left tier %q", got.Tier),
+	); err != nil {
+		return err
+	}
+	if _, err := r.db.SetUserTier(r.ctx, missingUserID, "gold"); err == nil {
+		return fmt.Errorf("SetUserTier changed a missing user")
+	}
+	return nil
+}
+
+func checkTransactions(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+
+	dates := []time.Time{r.now.AddDate(0, 0, -3), r.now.AddDate(0, 0, -1), r.now.AddDate(0, 0, -2)}
+	total := 0
+	var txns []*models.Transaction
+	for i, date := range dates {
+		txn, err := r.earn(user.ID, float64(100*(i+1)), "conformance", date)
+		if err != nil {
+			return err
+		}
+		want := points(float64(100*(i+1)), "conformance")
+		if err := first(
+			expect(txn.ID > 0 && txn.TransactionID != "", "AddTransaction returned id %d, transaction id %q", txn.ID, txn.TransactionID),
+			expect(txn.PointsEarned == want, "AddTransaction earned %d points, want %d", txn.PointsEarned, want),
+		); err != nil {
+			return err
+		}
+		total += want
+		txns = append(txns, txn)
+	}
+
+	_, err = r.db.AddTransaction(r.ctx, &models.Transaction{TransactionID: txns[0].TransactionID, UserID: user.ID, TransactionAmount: 1, Category: "conformance"})
+	if err != database.ErrDuplicateTransaction {
+		return fmt.Errorf("AddTransaction of a recorded transaction id returned %v, want ErrDuplicateTransaction", err)
+	}
+	if _, err := r.db.AddTransaction(r.ctx, &models.Transaction{UserID: missingUserID, TransactionAmount: 1, Category: "conformance"}); err == nil {
+		return fmt.Errorf("AddTransaction accepted a missing user")
+	}
+
+	page1, err := r.db.GetTransactionsByUser(r.ctx, user.ID, 1, 2)
+	if err != nil {
+		return fmt.Errorf("GetTransactionsByUser: %v", err)
+	}
+	page2, err := r.db.GetTransactionsByUser(r.ctx, user.ID, 2, 2)
+	if err != nil {
+		return fmt.Errorf("GetTransactionsByUser: %v", err)
+	}
+	page3, err := r.db.GetTransactionsByUser(r.ctx, user.ID, 3, 2)
+	if err != nil {
+		return fmt.Errorf("GetTransactionsByUser: %v", err)
+	}
+	if err := first(
+		expect(len(page1) == 2 && len(page2) == 1 && len(page3) == 0, "GetTransactionsByUser pages have %d, %d and %d rows, want 2, 1 and 0", len(page1), len(page2), len(page3)),
+	); err != nil {
+		return err
+	}
+	if err := first(
+		expect(page1[0].TransactionID == txns[0].TransactionID && page1[1].TransactionID == txns[1].TransactionID && page2[0].TransactionID == txns[2].TransactionID,
+			"GetTransactionsByUser is not in id order"),
+		expect(page1[0].TransactionDate.Equal(dates[0]), "GetTransactionsByUser returned date %v, want %v", page1[0].TransactionDate, dates[0]),
+	); err != nil {
+		return err
+	}
+
+	balance, err := r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	if err := expect(balance == models.PointsBalance{TotalPoints: total}, "GetPointsBalance returned %+v, want %d points", balance, total); err != nil {
+		return err
+	}
+	empty, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.GetPointsBalance(r.ctx, empty.ID); err == nil {
+		return fmt.Errorf("GetPointsBalance found a balance for a user who never earned")
+	}
+
+	earned, err := r.db.GetPointsHistory(r.ctx, user.ID, 1, 10, "", "", "earn")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	redeemed, err := r.db.GetPointsHistory(r.ctx, user.ID, 1, 10, "", "", "redeem")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	future, err := r.db.GetPointsHistory(r.ctx, user.ID, 1, 10, time.Now().AddDate(0, 0, 2).Format("2006-01-02"), "", "")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	paged, err := r.db.GetPointsHistory(r.ctx, user.ID, 2, 2, "", "", "")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	if err := first(
+		expect(len(earned) == 3, "GetPointsHistory of earn returned %d rows, want 3", len(earned)),
+		expect(len(redeemed) == 0, "GetPointsHistory of redeem returned %d rows, want 0", len(redeemed)),
+		expect(len(future) == 0, "GetPointsHistory from the day after tomorrow returned %d rows, want 0", len(future)),
+		expect(len(paged) == 1, "GetPointsHistory page 2 of 2 returned %d rows, want 1", len(paged)),
+	); err != nil {
+		return err
+	}
+	for i := 1; i < len(earned); i++ {
+		if earned[i].Date.After(earned[i-1].Date) {
+			return fmt.Errorf("GetPointsHistory is not newest first")
+		}
+	}
+
+	got, err := r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if err := expect(got.LastActivityOn != nil && got.LastActivityOn.Equal(dates[1]),
+		"last activity is %v, want the latest purchase %v", got.LastActivityOn, dates[1]); err != nil {
+		return err
+	}
+
+	// a purchase dated in the future counts as activity now, not on its date
+	if _, err := r.earn(user.ID, 10, "conformance", r.now.AddDate(50, 0, 0)); err != nil {
+		return err
+	}
+	got, err = r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	return expect(got.LastActivityOn != nil && !got.LastActivityOn.After(time.Now()),
+		"a purchase dated in the future moved the last activity to %v", got.LastActivityOn)
+}
+
+func checkBatch(r *run) error {
+	first, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	second, err := r.newUser()
+	if err != nil {
+		return err
+	}
+
+	results, err := r.db.AddTransactionsBatch(r.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("AddTransactionsBatch: %v", err)
+	}
+	if err := expect(len(results) == 0, "AddTransactionsBatch of nothing returned %d results", len(results)); err != nil {
+		return err
+	}
+
+	id := r.name("conformance-batch")
+	batch := []models.Transaction{
+		{TransactionID: id, UserID: first.ID, TransactionAmount: 10, Category: "conformance", TransactionDate: r.now},
+		{TransactionID: id, UserID: first.ID, TransactionAmount: 10, Category: "conformance", TransactionDate: r.now},
+		{UserID: missingUserID, TransactionAmount: 10, Category: "conformance", TransactionDate: r.now},
+		{UserID: second.ID, TransactionAmount: 20, Category: "conformance", TransactionDate: r.now},
+	}
+	results, err = r.db.AddTransactionsBatch(r.ctx, batch)
+	if err != nil {
+		return fmt.Errorf("AddTransactionsBatch: %v", err)
+	}
+	want := []string{models.BatchItemCreated, models.BatchItemDuplicate, models.BatchItemInvalid, models.BatchItemCreated}
+	if len(results) != len(want) {
+		return fmt.Errorf("AddTransactionsBatch returned %d results for %d items", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Index != i || result.Status != want[i] {
+			return fmt.Errorf("AddTransactionsBatch item %d is %q at index %d, want %q", i, result.Status, result.Index, want[i])
+		}
+	}
+	if err := expect(results[0].TransactionID == id && results[0].PointsEarned == points(10, "conformance") && results[3].TransactionID != "",
+		"AddTransactionsBatch created items are %+v and %+v", results[0], results[3]); err != nil {
+		return err
+	}
+
+	again, err := r.db.AddTransactionsBatch(r.ctx, []models.Transaction{{TransactionID: id, UserID: first.ID, TransactionAmount: 10, Category: "conformance"}})
+	if err != nil {
+		return fmt.Errorf("AddTransactionsBatch: %v", err)
+	}
+	if err := expect(again[0].Status == models.BatchItemDuplicate, "AddTransactionsBatch recorded a transaction id twice"); err != nil {
+		return err
+	}
+
+	balance, err := r.db.GetPointsBalance(r.ctx, second.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	events, err := r.db.GetPointsEvents(r.ctx, first.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsEvents: %v", err)
+	}
+	return expect(balance.TotalPoints == points(20, "conformance") && len(events) == 1 && events[0].TransactionID == id,
+		"AddTransactionsBatch left balance %+v and events %+v", balance, events)
+}
+
+func checkRedeem(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	txn, err := r.earn(user.ID, 100, "conformance", r.now.AddDate(0, -1, 0))
+	if err != nil {
+		return err
+	}
+
+	remaining, err := r.db.DeductPoints(r.ctx, user.ID, 40)
+	if err != nil {
+		return fmt.Errorf("DeductPoints: %v", err)
+	}
+	balance, err := r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	if err := first(
+		expect(remaining == txn.PointsEarned-40, "DeductPoints left %d points, want %d", remaining, txn.PointsEarned-40),
+		expect(balance == models.PointsBalance{TotalPoints: remaining, PointsRedeemed: 40}, "DeductPoints left balance %+v", balance),
+	); err != nil {
+		return err
+	}
+
+	events, err := r.db.GetPointsEvents(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsEvents: %v", err)
+	}
+	if err := expect(len(events) == 2 && events[0].EventType == models.PointsEventEarned && events[1].EventType == models.PointsEventRedeemed && events[1].Points == 40,
+		"GetPointsEvents returned %+v", events); err != nil {
+		return err
+	}
+
+	got, err := r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if err := expect(got.LastActivityOn != nil && got.LastActivityOn.After(txn.TransactionDate), "a redemption did not move the last activity"); err != nil {
+		return err
+	}
+
+	history, err := r.db.GetPointsHistory(r.ctx, user.ID, 1, 10, "", "", "redeem")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	if err := expect(len(history) == 1 && history[0].Points == 40, "GetPointsHistory returned %+v", history); err != nil {
+		return err
+	}
+	if _, err := r.db.DeductPoints(r.ctx, user.ID, remaining+1); !errors.Is(err, database.ErrInsufficientPoints) {
+		return fmt.Errorf("DeductPoints redeemed more than the balance, got %v", err)
+	}
+	if _, err := r.db.DeductPoints(r.ctx, missingUserID, 1); !errors.Is(err, database.ErrNoPointsBalance) {
+		return fmt.Errorf("DeductPoints redeemed from a missing balance, got %v", err)
+	}
+	return nil
+}
+
+func checkLedger(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	txn, err := r.earn(user.ID, 100, "conformance", r.now)
+	if err != nil {
+		return err
+	}
+
+	balance, err := r.db.AdjustPoints(r.ctx, user.ID, 15, "goodwill")
+	if err != nil {
+		return fmt.Errorf("AdjustPoints: %v", err)
+	}
+	if err := expect(balance.TotalPoints == txn.PointsEarned+15, "AdjustPoints returned %+v", balance); err != nil {
+		return err
+	}
+	if _, err := r.db.AdjustPoints(r.ctx, missingUserID, 15, "goodwill"); err == nil {
+		return fmt.Errorf("AdjustPoints adjusted a missing user")
+	}
+
+	refund, err := r.db.RefundTransaction(r.ctx, txn.TransactionID, "returned")
+	if err != nil {
+		return fmt.Errorf("RefundTransaction: %v", err)
+	}
+	if err := expect(refund.UserID == user.ID && refund.Points == txn.PointsEarned && refund.EventType == models.PointsEventRefunded,
+		"RefundTransaction returned %+v", refund); err != nil {
+		return err
+	}
+	if _, err := r.db.RefundTransaction(r.ctx, txn.TransactionID, "returned"); err == nil {
+		return fmt.Errorf("RefundTransaction refunded a transaction twice")
+	}
+	if _, err := r.db.RefundTransaction(r.ctx, r.name("missing"), "returned"); err == nil {
+		return fmt.Errorf("RefundTransaction refunded a missing transaction")
+	}
+
+	balance, err = r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	events, err := r.db.GetPointsEvents(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsEvents: %v", err)
+	}
+	types := []string{}
+	for i, event := range events {
+		types = append(types, event.EventType)
+		if i > 0 && event.ID <= events[i-1].ID {
+			return fmt.Errorf("GetPointsEvents is not in id order")
+		}
+	}
+	if err := first(
+		expect(balance.TotalPoints == 15, "the balance after a refund is %+v, want 15 points", balance),
+		expect(fmt.Sprint(types) == fmt.Sprint([]string{models.PointsEventEarned, models.PointsEventAdjusted, models.PointsEventRefunded}),
+			"GetPointsEvents returned %v", types),
+	); err != nil {
+		return err
+	}
+
+	rebuilt := models.PointsBalance{TotalPoints: 5, PointsRedeemed: 7}
+	lastEventID := events[len(events)-1].ID
+	if err := r.db.SetPointsBalance(r.ctx, user.ID, balance, lastEventID-1, rebuilt); !errors.Is(err, database.ErrBalanceChanged) {
+		return fmt.Errorf("SetPointsBalance overwrote a balance whose events changed, got %v", err)
+	}
+	if err := r.db.SetPointsBalance(r.ctx, user.ID, rebuilt, lastEventID, rebuilt); !errors.Is(err, database.ErrBalanceChanged) {
+		return fmt.Errorf("SetPointsBalance overwrote a balance that changed, got %v", err)
+	}
+	if err := r.db.SetPointsBalance(r.ctx, user.ID, balance, lastEventID, rebuilt); err != nil {
+		return fmt.Errorf("SetPointsBalance: %v", err)
+	}
+	balance, err = r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	if err := expect(balance == rebuilt, "SetPointsBalance left %+v, want %+v", balance, rebuilt); err != nil {
+		return err
+	}
+
+	userIDs, err := r.db.ListLedgerUserIDs(r.ctx)
+	if err != nil {
+		return fmt.Errorf("ListLedgerUserIDs: %v", err)
+	}
+	return first(
+		expect(sort.IntsAreSorted(userIDs), "ListLedgerUserIDs is not sorted"),
+		expect(containsInt(userIDs, user.ID), "ListLedgerUserIDs is missing user %d", user.ID),
+	)
+}
+
+func checkReconciliation(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	txn, err := r.earn(user.ID, 100, "conformance", r.now)
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.AdjustPoints(r.ctx, user.ID, -10, "correction"); err != nil {
+		return fmt.Errorf("AdjustPoints: %v", err)
+	}
+	if err := r.db.LogPointsHistory(r.ctx, user.ID, 5, "redeem", "till"); err != nil {
+		return fmt.Errorf("LogPointsHistory: %v", err)
+	}
+
+	sources, err := r.db.GetBalanceSources(r.ctx)
+	if err != nil {
+		return fmt.Errorf("GetBalanceSources: %v", err)
+	}
+	var source *models.BalanceSources
+	for i := range sources {
+		if i > 0 && sources[i].UserID <= sources[i-1].UserID {
+			return fmt.Errorf("GetBalanceSources is not in user order")
+		}
+		if sources[i].UserID == user.ID {
+			source = &sources[i]
+		}
+	}
+	if source == nil {
+		return fmt.Errorf("GetBalanceSources is missing user %d", user.ID)
+	}
+	want := models.BalanceSources{UserID: user.ID, Earned: txn.PointsEarned, Redeemed: 5, Adjusted: -10,
+		Stored: models.PointsBalance{TotalPoints: txn.PointsEarned - 10}}
+	if err := expect(*source == want, "GetBalanceSources returned %+v, want %+v", *source, want); err != nil {
+		return err
+	}
+
+	expected := models.PointsBalance{TotalPoints: txn.PointsEarned - 15, PointsRedeemed: 5}
+	stale := models.PointsBalance{TotalPoints: source.Stored.TotalPoints + 1}
+	if err := r.db.ApplyReconciliationCorrection(r.ctx, user.ID, stale, expected, "reconciliation"); !errors.Is(err, database.ErrBalanceChanged) {
+		return fmt.Errorf("ApplyReconciliationCorrection corrected a balance that changed, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.db.ApplyReconciliationCorrection(r.ctx, user.ID, source.Stored, expected, "reconciliation"); err != nil {
+			return fmt.Errorf("ApplyReconciliationCorrection: %v", err)
+		}
+	}
+	balance, err := r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	events, err := r.db.GetPointsEvents(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsEvents: %v", err)
+	}
+	last := events[len(events)-1]
+	return first(
+		expect(balance == expected, "ApplyReconciliationCorrection left %+v, want %+v", balance, expected),
+		expect(len(events) == 3 && last.EventType == models.PointsEventAdjusted && last.Points == -5,
+			"ApplyReconciliationCorrection recorded %+v, want one adjustment of -5", events),
+	)
+}
+
+func checkExpiry(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	old, err := r.earn(user.ID, 100, "conformance", r.now.AddDate(-3, 0, 0))
+	if err != nil {
+		return err
+	}
+	older, err := r.earn(user.ID, 50, "conformance", r.now.AddDate(-4, 0, 0))
+	if err != nil {
+		return err
+	}
+	refunded, err := r.earn(user.ID, 70, "conformance", r.now.AddDate(-2, 0, 0))
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.RefundTransaction(r.ctx, refunded.TransactionID, "returned"); err != nil {
+		return fmt.Errorf("RefundTransaction: %v", err)
+	}
+	recent, err := r.earn(user.ID, 10, "conformance", r.now.AddDate(0, 0, -1))
+	if err != nil {
+		return err
+	}
+
+	cutoff := r.now.AddDate(-1, 0, 0)
+	var zero time.Time
+	candidates, err := r.db.GetExpiryCandidates(r.ctx, user.ID, cutoff, zero, zero, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	if err := expect(transactionIDs(candidates) == fmt.Sprint([]string{older.TransactionID, old.TransactionID}),
+		"GetExpiryCandidates returned %s, want the two old purchases oldest first", transactionIDs(candidates)); err != nil {
+		return err
+	}
+	c := candidates[0]
+	if err := expect(c.Tier == "standard" && c.LastActivityOn.Equal(recent.TransactionDate) && c.PointsEarned == older.PointsEarned,
+		"GetExpiryCandidates returned %+v", c); err != nil {
+		return err
+	}
+
+	page, err := r.db.GetExpiryCandidates(r.ctx, user.ID, cutoff, zero, zero, 0, 1)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	next, err := r.db.GetExpiryCandidates(r.ctx, user.ID, cutoff, zero, page[0].TransactionDate, page[0].ID, 1)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	if err := expect(len(page) == 1 && len(next) == 1 && next[0].TransactionID == old.TransactionID,
+		"GetExpiryCandidates does not page by its cursor"); err != nil {
+		return err
+	}
+
+	// the user was active yesterday, so nothing is idle; a user idle for years is
+	active, err := r.db.GetExpiryCandidates(r.ctx, user.ID, zero, r.now.AddDate(0, -6, 0), zero, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	idleUser, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	idleLot, err := r.earn(idleUser.ID, 30, "conformance", r.now.AddDate(-2, 0, 0))
+	if err != nil {
+		return err
+	}
+	idle, err := r.db.GetExpiryCandidates(r.ctx, idleUser.ID, zero, r.now.AddDate(-1, 0, 0), zero, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	if err := first(
+		expect(len(active) == 0, "GetExpiryCandidates returned %d lots of an active user for the idle cutoff", len(active)),
+		expect(len(idle) == 1 && idle[0].TransactionID == idleLot.TransactionID, "GetExpiryCandidates missed the lot of an idle user"),
+	); err != nil {
+		return err
+	}
+
+	c.ExpiryReason = "conformance expiry"
+	checkpoint := models.JobCheckpoint{Job: r.name("conformance"), Cutoff: cutoff, CursorDate: c.TransactionDate, CursorID: c.ID, Processed: 1, StartedOn: r.now}
+	expired, expiredPoints, err := r.db.ExpireTransactions(r.ctx, []models.ExpiryCandidate{c}, checkpoint)
+	if err != nil {
+		return fmt.Errorf("ExpireTransactions: %v", err)
+	}
+	again, _, err := r.db.ExpireTransactions(r.ctx, []models.ExpiryCandidate{c}, checkpoint)
+	if err != nil {
+		return fmt.Errorf("ExpireTransactions: %v", err)
+	}
+	if err := first(
+		expect(expired == 1 && expiredPoints == c.PointsEarned, "ExpireTransactions expired %d transactions and %d points", expired, expiredPoints),
+		expect(again == 0, "ExpireTransactions expired a transaction twice"),
+	); err != nil {
+		return err
+	}
+	saved, err := r.db.GetJobCheckpoint(r.ctx, checkpoint.Job)
+	if err != nil {
+		return fmt.Errorf("GetJobCheckpoint: %v", err)
+	}
+	if err := expect(saved != nil && saved.CursorID == c.ID && saved.Processed == 1, "ExpireTransactions saved checkpoint %+v", saved); err != nil {
+		return err
+	}
+
+	if err := r.db.ExpirePoints(r.ctx, user.ID, old.TransactionID, old.PointsEarned, old.TransactionDate); err != nil {
+		return fmt.Errorf("ExpirePoints: %v", err)
+	}
+	if err := r.db.ExpirePoints(r.ctx, user.ID, old.TransactionID, old.PointsEarned, old.TransactionDate); err != nil {
+		return fmt.Errorf("ExpirePoints of an expired transaction: %v", err)
+	}
+
+	left, err := r.db.GetExpiryCandidates(r.ctx, user.ID, cutoff, zero, zero, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	balance, err := r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	history, err := r.db.GetPointsHistory(r.ctx, user.ID, 1, 10, "", "", "expired")
+	if err != nil {
+		return fmt.Errorf("GetPointsHistory: %v", err)
+	}
+	reasons := map[string]bool{}
+	for _, entry := range history {
+		reasons[entry.Reason] = true
+	}
+	return first(
+		expect(len(left) == 0, "GetExpiryCandidates still returns %d expired lots", len(left)),
+		expect(balance.TotalPoints == recent.PointsEarned, "the balance after expiry is %+v, want %d points", balance, recent.PointsEarned),
+		expect(len(history) == 2 && reasons["conformance expiry"], "the expiry history is %+v", history),
+	)
+}
+
+func checkCheckpoints(r *run) error {
+	job := r.name("conformance-job")
+	missing, err := r.db.GetJobCheckpoint(r.ctx, job)
+	if err != nil {
+		return fmt.Errorf("GetJobCheckpoint: %v", err)
+	}
+	if err := expect(missing == nil, "GetJobCheckpoint found a checkpoint that was never saved"); err != nil {
+		return err
+	}
+
+	checkpoint := models.JobCheckpoint{Job: job, Cutoff: r.now.AddDate(-1, 0, 0), CursorDate: r.now.AddDate(-2, 0, 0), CursorID: 3, Processed: 9, StartedOn: r.now}
+	if err := r.db.SaveJobCheckpoint(r.ctx, checkpoint); err != nil {
+		return fmt.Errorf("SaveJobCheckpoint: %v", err)
+	}
+	completed := r.now.Add(time.Minute)
+	checkpoint.CompletedOn = &completed
+	if err := r.db.SaveJobCheckpoint(r.ctx, checkpoint); err != nil {
+		return fmt.Errorf("SaveJobCheckpoint: %v", err)
+	}
+
+	saved, err := r.db.GetJobCheckpoint(r.ctx, job)
+	if err != nil {
+		return fmt.Errorf("GetJobCheckpoint: %v", err)
+	}
+	if saved == nil {
+		return fmt.Errorf("GetJobCheckpoint lost a saved checkpoint")
+	}
+	return expect(saved.Cutoff.Equal(checkpoint.Cutoff) && saved.CursorDate.Equal(checkpoint.CursorDate) && saved.CursorID == 3 &&
+		saved.Processed == 9 && saved.StartedOn.Equal(r.now) && saved.CompletedOn != nil && saved.CompletedOn.Equal(completed) && !saved.UpdatedOn.IsZero(),
+		"GetJobCheckpoint returned %+v, want %+v", saved, checkpoint)
+}
+
+func checkWarnings(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	lot := r.name("conformance-lot")
+	warnings := []models.ExpiryWarning{
+		{UserID: user.ID, TransactionID: lot, WindowDays: 30, Points: 10, ExpiresOn: r.now.AddDate(0, 0, 20)},
+		{UserID: user.ID, TransactionID: lot, WindowDays: 7, Points: 10, ExpiresOn: r.now.AddDate(0, 0, 5)},
+	}
+	recorded, err := r.db.RecordExpiryWarnings(r.ctx, warnings)
+	if err != nil {
+		return fmt.Errorf("RecordExpiryWarnings: %v", err)
+	}
+	again, err := r.db.RecordExpiryWarnings(r.ctx, warnings)
+	if err != nil {
+		return fmt.Errorf("RecordExpiryWarnings: %v", err)
+	}
+	if err := expect(recorded == 2 && again == 0, "RecordExpiryWarnings recorded %d then %d warnings, want 2 then 0", recorded, again); err != nil {
+		return err
+	}
+
+	pending, err := r.pendingWarnings(user.ID)
+	if err != nil {
+		return err
+	}
+	if err := expect(len(pending) == 2 && pending[0].WindowDays == 7 && pending[1].WindowDays == 30 && pending[0].Email == user.Email,
+		"GetPendingExpiryWarnings returned %+v", pending); err != nil {
+		return err
+	}
+
+	if err := r.db.MarkExpiryWarningsNotified(r.ctx, []int64{pending[0].ID}); err != nil {
+		return fmt.Errorf("MarkExpiryWarningsNotified: %v", err)
+	}
+	pending, err = r.pendingWarnings(user.ID)
+	if err != nil {
+		return err
+	}
+	return expect(len(pending) == 1 && pending[0].WindowDays == 30, "GetPendingExpiryWarnings returned %+v after one was notified", pending)
+}
+
+func (r *run) pendingWarnings(userID int) ([]models.ExpiryWarning, error) {
+	all, err := r.db.GetPendingExpiryWarnings(r.ctx, 1000000)
+	if err != nil {
+		return nil, fmt.Errorf("GetPendingExpiryWarnings: %v", err)
+	}
+	var warnings []models.ExpiryWarning
+	for _, w := range all {
+		if w.UserID == userID {
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings, nil
+}
+
+func checkAccountClosure(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	txn, err := r.earn(user.ID, 100, "conformance", r.now.AddDate(-3, 0, 0))
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.db.CloseUserAccount(r.ctx, user.ID, "unknown", 0); err == nil {
+		return fmt.Errorf("CloseUserAccount accepted an unknown policy")
+	}
+	got, err := r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	if err := expect(got.ClosedOn == nil, "a failed CloseUserAccount closed the account"); err != nil {
+		return err
+	}
+
+	closure, err := r.db.CloseUserAccount(r.ctx, user.ID, "cashout", 0.5)
+	if err != nil {
+		return fmt.Errorf("CloseUserAccount: %v", err)
+	}
+	if err := expect(closure.PointsSettled == txn.PointsEarned && closure.CashOutAmount == float64(txn.PointsEarned)*0.5 && !closure.ClosedOn.IsZero(),
+		"CloseUserAccount returned %+v", closure); err != nil {
+		return err
+	}
+
+	got, err = r.db.GetUserByID(r.ctx, user.ID, nil)
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %v", err)
+	}
+	balance, err := r.db.GetPointsBalance(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	candidates, err := r.db.GetExpiryCandidates(r.ctx, user.ID, r.now, time.Time{}, time.Time{}, 0, 10)
+	if err != nil {
+		return fmt.Errorf("GetExpiryCandidates: %v", err)
+	}
+	if err := first(
+		expect(got.ClosedOn != nil && got.Username == fmt.Sprintf("deleted-user-%d", user.ID), "CloseUserAccount left %+v", got),
+		expect(balance == models.PointsBalance{PointsRedeemed: txn.PointsEarned}, "a cash out left balance %+v", balance),
+		expect(len(candidates) == 0, "GetExpiryCandidates returned lots of a closed account"),
+	); err != nil {
+		return err
+	}
+	if _, err := r.db.GetUserByEmail(r.ctx, user.Email, nil); err == nil {
+		return fmt.Errorf("GetUserByEmail found a closed account")
+	}
+	if _, err := r.db.CloseUserAccount(r.ctx, user.ID, "cashout", 0.5); err == nil {
+		return fmt.Errorf("CloseUserAccount closed an account twice")
+	}
+	if _, err := r.earn(user.ID, 10, "conformance", r.now); err == nil {
+		return fmt.Errorf("AddTransaction accepted a closed account")
+	}
+	if _, err := r.db.SetUserTier(r.ctx, user.ID, "gold"); err == nil {
+		return fmt.Errorf("SetUserTier changed a closed account")
+	}
+
+	forfeiting, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	if _, err := r.earn(forfeiting.ID, 100, "conformance", r.now); err != nil {
+		return err
+	}
+	if _, err := r.db.CloseUserAccount(r.ctx, forfeiting.ID, "forfeit", 0); err != nil {
+		return fmt.Errorf("CloseUserAccount: %v", err)
+	}
+	balance, err = r.db.GetPointsBalance(r.ctx, forfeiting.ID)
+	if err != nil {
+		return fmt.Errorf("GetPointsBalance: %v", err)
+	}
+	return expect(balance == models.PointsBalance{}, "a forfeit left balance %+v", balance)
+}
+
+func checkOutbox(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	txn, err := r.earn(user.ID, 100, "conformance", r.now)
+	if err != nil {
+		return err
+	}
+
+	event, err := r.claimOutboxEvent(txn.TransactionID)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		return fmt.Errorf("ClaimOutboxEvents is missing the event of a purchase")
+	}
+	want := models.DomainEvent{ID: event.Event.ID, Type: "points." + models.PointsEventEarned, UserID: user.ID, Points: txn.PointsEarned,
+		TransactionID: txn.TransactionID, Merchant: "conformance", Reason: event.Event.Reason,
+		Balance: models.PointsBalance{TotalPoints: txn.PointsEarned}, OccurredOn: event.Event.OccurredOn}
+	if err := expect(event.Event == want && event.Attempts == 0 && len(event.DeliveredTo) == 0,
+		"ClaimOutboxEvents returned %+v, want %+v", *event, want); err != nil {
+		return err
+	}
+	if claimed, err := r.claimOutboxEvent(txn.TransactionID); err != nil || claimed != nil {
+		return fmt.Errorf("ClaimOutboxEvents handed out a claimed event again, %v", err)
+	}
+
+	if err := r.db.MarkOutboxEventDelivered(r.ctx, event.ID, "first"); err != nil {
+		return fmt.Errorf("MarkOutboxEventDelivered: %v", err)
+	}
+	dead, err := r.db.MarkOutboxEventFailed(r.ctx, event.ID, "unreachable", 2)
+	if err != nil {
+		return fmt.Errorf("MarkOutboxEventFailed: %v", err)
+	}
+	failed, err := r.claimOutboxEvent(txn.TransactionID)
+	if err != nil {
+		return err
+	}
+	if err := expect(!dead && failed != nil && failed.Attempts == 1 && fmt.Sprint(failed.DeliveredTo) == "[first]",
+		"a failed outbox event is %+v, want pending after 1 attempt and delivered to first", failed); err != nil {
+		return err
+	}
+
+	if dead, err = r.db.MarkOutboxEventFailed(r.ctx, event.ID, "unreachable", 2); err != nil {
+		return fmt.Errorf("MarkOutboxEventFailed: %v", err)
+	}
+	gaveUp, err := r.claimOutboxEvent(txn.TransactionID)
+	if err != nil {
+		return err
+	}
+	if err := expect(dead && gaveUp == nil, "an outbox event that failed its last attempt is still pending"); err != nil {
+		return err
+	}
+
+	next, err := r.earn(user.ID, 10, "conformance", r.now)
+	if err != nil {
+		return err
+	}
+	event, err = r.claimOutboxEvent(next.TransactionID)
+	if err != nil {
+		return err
+	}
+	if event == nil {
+		return fmt.Errorf("ClaimOutboxEvents is missing the event of a purchase")
+	}
+	if err := r.db.MarkOutboxEventPublished(r.ctx, event.ID); err != nil {
+		return fmt.Errorf("MarkOutboxEventPublished: %v", err)
+	}
+	published, err := r.claimOutboxEvent(next.TransactionID)
+	if err != nil {
+		return err
+	}
+	return expect(published == nil, "a published outbox event is still pending")
+}
+
+// claimOutboxEvent claims every claimable event and returns the one of the transaction
+func (r *run) claimOutboxEvent(transactionID string) (*models.OutboxEvent, error) {
+	events, err := r.db.ClaimOutboxEvents(r.ctx, 1000000, time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimOutboxEvents: %v", err)
+	}
+	for i := range events {
+		if i > 0 && events[i].ID <= events[i-1].ID {
+			return nil, fmt.Errorf("ClaimOutboxEvents is not oldest first")
+		}
+		if events[i].Event.TransactionID == transactionID {
+			return &events[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func checkNotifications(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+
+	settings, err := r.db.GetNotificationSettings(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetNotificationSettings: %v", err)
+	}
+	preferences, err := r.db.GetNotificationPreferences(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetNotificationPreferences: %v", err)
+	}
+	if err := first(
+		expect(settings == models.NotificationSettings{UserID: user.ID, Locale: "en"}, "GetNotificationSettings defaulted to %+v", settings),
+		expect(preferences != nil && len(preferences) == 0, "GetNotificationPreferences returned %+v for a user without any", preferences),
+	); err != nil {
+		return err
+	}
+
+	saved := models.NotificationSettings{UserID: user.ID, Locale: "es", Phone: "+34600000000"}
+	err = r.db.UpdateNotificationPreferences(r.ctx, saved, []models.NotificationPreference{
+		{Channel: models.NotificationChannelSMS, EventType: "*", Enabled: true},
+		{Channel: models.NotificationChannelEmail, EventType: "points.earned", Enabled: false},
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateNotificationPreferences: %v", err)
+	}
+	err = r.db.UpdateNotificationPreferences(r.ctx, saved, []models.NotificationPreference{{Channel: models.NotificationChannelSMS, EventType: "*", Enabled: false}})
+	if err != nil {
+		return fmt.Errorf("UpdateNotificationPreferences: %v", err)
+	}
+
+	settings, err = r.db.GetNotificationSettings(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetNotificationSettings: %v", err)
+	}
+	preferences, err = r.db.GetNotificationPreferences(r.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("GetNotificationPreferences: %v", err)
+	}
+	want := []models.NotificationPreference{
+		{UserID: user.ID, Channel: models.NotificationChannelEmail, EventType: "points.earned", Enabled: false},
+		{UserID: user.ID, Channel: models.NotificationChannelSMS, EventType: "*", Enabled: false},
+	}
+	if err := first(
+		expect(settings == saved, "GetNotificationSettings returned %+v, want %+v", settings, saved),
+		expect(fmt.Sprint(preferences) == fmt.Sprint(want), "GetNotificationPreferences returned %+v, want %+v", preferences, want),
+	); err != nil {
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		err := r.db.LogNotificationDelivery(r.ctx, models.NotificationDelivery{
+			NotificationID: fmt.Sprintf("%s-%d", r.id, i), UserID: user.ID, EventType: "points.earned",
+			Channel: models.NotificationChannelEmail, Recipient: user.Email, Status: models.NotificationDeliverySent,
+		})
+		if err != nil {
+			return fmt.Errorf("LogNotificationDelivery: %v", err)
+		}
+	}
+	page1, err := r.db.GetNotificationDeliveries(r.ctx, user.ID, 1, 2)
+	if err != nil {
+		return fmt.Errorf("GetNotificationDeliveries: %v", err)
+	}
+	page2, err := r.db.GetNotificationDeliveries(r.ctx, user.ID, 2, 2)
+	if err != nil {
+		return fmt.Errorf("GetNotificationDeliveries: %v", err)
+	}
+	return first(
+		expect(len(page1) == 2 && len(page2) == 1, "GetNotificationDeliveries pages have %d and %d rows, want 2 and 1", len(page1), len(page2)),
+		expect(len(page1) == 2 && page1[0].NotificationID == r.id+"-3" && page1[0].Recipient == user.Email,
+			"GetNotificationDeliveries is not newest first: %+v", page1),
+	)
+}
+
+func checkWebhooks(r *run) error {
+	merchant := r.name("conformance")
+	subscription, err := r.db.CreateWebhookSubscription(r.ctx, &models.WebhookSubscription{
+		Merchant: merchant, URL: "http://localhost/hook", Secret: "secret", EventTypes: []string{"points.earned", "points.redeemed"},
+	})
+	if err != nil {
+		return fmt.Errorf("CreateWebhookSubscription: %v", err)
+	}
+	if err := expect(subscription.ID > 0 && subscription.Active, "CreateWebhookSubscription returned %+v", subscription); err != nil {
+		return err
+	}
+
+	got, err := r.db.GetWebhookSubscription(r.ctx, subscription.ID)
+	if err != nil {
+		return fmt.Errorf("GetWebhookSubscription: %v", err)
+	}
+	if err := expect(got.Merchant == merchant && fmt.Sprint(got.EventTypes) == fmt.Sprint(subscription.EventTypes),
+		"GetWebhookSubscription returned %+v", got); err != nil {
+		return err
+	}
+	if _, err := r.db.GetWebhookSubscription(r.ctx, int(^uint32(0)>>1)); err == nil {
+		return fmt.Errorf("GetWebhookSubscription found a missing subscription")
+	}
+
+	event := models.DomainEvent{ID: r.name("conformance-event"), Type: "points.earned", UserID: 1, Points: 10}
+	for i := 0; i < 2; i++ {
+		if err := r.db.CreateWebhookDeliveries(r.ctx, event, []int{subscription.ID}); err != nil {
+			return fmt.Errorf("CreateWebhookDeliveries: %v", err)
+		}
+	}
+	deliveries, err := r.db.GetWebhookDeliveries(r.ctx, subscription.ID, 1, 10)
+	if err != nil {
+		return fmt.Errorf("GetWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		return fmt.Errorf("GetWebhookDeliveries returned %d deliveries of one event, want 1", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if err := expect(delivery.Status == models.WebhookDeliveryPending && delivery.EventID == event.ID && delivery.NextAttemptOn != nil,
+		"CreateWebhookDeliveries queued %+v", delivery); err != nil {
+		return err
+	}
+
+	due, err := r.db.ClaimDueWebhookDeliveries(r.ctx, 1000000, time.Minute)
+	if err != nil {
+		return fmt.Errorf("ClaimDueWebhookDeliveries: %v", err)
+	}
+	if err := expect(containsDelivery(due, delivery.ID), "ClaimDueWebhookDeliveries is missing a delivery that is due"); err != nil {
+		return err
+	}
+	due, err = r.db.ClaimDueWebhookDeliveries(r.ctx, 1000000, time.Minute)
+	if err != nil {
+		return fmt.Errorf("ClaimDueWebhookDeliveries: %v", err)
+	}
+	if err := expect(!containsDelivery(due, delivery.ID), "ClaimDueWebhookDeliveries handed out a claimed delivery again"); err != nil {
+		return err
+	}
+
+	delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.NextAttemptOn = models.WebhookDeliverySucceeded, 1, 200, nil
+	attempt := models.WebhookDeliveryAttempt{Attempt: 1, ResponseStatus: 200, DurationMs: 12, AttemptedOn: r.now}
+	if err := r.db.RecordWebhookAttempt(r.ctx, &delivery, attempt); err != nil {
+		return fmt.Errorf("RecordWebhookAttempt: %v", err)
+	}
+	stored, err := r.db.GetWebhookDelivery(r.ctx, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("GetWebhookDelivery: %v", err)
+	}
+	attempts, err := r.db.GetWebhookDeliveryAttempts(r.ctx, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("GetWebhookDeliveryAttempts: %v", err)
+	}
+	due, err = r.db.ClaimDueWebhookDeliveries(r.ctx, 1000000, time.Minute)
+	if err != nil {
+		return fmt.Errorf("ClaimDueWebhookDeliveries: %v", err)
+	}
+	if err := first(
+		expect(stored.Status == models.WebhookDeliverySucceeded && stored.Attempts == 1 && stored.ResponseStatus == 200, "RecordWebhookAttempt left %+v", stored),
+		expect(len(attempts) == 1 && attempts[0].ResponseStatus == 200 && attempts[0].DeliveryID == delivery.ID, "GetWebhookDeliveryAttempts returned %+v", attempts),
+		expect(!containsDelivery(due, delivery.ID), "ClaimDueWebhookDeliveries returned a delivered webhook"),
+	); err != nil {
+		return err
+	}
+
+	if err := r.db.RedeliverWebhook(r.ctx, delivery.ID); err != nil {
+		return fmt.Errorf("RedeliverWebhook: %v", err)
+	}
+	stored, err = r.db.GetWebhookDelivery(r.ctx, delivery.ID)
+	if err != nil {
+		return fmt.Errorf("GetWebhookDelivery: %v", err)
+	}
+	if err := expect(stored.Status == models.WebhookDeliveryPending && stored.Attempts == 0, "RedeliverWebhook left %+v", stored); err != nil {
+		return err
+	}
+	if err := r.db.RedeliverWebhook(r.ctx, 1<<62); err == nil {
+		return fmt.Errorf("RedeliverWebhook requeued a missing delivery")
+	}
+	if _, err := r.db.GetWebhookDelivery(r.ctx, 1<<62); err == nil {
+		return fmt.Errorf("GetWebhookDelivery found a missing delivery")
+	}
+
+	if err := r.db.DeactivateWebhookSubscription(r.ctx, subscription.ID); err != nil {
+		return fmt.Errorf("DeactivateWebhookSubscription: %v", err)
+	}
+	if err := r.db.DeactivateWebhookSubscription(r.ctx, subscription.ID); err == nil {
+		return fmt.Errorf("DeactivateWebhookSubscription deactivated a subscription twice")
+	}
+	all, err := r.db.GetWebhookSubscriptions(r.ctx, merchant, false)
+	if err != nil {
+		return fmt.Errorf("GetWebhookSubscriptions: %v", err)
+	}
+	active, err := r.db.GetWebhookSubscriptions(r.ctx, merchant, true)
+	if err != nil {
+		return fmt.Errorf("GetWebhookSubscriptions: %v", err)
+	}
+	return expect(len(all) == 1 && !all[0].Active && len(active) == 0,
+		"GetWebhookSubscriptions returned %d subscriptions and %d active ones, want 1 inactive", len(all), len(active))
+}
+
+func checkExports(r *run) error {
+	user, err := r.newUser()
+	if err != nil {
+		return err
+	}
+	first, err := r.earn(user.ID, 10, "conformance-a", r.now.AddDate(0, 0, -2))
+	if err != nil {
+		return err
+	}
+	if _, err := r.earn(user.ID, 20, "conformance-b", r.now.AddDate(0, 0, -1)); err != nil {
+		return err
+	}
+
+	var txns []models.Transaction
+	err = r.db.StreamTransactions(r.ctx, models.PointsHistoryRequest{UserID: user.ID}, func(txn models.Transaction) error {
+		txns = append(txns, txn)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("StreamTransactions: %v", err)
+	}
+	var byCategory []models.Transaction
+	err = r.db.StreamTransactions(r.ctx, models.PointsHistoryRequest{UserID: user.ID, TransactionType: "conformance-a"}, func(txn models.Transaction) error {
+		byCategory = append(byCategory, txn)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("StreamTransactions: %v", err)
+	}
+	if err := expect(len(txns) == 2 && txns[0].TransactionID == first.TransactionID && len(byCategory) == 1 && byCategory[0].TransactionID == first.TransactionID,
+		"StreamTransactions returned %d rows and %d of one category", len(txns), len(byCategory)); err != nil {
+		return err
+	}
+
+	var history []models.PointsHistory
+	err = r.db.StreamPointsHistory(r.ctx, models.PointsHistoryRequest{UserID: user.ID, TransactionType: "earn"}, func(entry models.PointsHistory) error {
+		history = append(history, entry)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("StreamPointsHistory: %v", err)
+	}
+	if err := expect(len(history) == 2 && history[0].UserID == user.ID && history[0].Points == first.PointsEarned,
+		"StreamPointsHistory returned %+v", history); err != nil {
+		return err
+	}
+
+	stop := errors.New("stop")
+	err = r.db.StreamPointsHistory(r.ctx, models.PointsHistoryRequest{UserID: user.ID}, func(models.PointsHistory) error { return stop })
+	return expect(err == stop, "StreamPointsHistory returned %v instead of the callback's error", err)
+}
+
+func checkAudit(r *run) error {
+	actor := r.name("conformance-actor")
+	audited := r.db.WithAuditMeta(models.AuditMeta{Actor: actor, RequestID: r.id})
+	scoped := &run{ctx: r.ctx, db: audited, id: r.id + "-audit", now: r.now}
+	user, err := scoped.newUser()
+	if err != nil {
+		return err
+	}
+	if _, err := scoped.earn(user.ID, 10, "conformance", r.now); err != nil {
+		return err
+	}
+
+	events, err := r.db.GetAuditEvents(r.ctx, models.AuditFilter{Actor: actor})
+	if err != nil {
+		return fmt.Errorf("GetAuditEvents: %v", err)
+	}
+	actions := []string{}
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	if err := expect(fmt.Sprint(actions) == fmt.Sprint([]string{"user.create", "transaction.add", "points.earn"}),
+		"GetAuditEvents of the actor returned %v", actions); err != nil {
+		return err
+	}
+	if err := expect(events[0].TargetID == fmt.Sprint(user.ID) && events[0].RequestID == r.id && events[0].UserID == user.ID && events[0].Hash != "",
+		"GetAuditEvents returned %+v", events[0]); err != nil {
+		return err
+	}
+
+	page, err := r.db.GetAuditEvents(r.ctx, models.AuditFilter{Actor: actor, Page: 2, PageSize: 2})
+	if err != nil {
+		return fmt.Errorf("GetAuditEvents: %v", err)
+	}
+	byAction, err := r.db.GetAuditEvents(r.ctx, models.AuditFilter{Actor: actor, Action: "points.earn"})
+	if err != nil {
+		return fmt.Errorf("GetAuditEvents: %v", err)
+	}
+	if err := first(
+		expect(len(page) == 1 && page[0].Action == "points.earn", "GetAuditEvents page 2 returned %d events", len(page)),
+		expect(len(byAction) == 1, "GetAuditEvents by action returned %d events", len(byAction)),
+	); err != nil {
+		return err
+	}
+
+	verification, err := r.db.VerifyAuditChain(r.ctx)
+	if err != nil {
+		return fmt.Errorf("VerifyAuditChain: %v", err)
+	}
+	return expect(verification.Valid && verification.EventsChecked >= 3, "VerifyAuditChain returned %+v", verification)
+}
+
+func checkLocks(r *run) error {
+	ctx := r.ctx
+	name := r.name("conformance-lock")
+	holder, other := r.db.NewLocker(name), r.db.NewLocker(name)
+
+	acquired, err := holder.TryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("TryLock: %v", err)
+	}
+	again, err := holder.TryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("TryLock: %v", err)
+	}
+	contended, err := other.TryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("TryLock: %v", err)
+	}
+	if err := first(
+		expect(acquired && again, "TryLock did not take a free lock"),
+		expect(!contended, "TryLock took a lock that is held"),
+		expect(holder.Check(ctx) == nil, "Check failed for the holder"),
+		expect(other.Check(ctx) != nil, "Check passed for a locker that does not hold the lock"),
+	); err != nil {
+		return err
+	}
+
+	if err := holder.Unlock(ctx); err != nil {
+		return fmt.Errorf("Unlock: %v", err)
+	}
+	acquired, err = other.TryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("TryLock: %v", err)
+	}
+	defer other.Unlock(ctx)
+	return expect(acquired, "TryLock did not take a released lock")
+}
+
+func transactionIDs(candidates []models.ExpiryCandidate) string {
+	ids := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.TransactionID)
+	}
+	return fmt.Sprint(ids)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDelivery(deliveries []models.WebhookDelivery, id int64) bool {
+	for _, d := range deliveries {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/dbtest"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+type check struct {
+	name string
+	run  func(r *run) error
+}
+
+var checks = []check{
+	{"users", checkUsers},
+	{"transactions", checkTransactions},
+	{"transactions-batch", checkBatch},
+	{"redeem", checkRedeem},
+	{"ledger", checkLedger},
+	{"reconciliation", checkReconciliation},
+	{"expiry", checkExpiry},
+	{"expiry-checkpoints", checkCheckpoints},
+	{"expiry-warnings", checkWarnings},
+	{"account-closure", checkAccountClosure},
+	{"outbox", checkOutbox},
+	{"notifications", checkNotifications},
+	{"webhooks", checkWebhooks},
+	{"exports", checkExports},
+	{"audit", checkAudit},
+	{"locks", checkLocks},
+}
+
+// run is the state shared by the checks of one target
+type run struct {
+	ctx   context.Context
+	db    database.Database
+	id    string
+	users int
+	// now is truncated to the second so dates survive any backend unchanged
+	now time.Time
+}
+
+// TestConformance runs every check against each of dbtest.Targets, a failing check does not stop
+// the others
+func TestConformance(t *testing.T) {
+	for _, target := range dbtest.Targets {
+		t.Run(target.Name, func(t *testing.T) {
+			r := &run{
+				ctx: context.Background(),
+				db:  target.Open(t),
+				id:  strconv.FormatInt(time.Now().UnixNano(), 36),
+				now: time.Now().UTC().Truncate(time.Second),
+			}
+			for _, c := range checks {
+				t.Run(c.name, func(t *testing.T) {
+					if err := r.try(c); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+		})
+	}
+}
+
+// try runs a check, turning a panic into a failure so the other checks still run
+func (r *run) try(c check) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return c.run(r)
+}
+
+// name returns a name no other run uses
+func (r *run) name(prefix string) string {
+	return fmt.Sprintf("%s-%s", prefix, r.id)
+}
+
+func (r *run) newUser() (*models.User, error) {
+	r.users++
+	username := fmt.Sprintf("conformance-%s-%d", r.id, r.users)
+	user, err := r.db.CreateUser(r.ctx, &models.User{Username: username, Email: username + "@example.com", UserPassword: "hash"})
+	if err != nil {
+		return nil, fmt.Errorf("CreateUser: %v", err)
+	}
+	return user, nil
+}
+
+func (r *run) earn(userID int, amount float64, category string, date time.Time) (*models.Transaction, error) {
+	txn, err := r.db.AddTransaction(r.ctx, &models.Transaction{UserID: userID, TransactionAmount: amount, Category: category, TransactionDate: date})
+	if err != nil {
+		return nil, fmt.Errorf("AddTransaction: %v", err)
+	}
+	return txn, nil
+}
+
+// points is what a purchase earns, by the same multipliers the database applies
+func points(amount float64, category string) int {
+	return int(amount) * utils.GetCategoryMultiplier(category)
+}
+
+// expect returns an error describing the failure unless ok
+func expect(ok bool, format string, args ...interface{}) error {
+	if ok {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// first returns the first non nil error
+func first(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package conformance checks that an implementation of database.Database behaves like the others:
+// the same errors, ordering, pagination and filtering. It can run against a database that already
+// holds data, everything a run creates is named after the run and only those rows are looked at.
+package conformance
@@ -1,34 +1,129 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/lakshay88/reward-management-system/database/models"
 )
 
+// ErrDuplicateTransaction is returned when a transaction ID was already recorded
+var ErrDuplicateTransaction = errors.New("transaction already recorded")
+
+// ErrTimeout is wrapped by the error of a database call that ran past its timeout
+var ErrTimeout = errors.New("database operation timed out")
+
+// ErrNoPointsBalance is wrapped by the error of reading the balance of a user who never earned points
+var ErrNoPointsBalance = errors.New("no points balance")
+
+// ErrInsufficientPoints is returned when a redemption asks for more points than the balance holds
+var ErrInsufficientPoints = errors.New("Insufficient points for redemption")
+
+// ErrBalanceChanged is returned when a balance is no longer what a correction computed it from
+var ErrBalanceChanged = errors.New("points balance changed since it was read")
+
+// Locker is a named lock shared by every process using the same database. It is held until
+// Unlock or until the process holding it dies, so a crashed holder never blocks the others.
+type Locker interface {
+	// TryLock takes the lock without waiting, reporting whether it was acquired
+	TryLock(ctx context.Context) (bool, error)
+	// Check returns an error once a held lock can no longer be guaranteed, for example when
+	// the connection holding it was lost
+	Check(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// Database is the data layer. A method taking a context stops its queries and returns once the
+// context is done, the transactions it started are rolled back.
 type Database interface {
 	// implement Database methods
 
 	// User Functions
-	CreateUser(*models.User) (*models.User, error)
-	GetUserByID(int, *models.User) (*models.User, error)
-	GetUserByEmail(string, *models.User) (*models.User, error)
+	CreateUser(context.Context, *models.User) (*models.User, error)
+	GetUserByID(context.Context, int, *models.User) (*models.User, error)
+	GetUserByEmail(context.Context, string, *models.User) (*models.User, error)
+	UpdateUserProfile(context.Context, *models.User) (*models.User, string, error)
+	VerifyUserEmail(context.Context, string) (*models.User, error)
+	UpdateUserPassword(context.Context, int, string) error
+	CloseUserAccount(context.Context, int, string, float64) (*models.AccountClosure, error)
+	SetUserTier(context.Context, int, string) (string, error)
 
 	// Add Transaction
-	AddTransaction(*models.Transaction) (*models.Transaction, error)
+	AddTransaction(context.Context, *models.Transaction) (*models.Transaction, error)
+	AddTransactionsBatch(context.Context, []models.Transaction) ([]models.BatchTransactionResult, error)
+	GetTransactionsByUser(context.Context, int, int, int) ([]models.Transaction, error)
 
 	// Points Balance
-	GetPointsBalance(int) (models.PointsBalance, error)
-	GetPointsHistory(int, int, int, string, string, string) ([]models.PointsHistory, error)
+	GetPointsBalance(context.Context, int) (models.PointsBalance, error)
+	GetPointsHistory(context.Context, int, int, int, string, string, string) ([]models.PointsHistory, error)
+
+	// Exports, rows are passed to the callback one at a time as they are read
+	StreamPointsHistory(context.Context, models.PointsHistoryRequest, func(models.PointsHistory) error) error
+	StreamTransactions(context.Context, models.PointsHistoryRequest, func(models.Transaction) error) error
 
 	// Reward redeem
-	GetAvailablePoints(int) (int, error)
-	DeductPoints(int, int) (int, error)
-	LogPointsHistory(int, int, string, string) error
+	DeductPoints(context.Context, int, int) (int, error)
+	LogPointsHistory(context.Context, int, int, string, string) error
+
+	// Exprite, in pages with the job's checkpoint saved alongside each batch
+	GetExpiryCandidates(context.Context, int, time.Time, time.Time, time.Time, int, int) ([]models.ExpiryCandidate, error)
+	ExpireTransactions(context.Context, []models.ExpiryCandidate, models.JobCheckpoint) (int, int, error)
+	ExpirePoints(context.Context, int, string, int, time.Time) error
+
+	// Job checkpoints
+	GetJobCheckpoint(context.Context, string) (*models.JobCheckpoint, error)
+	SaveJobCheckpoint(context.Context, models.JobCheckpoint) error
+
+	// Ledger
+	GetPointsEvents(context.Context, int) ([]models.PointsEvent, error)
+	ListLedgerUserIDs(context.Context) ([]int, error)
+	SetPointsBalance(context.Context, int, models.PointsBalance, int64, models.PointsBalance) error
+	AdjustPoints(context.Context, int, int, string) (models.PointsBalance, error)
+	RefundTransaction(context.Context, string, string) (*models.PointsEvent, error)
+
+	// Reconciliation
+	GetBalanceSources(context.Context) ([]models.BalanceSources, error)
+	ApplyReconciliationCorrection(context.Context, int, models.PointsBalance, models.PointsBalance, string) error
+
+	// Outbox
+	ClaimOutboxEvents(context.Context, int, time.Duration) ([]models.OutboxEvent, error)
+	MarkOutboxEventDelivered(context.Context, int64, string) error
+	MarkOutboxEventPublished(context.Context, int64) error
+	MarkOutboxEventFailed(context.Context, int64, string, int) (bool, error)
+
+	// Expiry warnings
+	RecordExpiryWarnings(context.Context, []models.ExpiryWarning) (int, error)
+	GetPendingExpiryWarnings(context.Context, int) ([]models.ExpiryWarning, error)
+	MarkExpiryWarningsNotified(context.Context, []int64) error
+
+	// Notifications
+	GetNotificationSettings(context.Context, int) (models.NotificationSettings, error)
+	GetNotificationPreferences(context.Context, int) ([]models.NotificationPreference, error)
+	UpdateNotificationPreferences(context.Context, models.NotificationSettings, []models.NotificationPreference) error
+	LogNotificationDelivery(context.Context, models.NotificationDelivery) error
+	GetNotificationDeliveries(context.Context, int, int, int) ([]models.NotificationDelivery, error)
+
+	// Distributed locks
+	NewLocker(string) Locker
+
+	// Webhooks
+	CreateWebhookSubscription(context.Context, *models.WebhookSubscription) (*models.WebhookSubscription, error)
+	GetWebhookSubscriptions(context.Context, string, bool) ([]models.WebhookSubscription, error)
+	GetWebhookSubscription(context.Context, int) (*models.WebhookSubscription, error)
+	DeactivateWebhookSubscription(context.Context, int) error
+	CreateWebhookDeliveries(context.Context, models.DomainEvent, []int) error
+	ClaimDueWebhookDeliveries(context.Context, int, time.Duration) ([]models.WebhookDelivery, error)
+	GetWebhookDeliveries(context.Context, int, int, int) ([]models.WebhookDelivery, error)
+	GetWebhookDelivery(context.Context, int64) (*models.WebhookDelivery, error)
+	RecordWebhookAttempt(context.Context, *models.WebhookDelivery, models.WebhookDeliveryAttempt) error
+	GetWebhookDeliveryAttempts(context.Context, int64) ([]models.WebhookDeliveryAttempt, error)
+	RedeliverWebhook(context.Context, int64) error
 
-	// Exprite
-	TransactionOlderThanGivenTime(time.Time) ([]models.Transaction, error)
-	ExpirePoints(int, string, int, time.Time) error
+	// Audit
+	WithAuditMeta(models.AuditMeta) Database
+	GetAuditEvents(context.Context, models.AuditFilter) ([]models.AuditEvent, error)
+	VerifyAuditChain(context.Context) (*models.AuditVerification, error)
 
 	Close() error
 }
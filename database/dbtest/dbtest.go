@@ -0,0 +1,101 @@
+// Package dbtest opens throwaway databases for the tests and benchmarks of other packages, each one
+// migrated to the latest schema and closed when the test ends.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+)
+
+// PostgresEnv names the environment variable holding the connection settings of a Postgres
+// database the tests may write to, as space separated key=value pairs such as
+// "host=localhost port=5432 user=rewards password=secret dbname=rewards_test sslmode=disable".
+// Postgres tests are skipped while it is unset.
+const PostgresEnv = "RMS_TEST_POSTGRES"
+
+// Target is a database a test runs against, named for subtests
+type Target struct {
+	Name string
+	Open func(tb testing.TB) database.Database
+}
+
+// Targets are the in-memory database, a SQLite file and Postgres when PostgresEnv is set
+var Targets = []Target{
+	{"memory", Memory},
+	{"sqlite", SQLite},
+	{"postgres", Postgres},
+}
+
+// Memory returns a fresh in-memory database
+func Memory(tb testing.TB) database.Database {
+	db := database.NewMemoryDB()
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// SQLite returns a database in a new SQLite file under the test's temporary directory
+func SQLite(tb testing.TB) database.Database {
+	tb.Helper()
+	db, err := database.ConnectionToSQLite(config.DatabaseConfig{Driver: "sqlite", Path: filepath.Join(tb.TempDir(), "rewards.db")})
+	if err != nil {
+		tb.Fatalf("Failed to open sqlite database: %v", err)
+	}
+	return migrated(tb, db)
+}
+
+// Postgres returns the database named by PostgresEnv, skipping the test when it is unset. The
+// database is shared by every test that asks for it, tests must only look at rows they created.
+func Postgres(tb testing.TB) database.Database {
+	tb.Helper()
+	settings := os.Getenv(PostgresEnv)
+	if settings == "" {
+		tb.Skipf("%s is not set", PostgresEnv)
+	}
+
+	cfg := config.DatabaseConfig{Driver: "postgres", Port: 5432, SSLMode: "disable"}
+	for _, pair := range strings.Fields(settings) {
+		key, value, _ := strings.Cut(pair, "=")
+		switch key {
+		case "host":
+			cfg.Host = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				tb.Fatalf("Invalid port %q in %s", value, PostgresEnv)
+			}
+			cfg.Port = port
+		case "user":
+			cfg.User = value
+		case "password":
+			cfg.Password = value
+		case "dbname":
+			cfg.DBName = value
+		case "sslmode":
+			cfg.SSLMode = value
+		default:
+			tb.Fatalf("Unknown setting %q in %s", key, PostgresEnv)
+		}
+	}
+
+	db, err := database.ConnectionToPostgres(cfg)
+	if err != nil {
+		tb.Fatalf("Failed to open postgres database: %v", err)
+	}
+	return migrated(tb, db)
+}
+
+func migrated(tb testing.TB, db database.Database) database.Database {
+	tb.Helper()
+	tb.Cleanup(func() { db.Close() })
+	if err := database.CheckSchema(context.Background(), db, "up"); err != nil {
+		tb.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
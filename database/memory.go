@@ -0,0 +1,629 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// MemoryDB is a Database held in process memory, for tests and demos. Every method holds the
+// store's lock for its whole run, which makes it as atomic as a PostgresDB transaction, and writes
+// validate everything before changing anything so a rejected write leaves the store untouched.
+// Nothing survives a restart. Calls never wait on anything, so only the streams, which call back
+// into the caller, stop early when their context is done.
+type MemoryDB struct {
+	store *memoryStore
+	audit models.AuditMeta
+}
+
+// memoryStore holds the rows of every table, slices are in id order and ids start at 1
+type memoryStore struct {
+	mu sync.Mutex
+
+	users          []*memoryUser
+	transactions   []*memoryTransaction
+	transactionIDs map[string]*memoryTransaction
+	balances       map[int]models.PointsBalance
+	history        []models.PointsHistory
+	events         []models.PointsEvent
+	outbox         []*memoryOutboxEvent
+	checkpoints    map[string]models.JobCheckpoint
+	warnings       []*models.ExpiryWarning
+
+	notificationSettings    map[int]models.NotificationSettings
+	notificationPreferences map[memoryPreferenceKey]models.NotificationPreference
+	notificationDeliveries  []models.NotificationDelivery
+
+	subscriptions   []*models.WebhookSubscription
+	deliveries      []*models.WebhookDelivery
+	deliveryAttempt []models.WebhookDeliveryAttempt
+
+	auditLog []models.AuditEvent
+	locks    map[string]*MemoryLocker
+}
+
+type memoryUser struct {
+	models.User
+	verificationToken string
+}
+
+type memoryTransaction struct {
+	models.Transaction
+	refundedOn *time.Time
+	expiredOn  *time.Time
+}
+
+// NewMemoryDB returns an empty in-memory database
+func NewMemoryDB() Database {
+	return &MemoryDB{store: &memoryStore{
+		transactionIDs:          map[string]*memoryTransaction{},
+		balances:                map[int]models.PointsBalance{},
+		checkpoints:             map[string]models.JobCheckpoint{},
+		notificationSettings:    map[int]models.NotificationSettings{},
+		notificationPreferences: map[memoryPreferenceKey]models.NotificationPreference{},
+		locks:                   map[string]*MemoryLocker{},
+	}}
+}
+
+func (db *MemoryDB) Close() error {
+	return nil
+}
+
+// memoryNow is the current time at the precision Postgres keeps
+func memoryNow() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// memoryPage returns the bounds of a LIMIT/OFFSET page of n rows, rejecting what Postgres rejects
+func memoryPage(n, limit, offset int) (int, int, error) {
+	if limit < 0 {
+		return 0, 0, fmt.Errorf("LIMIT must not be negative")
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("OFFSET must not be negative")
+	}
+	start, end := offset, offset+limit
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end, nil
+}
+
+// parseTimestamp reads a date filter the way Postgres casts a string to a timestamp
+func parseTimestamp(value string) (time.Time, error) {
+	layouts := []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04:05.999999", time.RFC3339Nano}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid input syntax for type timestamp: %q", value)
+}
+
+// timeRange parses optional start and end date filters, a zero bound is open
+func timeRange(startDate, endDate string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if startDate != "" {
+		if start, err = parseTimestamp(startDate); err != nil {
+			return start, end, err
+		}
+	}
+	if endDate != "" {
+		if end, err = parseTimestamp(endDate); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+func inTimeRange(t, start, end time.Time) bool {
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+}
+
+// user returns the user with the given id, nil when there is none
+func (s *memoryStore) user(id int) *memoryUser {
+	if id < 1 || id > len(s.users) {
+		return nil
+	}
+	return s.users[id-1]
+}
+
+func (s *memoryStore) openUser(id int) bool {
+	u := s.user(id)
+	return u != nil && u.ClosedOn == nil
+}
+
+// touchActivity is the in-memory touchActivity, the clock never moves backwards nor past now
+func (s *memoryStore) touchActivity(userID int, at time.Time) {
+	u := s.user(userID)
+	if u == nil {
+		return
+	}
+	if now := memoryNow(); at.After(now) {
+		at = now
+	}
+	if u.LastActivityOn == nil || at.After(*u.LastActivityOn) {
+		at := at
+		u.LastActivityOn = &at
+	}
+}
+
+func (s *memoryStore) logPointsHistory(userID int, transactionID string, points int, pointsType string, reason string) {
+	s.history = append(s.history, models.PointsHistory{
+		UserID:        userID,
+		TransactionID: transactionID,
+		Points:        points,
+		PointsType:    pointsType,
+		Reason:        reason,
+		Date:          memoryNow(),
+	})
+}
+
+// errNoUser is what a write referencing an unknown user fails with, like a foreign key violation
+func errNoUser(userID int) error {
+	return fmt.Errorf("user %d does not exist", userID)
+}
+
+func (db *MemoryDB) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == user.Username {
+			return nil, fmt.Errorf(`duplicate key value violates unique constraint "users_username_key"`)
+		}
+		if u.Email == user.Email {
+			return nil, fmt.Errorf(`duplicate key value violates unique constraint "users_email_key"`)
+		}
+	}
+
+	if user.Tier == "" {
+		user.Tier = "standard"
+	}
+	user.ID = len(s.users) + 1
+	user.CreatedOn = memoryNow()
+	stored := &memoryUser{User: models.User{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		UserPassword: user.UserPassword,
+		Tier:         user.Tier,
+		CreatedOn:    user.CreatedOn,
+	}}
+
+	err := db.recordAudit("user.create", "user", user.ID, user.ID, nil,
+		map[string]interface{}{"tier": user.Tier})
+	if err != nil {
+		return nil, err
+	}
+	s.users = append(s.users, stored)
+
+	// empty user
+	user.UserPassword = ""
+
+	return user, nil
+}
+
+func (db *MemoryDB) GetUserByID(ctx context.Context, userId int, user *models.User) (*models.User, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Handling Nil
+	if user == nil {
+		user = &models.User{}
+	}
+
+	u := s.user(userId)
+	if u == nil {
+		return nil, fmt.Errorf("User with ID %d not found", userId)
+	}
+	user.ID, user.Username, user.Email, user.PendingEmail, user.Tier = u.ID, u.Username, u.Email, u.PendingEmail, u.Tier
+	user.LastActivityOn, user.ClosedOn, user.CreatedOn = u.LastActivityOn, u.ClosedOn, u.CreatedOn
+	return user, nil
+}
+
+func (db *MemoryDB) GetUserByEmail(ctx context.Context, userEmail string, user *models.User) (*models.User, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Handling Nil
+	if user == nil {
+		user = &models.User{}
+	}
+
+	for _, u := range s.users {
+		if u.Email == userEmail && u.ClosedOn == nil {
+			user.ID, user.Username, user.Email, user.UserPassword, user.CreatedOn = u.ID, u.Username, u.Email, u.UserPassword, u.CreatedOn
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("User with Email %s not found", userEmail)
+}
+
+// UpdateUserProfile changes the username right away, an email change is parked in pending_email
+// until it is confirmed with the returned verification token.
+func (db *MemoryDB) UpdateUserProfile(ctx context.Context, user *models.User) (*models.User, string, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.user(user.ID)
+	if u == nil {
+		return nil, "", fmt.Errorf("User with ID %d not found", user.ID)
+	}
+	if u.ClosedOn != nil {
+		return nil, "", fmt.Errorf("User with ID %d is closed", user.ID)
+	}
+	current := models.User{ID: u.ID, Username: u.Username, Email: u.Email, PendingEmail: u.PendingEmail}
+	changeUsername := user.Username != "" && user.Username != current.Username
+	if changeUsername {
+		for _, other := range s.users {
+			if other.Username == user.Username {
+				return nil, "", fmt.Errorf(`Failed to update username: duplicate key value violates unique constraint "users_username_key"`)
+			}
+		}
+		current.Username = user.Username
+	}
+
+	var verificationToken string
+	emailChangeRequested := user.Email != "" && user.Email != current.Email
+	if emailChangeRequested {
+		// another user's unverified change claims the address as well
+		for _, other := range s.users {
+			if other.ID != user.ID && (other.Email == user.Email || other.PendingEmail == user.Email) {
+				return nil, "", fmt.Errorf("Email %s is already in use", user.Email)
+			}
+		}
+		verificationToken = strings.ReplaceAll(uuid.New().String(), "-", "")
+		current.PendingEmail = user.Email
+	}
+
+	if err := db.recordAudit("user.update_profile", "user", user.ID, user.ID, nil, auditProfileChange(changeUsername, emailChangeRequested)); err != nil {
+		return nil, "", err
+	}
+	u.Username, u.PendingEmail = current.Username, current.PendingEmail
+	if verificationToken != "" {
+		u.verificationToken = verificationToken
+	}
+	return &current, verificationToken, nil
+}
+
+// VerifyUserEmail swaps the pending email in once its verification token is presented
+func (db *MemoryDB) VerifyUserEmail(ctx context.Context, token string) (*models.User, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if token == "" || u.verificationToken != token || u.PendingEmail == "" || u.ClosedOn != nil {
+			continue
+		}
+
+		for _, other := range s.users {
+			if other.ID != u.ID && other.Email == u.PendingEmail {
+				return nil, fmt.Errorf("Email is already in use")
+			}
+		}
+
+		if err := db.recordAudit("user.verify_email", "user", u.ID, u.ID, nil, nil); err != nil {
+			return nil, err
+		}
+		u.Email, u.PendingEmail, u.verificationToken = u.PendingEmail, "", ""
+		return &models.User{ID: u.ID, Username: u.Username, Email: u.Email, CreatedOn: u.CreatedOn}, nil
+	}
+	return nil, fmt.Errorf("Invalid or expired verification token")
+}
+
+func (db *MemoryDB) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.openUser(userID) {
+		return fmt.Errorf("User with ID %d not found", userID)
+	}
+
+	// password hashes are never copied into the audit log
+	if err := db.recordAudit("user.change_password", "user", userID, userID, nil, nil); err != nil {
+		return err
+	}
+	s.user(userID).UserPassword = hashedPassword
+	return nil
+}
+
+// SetUserTier moves an open account to another tier and returns the tier it was in
+func (db *MemoryDB) SetUserTier(ctx context.Context, userID int, tier string) (string, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.user(userID)
+	if u == nil {
+		return "", fmt.Errorf("User with ID %d not found", userID)
+	}
+	if u.ClosedOn != nil {
+		return "", fmt.Errorf("User with ID %d is closed", userID)
+	}
+	previous := u.Tier
+	if previous == tier {
+		return previous, nil
+	}
+
+	err := db.recordAudit("user.tier", "user", userID, userID,
+		map[string]string{"tier": previous}, map[string]string{"tier": tier})
+	if err != nil {
+		return "", err
+	}
+	u.Tier = tier
+	return previous, nil
+}
+
+// CloseUserAccount settles the remaining points per policy and anonymizes the user's PII.
+// Transactions and points history are kept so the ledger stays intact.
+func (db *MemoryDB) CloseUserAccount(ctx context.Context, userID int, policy string, cashOutRate float64) (*models.AccountClosure, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closure := &models.AccountClosure{UserID: userID, Policy: policy}
+	u := s.user(userID)
+	if u == nil {
+		return nil, fmt.Errorf("User with ID %d not found", userID)
+	}
+	if u.ClosedOn != nil {
+		return nil, fmt.Errorf("User with ID %d is already closed", userID)
+	}
+
+	balance := s.balances[userID]
+	remainingPoints := balance.TotalPoints
+	if remainingPoints > 0 && policy != "cashout" && policy != "forfeit" {
+		return nil, fmt.Errorf("Unknown account closure policy %q", policy)
+	}
+
+	if remainingPoints > 0 {
+		after := balance
+		after.TotalPoints = 0
+		if policy == "cashout" {
+			after.PointsRedeemed += remainingPoints
+		}
+		s.balances[userID] = after
+
+		if policy == "cashout" {
+			s.appendPointsEvent(userID, models.PointsEventRedeemed, remainingPoints, "", "Points cashed out on account closure")
+			s.logPointsHistory(userID, "", remainingPoints, "redeem", "Points cashed out on account closure")
+			closure.CashOutAmount = float64(remainingPoints) * cashOutRate
+		} else {
+			s.appendPointsEvent(userID, models.PointsEventAdjusted, -remainingPoints, "", "Points forfeited on account closure")
+			s.logPointsHistory(userID, "", remainingPoints, "forfeit", "Points forfeited on account closure")
+		}
+		if err := db.recordAudit("points.settle_on_closure", "points_balance", userID, userID, balance, after); err != nil {
+			return nil, err
+		}
+		closure.PointsSettled = remainingPoints
+	}
+
+	closure.ClosedOn = memoryNow()
+	closedOn := closure.ClosedOn
+	u.Username = fmt.Sprintf("deleted-user-%d", userID)
+	u.Email = fmt.Sprintf("deleted-user-%d@closed.invalid", userID)
+	u.UserPassword, u.PendingEmail, u.verificationToken = "", "", ""
+	u.ClosedOn = &closedOn
+
+	// the audit entry records the closure, not the PII that was just removed
+	if err := db.recordAudit("user.close", "user", userID, userID, nil, closure); err != nil {
+		return nil, err
+	}
+	return closure, nil
+}
+
+func (db *MemoryDB) AddTransaction(ctx context.Context, txn *models.Transaction) (*models.Transaction, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Handling Nil
+	if txn == nil {
+		txn = &models.Transaction{}
+	}
+
+	if !s.openUser(txn.UserID) {
+		return nil, fmt.Errorf("User with ID %d does not exist", txn.UserID)
+	}
+
+	// A caller supplied transaction ID makes the insert idempotent
+	if txn.TransactionID == "" {
+		txn.TransactionID = uuid.New().String()
+	} else if s.transactionIDs[txn.TransactionID] != nil {
+		return nil, ErrDuplicateTransaction
+	}
+	if txn.TransactionDate.IsZero() {
+		txn.TransactionDate = memoryNow()
+	}
+
+	// Points Calculation
+	pointsEarned := int(txn.TransactionAmount) * utils.GetCategoryMultiplier(txn.Category)
+
+	stored := &memoryTransaction{Transaction: *txn}
+	stored.ID = len(s.transactions) + 1
+	stored.PointsEarned = pointsEarned
+	stored.CreatedOn = memoryNow()
+	s.transactions = append(s.transactions, stored)
+	s.transactionIDs[stored.TransactionID] = stored
+
+	before := s.balances[txn.UserID]
+	after := before
+	after.TotalPoints += pointsEarned
+	s.balances[txn.UserID] = after
+
+	s.appendPointsEvent(txn.UserID, models.PointsEventEarned, pointsEarned, txn.TransactionID, "Points earned for transaction")
+	s.touchActivity(txn.UserID, txn.TransactionDate)
+	s.logPointsHistory(txn.UserID, txn.TransactionID, pointsEarned, "earn", "Points earned for transaction")
+
+	err := db.recordAudit("transaction.add", "transaction", txn.TransactionID, txn.UserID, nil, map[string]interface{}{
+		"transaction_amount": txn.TransactionAmount,
+		"category":           txn.Category,
+		"product_code":       txn.ProductCode,
+		"points_earned":      pointsEarned,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.recordAudit("points.earn", "points_balance", txn.UserID, txn.UserID, before, after); err != nil {
+		return nil, err
+	}
+
+	txn.ID = stored.ID
+	txn.PointsEarned = pointsEarned
+	return txn, nil
+}
+
+func (db *MemoryDB) GetTransactionsByUser(ctx context.Context, userID, page, limit int) ([]models.Transaction, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []models.Transaction
+	for _, txn := range s.transactions {
+		if txn.UserID == userID {
+			matching = append(matching, txn.Transaction)
+		}
+	}
+
+	start, end, err := memoryPage(len(matching), limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch transactions: %v", err)
+	}
+	if start == end {
+		return nil, nil
+	}
+	return matching[start:end], nil
+}
+
+func (db *MemoryDB) GetPointsBalance(ctx context.Context, userID int) (models.PointsBalance, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, exists := s.balances[userID]
+	if !exists {
+		return balance, fmt.Errorf("User with ID %d has %w", userID, ErrNoPointsBalance)
+	}
+	return balance, nil
+}
+
+func (db *MemoryDB) GetPointsHistory(ctx context.Context, userID, page, limit int, startDate, endDate, transactionType string) ([]models.PointsHistory, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start, end, err := timeRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []models.PointsHistory
+	for i := len(s.history) - 1; i >= 0; i-- {
+		entry := s.history[i]
+		if entry.UserID != userID || !inTimeRange(entry.Date, start, end) || (transactionType != "" && entry.PointsType != transactionType) {
+			continue
+		}
+		matching = append(matching, models.PointsHistory{Points: entry.Points, PointsType: entry.PointsType, Reason: entry.Reason, Date: entry.Date})
+	}
+	// newest first, entries written in the same instant keep the latest first
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].Date.After(matching[j].Date) })
+
+	from, to, err := memoryPage(len(matching), limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		return nil, nil
+	}
+	return matching[from:to], nil
+}
+
+func (db *MemoryDB) DeductPoints(ctx context.Context, userID int, pointsToRedeem int) (int, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, exists := s.balances[userID]
+	if !exists {
+		return 0, fmt.Errorf("User with ID %d has %w", userID, ErrNoPointsBalance)
+	}
+	if before.TotalPoints < pointsToRedeem {
+		return 0, ErrInsufficientPoints
+	}
+
+	after := models.PointsBalance{TotalPoints: before.TotalPoints - pointsToRedeem, PointsRedeemed: before.PointsRedeemed + pointsToRedeem}
+	s.balances[userID] = after
+	s.appendPointsEvent(userID, models.PointsEventRedeemed, pointsToRedeem, "", "Points redeemed for discount")
+	s.logPointsHistory(userID, "", pointsToRedeem, "redeem", "Points redeemed for discount")
+	s.touchActivity(userID, memoryNow())
+
+	if err := db.recordAudit("points.redeem", "points_balance", userID, userID, before, after); err != nil {
+		return 0, err
+	}
+	return after.TotalPoints, nil
+}
+
+func (db *MemoryDB) LogPointsHistory(ctx context.Context, userID int, points int, pointsType string, reason string) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user(userID) == nil {
+		return fmt.Errorf("Failed to log points history: %v", errNoUser(userID))
+	}
+
+	s.logPointsHistory(userID, "", points, pointsType, reason)
+	return db.recordAudit("points_history.log", "points_history", userID, userID, nil, map[string]interface{}{
+		"points":      points,
+		"points_type": pointsType,
+		"reason":      reason,
+	})
+}
+
+func (db *MemoryDB) ExpirePoints(ctx context.Context, userId int, transactionID string, pointsEarned int, transactionDate time.Time) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a transaction is only ever expired once, whichever path gets to it first
+	txn := s.transactionIDs[transactionID]
+	if txn == nil || txn.expiredOn != nil {
+		return nil
+	}
+	now := memoryNow()
+	txn.expiredOn = &now
+
+	before, exists := s.balances[userId]
+	after := before
+	after.TotalPoints -= pointsEarned
+	if exists {
+		s.balances[userId] = after
+	}
+
+	s.appendPointsEvent(userId, models.PointsEventExpired, pointsEarned, transactionID, expiryReason)
+	s.logPointsHistory(userId, transactionID, pointsEarned, "expired", expiryReason)
+	if err := db.recordAudit("points.expire", "points_balance", userId, userId, before, after); err != nil {
+		return err
+	}
+
+	fmt.Printf("Expired %d points for user %d, transaction %s.\n", pointsEarned, userId, transactionID)
+	return nil
+}
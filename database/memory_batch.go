@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// AddTransactionsBatch records many transactions at once. Items for unknown users or already
+// recorded transaction IDs are reported and skipped.
+func (db *MemoryDB) AddTransactionsBatch(ctx context.Context, txns []models.Transaction) ([]models.BatchTransactionResult, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]models.BatchTransactionResult, len(txns))
+	if len(txns) == 0 {
+		return results, nil
+	}
+
+	now := memoryNow()
+	created := []int{}
+	seen := map[string]bool{}
+	for i := range txns {
+		txn := &txns[i]
+		results[i].Index = i
+
+		if !s.openUser(txn.UserID) {
+			results[i].Status = models.BatchItemInvalid
+			results[i].Error = fmt.Sprintf("User with ID %d does not exist", txn.UserID)
+			continue
+		}
+		if txn.TransactionID == "" {
+			txn.TransactionID = uuid.New().String()
+		} else if s.transactionIDs[txn.TransactionID] != nil || seen[txn.TransactionID] {
+			results[i].Status = models.BatchItemDuplicate
+			results[i].TransactionID = txn.TransactionID
+			continue
+		}
+		seen[txn.TransactionID] = true
+
+		if txn.TransactionDate.IsZero() {
+			txn.TransactionDate = now
+		}
+		txn.PointsEarned = int(txn.TransactionAmount) * utils.GetCategoryMultiplier(txn.Category)
+		created = append(created, i)
+	}
+	if len(created) == 0 {
+		return results, nil
+	}
+
+	before := map[int]models.PointsBalance{}
+	activity := map[int]time.Time{}
+	for _, i := range created {
+		txn := &txns[i]
+		if _, exists := before[txn.UserID]; !exists {
+			before[txn.UserID] = s.balances[txn.UserID]
+		}
+
+		stored := &memoryTransaction{Transaction: *txn}
+		stored.ID = len(s.transactions) + 1
+		stored.CreatedOn = now
+		s.transactions = append(s.transactions, stored)
+		s.transactionIDs[stored.TransactionID] = stored
+		txn.ID = stored.ID
+
+		balance := s.balances[txn.UserID]
+		balance.TotalPoints += txn.PointsEarned
+		s.balances[txn.UserID] = balance
+
+		s.history = append(s.history, models.PointsHistory{
+			UserID: txn.UserID, TransactionID: txn.TransactionID, Points: txn.PointsEarned, PointsType: "earn", Reason: earnReason, Date: now,
+		})
+		s.events = append(s.events, models.PointsEvent{
+			ID: int64(len(s.events) + 1), UserID: txn.UserID, EventType: models.PointsEventEarned, Points: txn.PointsEarned,
+			TransactionID: txn.TransactionID, Reason: earnReason, CreatedOn: now,
+		})
+		s.outbox = append(s.outbox, &memoryOutboxEvent{event: models.DomainEvent{
+			ID:            uuid.New().String(),
+			Type:          "points." + models.PointsEventEarned,
+			UserID:        txn.UserID,
+			Points:        txn.PointsEarned,
+			TransactionID: txn.TransactionID,
+			Merchant:      txn.Category,
+			Reason:        earnReason,
+			Balance:       balance,
+			OccurredOn:    now.UTC(),
+		}})
+
+		if txn.TransactionDate.After(activity[txn.UserID]) {
+			activity[txn.UserID] = txn.TransactionDate
+		}
+
+		results[i].Status = models.BatchItemCreated
+		results[i].TransactionID = txn.TransactionID
+		results[i].PointsEarned = txn.PointsEarned
+	}
+
+	for _, userID := range sortedKeys(activity) {
+		s.touchActivity(userID, activity[userID])
+	}
+	for _, userID := range sortedKeys(before) {
+		if before[userID] == s.balances[userID] {
+			continue
+		}
+		if err := db.recordAudit("points.earn_batch", "points_balance", userID, userID, before[userID], s.balances[userID]); err != nil {
+			return nil, err
+		}
+	}
+	err := db.recordAudit("transaction.add_batch", "transaction_batch", txns[created[0]].TransactionID, 0, nil, map[string]int{
+		"transactions": len(created),
+		"users":        len(before),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// GetExpiryCandidates returns up to limit earning transactions of open accounts, of one user or of
+// every user when userID is 0, whose points were neither expired nor refunded, in
+// (transaction_date, id) order after the given cursor. A transaction is returned when it was made
+// on or before cutoff, or on or before idleCutoff by a user idle since then; a zero cutoff
+// matches nothing.
+func (db *MemoryDB) GetExpiryCandidates(ctx context.Context, userID int, cutoff, idleCutoff time.Time, cursorDate time.Time, cursorID int, limit int) ([]models.ExpiryCandidate, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var candidates []models.ExpiryCandidate
+	for _, txn := range s.transactions {
+		u := s.user(txn.UserID)
+		if (userID != 0 && txn.UserID != userID) || u == nil || u.ClosedOn != nil ||
+			txn.expiredOn != nil || txn.refundedOn != nil || txn.PointsEarned <= 0 {
+			continue
+		}
+		if txn.TransactionDate.Before(cursorDate) || (txn.TransactionDate.Equal(cursorDate) && txn.ID <= cursorID) {
+			continue
+		}
+
+		lastActivity := u.CreatedOn
+		if u.LastActivityOn != nil {
+			lastActivity = *u.LastActivityOn
+		}
+		due := !txn.TransactionDate.After(cutoff) ||
+			(!txn.TransactionDate.After(idleCutoff) && !lastActivity.After(idleCutoff))
+		if !due {
+			continue
+		}
+		candidates = append(candidates, models.ExpiryCandidate{Transaction: txn.Transaction, Tier: u.Tier, LastActivityOn: lastActivity})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.TransactionDate.Equal(b.TransactionDate) {
+			return a.TransactionDate.Before(b.TransactionDate)
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// ExpireTransactions expires a batch of transactions and saves checkpoint together. A transaction
+// that was expired already is skipped. It returns how many transactions and points were expired.
+func (db *MemoryDB) ExpireTransactions(ctx context.Context, txns []models.ExpiryCandidate, checkpoint models.JobCheckpoint) (int, int, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := map[int]bool{}
+	for _, txn := range txns {
+		users[txn.UserID] = true
+	}
+	userIDs := sortedKeys(users)
+	before := map[int]models.PointsBalance{}
+	for _, userID := range userIDs {
+		before[userID] = s.balances[userID]
+	}
+
+	expired, points := 0, 0
+	deducted := map[int]int{}
+	now := memoryNow()
+	for _, txn := range txns {
+		stored := s.transactionByID(txn.ID)
+		if stored == nil || stored.expiredOn != nil || stored.refundedOn != nil {
+			continue
+		}
+		expiredOn := now
+		stored.expiredOn = &expiredOn
+
+		reason := txn.ExpiryReason
+		if reason == "" {
+			reason = expiryReason
+		}
+		s.appendPointsEvent(txn.UserID, models.PointsEventExpired, txn.PointsEarned, txn.TransactionID, reason)
+		s.logPointsHistory(txn.UserID, txn.TransactionID, txn.PointsEarned, "expired", reason)
+		deducted[txn.UserID] += txn.PointsEarned
+		expired++
+		points += txn.PointsEarned
+	}
+
+	for _, userID := range userIDs {
+		if deducted[userID] == 0 {
+			continue
+		}
+		after := before[userID]
+		after.TotalPoints -= deducted[userID]
+		if _, exists := s.balances[userID]; exists {
+			s.balances[userID] = after
+		}
+		if err := db.recordAudit("points.expire", "points_balance", userID, userID, before[userID], after); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	s.saveJobCheckpoint(checkpoint)
+	return expired, points, nil
+}
+
+func (s *memoryStore) transactionByID(id int) *memoryTransaction {
+	if id < 1 || id > len(s.transactions) {
+		return nil
+	}
+	return s.transactions[id-1]
+}
+
+// GetJobCheckpoint returns the last saved checkpoint of a job, nil when it never saved one
+func (db *MemoryDB) GetJobCheckpoint(ctx context.Context, job string) (*models.JobCheckpoint, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp, exists := s.checkpoints[job]
+	if !exists {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (db *MemoryDB) SaveJobCheckpoint(ctx context.Context, checkpoint models.JobCheckpoint) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveJobCheckpoint(checkpoint)
+	return nil
+}
+
+func (s *memoryStore) saveJobCheckpoint(cp models.JobCheckpoint) {
+	cp.UpdatedOn = memoryNow()
+	if cp.CompletedOn != nil {
+		completedOn := *cp.CompletedOn
+		cp.CompletedOn = &completedOn
+	}
+	s.checkpoints[cp.Job] = cp
+}
+
+// RecordExpiryWarnings stores warnings that do not exist yet for their lot and window and returns
+// how many were new, so a lot is only ever warned about once per window
+func (db *MemoryDB) RecordExpiryWarnings(ctx context.Context, warnings []models.ExpiryWarning) (int, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recorded := 0
+	now := memoryNow()
+	for _, warning := range warnings {
+		if s.user(warning.UserID) == nil {
+			return recorded, fmt.Errorf("Failed to record expiry warning: %v", errNoUser(warning.UserID))
+		}
+
+		exists := false
+		for _, w := range s.warnings {
+			if w.TransactionID == warning.TransactionID && w.WindowDays == warning.WindowDays {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+
+		s.warnings = append(s.warnings, &models.ExpiryWarning{
+			ID:            int64(len(s.warnings) + 1),
+			UserID:        warning.UserID,
+			TransactionID: warning.TransactionID,
+			WindowDays:    warning.WindowDays,
+			Points:        warning.Points,
+			ExpiresOn:     warning.ExpiresOn,
+			CreatedOn:     now,
+		})
+		recorded++
+	}
+	return recorded, nil
+}
+
+// GetPendingExpiryWarnings returns warnings that were not delivered yet, grouped by user
+func (db *MemoryDB) GetPendingExpiryWarnings(ctx context.Context, limit int) ([]models.ExpiryWarning, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var warnings []models.ExpiryWarning
+	for _, w := range s.warnings {
+		u := s.user(w.UserID)
+		if w.NotifiedOn != nil || u == nil || u.ClosedOn != nil {
+			continue
+		}
+		warning := *w
+		warning.Email = u.Email
+		warnings = append(warnings, warning)
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		switch {
+		case a.UserID != b.UserID:
+			return a.UserID < b.UserID
+		case a.WindowDays != b.WindowDays:
+			return a.WindowDays < b.WindowDays
+		case !a.ExpiresOn.Equal(b.ExpiresOn):
+			return a.ExpiresOn.Before(b.ExpiresOn)
+		}
+		return a.ID < b.ID
+	})
+	if limit >= 0 && len(warnings) > limit {
+		warnings = warnings[:limit]
+	}
+	return warnings, nil
+}
+
+func (db *MemoryDB) MarkExpiryWarningsNotified(ctx context.Context, ids []int64) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := memoryNow()
+	for _, id := range ids {
+		if id >= 1 && id <= int64(len(s.warnings)) {
+			notifiedOn := now
+			s.warnings[id-1].NotifiedOn = &notifiedOn
+		}
+	}
+	return nil
+}
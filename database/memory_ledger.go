@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// appendPointsEvent adds an event to the ledger, after the balance was updated, and queues the
+// matching domain event in the outbox
+func (s *memoryStore) appendPointsEvent(userID int, eventType string, points int, transactionID, reason string) {
+	event := models.PointsEvent{
+		ID:            int64(len(s.events) + 1),
+		UserID:        userID,
+		EventType:     eventType,
+		Points:        points,
+		TransactionID: transactionID,
+		Reason:        reason,
+		CreatedOn:     memoryNow(),
+	}
+	s.events = append(s.events, event)
+	s.enqueueDomainEvent(event)
+}
+
+func (db *MemoryDB) GetPointsEvents(ctx context.Context, userID int) ([]models.PointsEvent, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.PointsEvent
+	for _, event := range s.events {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ListLedgerUserIDs returns every user that has either ledger events or a stored balance
+func (db *MemoryDB) ListLedgerUserIDs(ctx context.Context) ([]int, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := map[int]bool{}
+	for _, event := range s.events {
+		users[event.UserID] = true
+	}
+	for userID := range s.balances {
+		users[userID] = true
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return sortedKeys(users), nil
+}
+
+// SetPointsBalance overwrites the stored projection, used when rebuilding from the ledger. The
+// balance is only written while it is still stored and the user's last event is still lastEventID.
+func (db *MemoryDB) SetPointsBalance(ctx context.Context, userID int, stored models.PointsBalance, lastEventID int64, balance models.PointsBalance) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user(userID) == nil {
+		return fmt.Errorf("Failed to set points balance: %v", errNoUser(userID))
+	}
+
+	before := s.balances[userID]
+	var currentEventID int64
+	for _, event := range s.events {
+		if event.UserID == userID {
+			currentEventID = event.ID
+		}
+	}
+	if before != stored || currentEventID != lastEventID {
+		return ErrBalanceChanged
+	}
+	s.balances[userID] = balance
+	return db.recordAudit("points.rebuild", "points_balance", userID, userID, before, balance)
+}
+
+// AdjustPoints applies a signed manual correction to a user's balance
+func (db *MemoryDB) AdjustPoints(ctx context.Context, userID int, points int, reason string) (models.PointsBalance, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user(userID) == nil {
+		return models.PointsBalance{}, fmt.Errorf("Failed to adjust points balance: %v", errNoUser(userID))
+	}
+
+	before := s.balances[userID]
+	after := before
+	after.TotalPoints += points
+	s.balances[userID] = after
+
+	s.appendPointsEvent(userID, models.PointsEventAdjusted, points, "", reason)
+	s.logPointsHistory(userID, "", points, "adjust", reason)
+	if err := db.recordAudit("points.adjust", "points_balance", userID, userID, before, after); err != nil {
+		return after, err
+	}
+	return after, nil
+}
+
+// RefundTransaction takes back the points earned on a refunded purchase
+func (db *MemoryDB) RefundTransaction(ctx context.Context, transactionID string, reason string) (*models.PointsEvent, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txn := s.transactionIDs[transactionID]
+	if txn == nil {
+		return nil, fmt.Errorf("Transaction %s not found", transactionID)
+	}
+	if txn.refundedOn != nil {
+		return nil, fmt.Errorf("Transaction %s is already refunded", transactionID)
+	}
+
+	event := &models.PointsEvent{
+		UserID:        txn.UserID,
+		EventType:     models.PointsEventRefunded,
+		Points:        txn.PointsEarned,
+		TransactionID: transactionID,
+		Reason:        reason,
+		CreatedOn:     memoryNow(),
+	}
+	refundedOn := event.CreatedOn
+	txn.refundedOn = &refundedOn
+
+	before, exists := s.balances[event.UserID]
+	after := before
+	after.TotalPoints -= event.Points
+	if exists {
+		s.balances[event.UserID] = after
+	}
+
+	s.appendPointsEvent(event.UserID, models.PointsEventRefunded, event.Points, transactionID, reason)
+	s.logPointsHistory(event.UserID, transactionID, event.Points, "refund", reason)
+	if err := db.recordAudit("transaction.refund", "transaction", transactionID, event.UserID, before, after); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// GetBalanceSources aggregates transactions and points history per user next to the stored balance
+func (db *MemoryDB) GetBalanceSources(ctx context.Context) ([]models.BalanceSources, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sources := make(map[int]*models.BalanceSources, len(s.users))
+	var ordered []models.BalanceSources
+	for _, u := range s.users {
+		sources[u.ID] = &models.BalanceSources{UserID: u.ID, Stored: s.balances[u.ID]}
+	}
+	for _, txn := range s.transactions {
+		if source := sources[txn.UserID]; source != nil {
+			source.Earned += txn.PointsEarned
+		}
+	}
+	for _, entry := range s.history {
+		source := sources[entry.UserID]
+		if source == nil {
+			continue
+		}
+		switch entry.PointsType {
+		case "redeem":
+			source.Redeemed += entry.Points
+		case "expired":
+			source.Expired += entry.Points
+		case "forfeit":
+			source.Forfeited += entry.Points
+		case "refund":
+			source.Refunded += entry.Points
+		case "adjust":
+			source.Adjusted += entry.Points
+		}
+	}
+
+	for _, source := range sources {
+		ordered = append(ordered, *source)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].UserID < ordered[j].UserID })
+	return ordered, nil
+}
+
+// ApplyReconciliationCorrection moves the stored balance to the recomputed one. The difference is
+// recorded as a ledger adjustment but not in points_history, which the expected value came from.
+// The balance is only corrected while it is still stored.
+func (db *MemoryDB) ApplyReconciliationCorrection(ctx context.Context, userID int, stored, expected models.PointsBalance, reason string) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := s.balances[userID]
+	if before == expected {
+		return nil
+	}
+	if before != stored {
+		return ErrBalanceChanged
+	}
+	if s.user(userID) == nil {
+		return fmt.Errorf("Failed to correct points balance: %v", errNoUser(userID))
+	}
+
+	s.balances[userID] = expected
+	if difference := expected.TotalPoints - before.TotalPoints; difference != 0 {
+		s.appendPointsEvent(userID, models.PointsEventAdjusted, difference, "", reason)
+	}
+	return db.recordAudit("points.reconcile", "points_balance", userID, userID, before, expected)
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// MemoryLocker is a Locker shared by everything using the same MemoryDB, which only makes it
+// useful within one process
+type MemoryLocker struct {
+	store *memoryStore
+	name  string
+}
+
+func (db *MemoryDB) NewLocker(name string) Locker {
+	return &MemoryLocker{store: db.store, name: name}
+}
+
+func (l *MemoryLocker) TryLock(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("Failed to take lock %s: %v", l.name, err)
+	}
+
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if holder := l.store.locks[l.name]; holder != nil && holder != l {
+		return false, nil
+	}
+	l.store.locks[l.name] = l
+	return true, nil
+}
+
+func (l *MemoryLocker) Check(ctx context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.locks[l.name] != l {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+	return nil
+}
+
+func (l *MemoryLocker) Unlock(ctx context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.locks[l.name] == l {
+		delete(l.store.locks, l.name)
+	}
+	return nil
+}
+
+// Terminate takes the lock away from its holder the way a crashed holder loses it, for failover
+// drills such as the leader failover test
+func (l *MemoryLocker) Terminate(ctx context.Context) error {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+	if l.store.locks[l.name] != l {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+	delete(l.store.locks, l.name)
+	return nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+type memoryPreferenceKey struct {
+	userID    int
+	channel   string
+	eventType string
+}
+
+// GetNotificationSettings returns a user's settings, a user who never saved any gets the defaults
+func (db *MemoryDB) GetNotificationSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings, exists := s.notificationSettings[userID]
+	if !exists {
+		return models.NotificationSettings{UserID: userID, Locale: defaultNotificationLocale}, nil
+	}
+	return settings, nil
+}
+
+func (db *MemoryDB) GetNotificationPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preferences := []models.NotificationPreference{}
+	for key, p := range s.notificationPreferences {
+		if key.userID == userID {
+			preferences = append(preferences, p)
+		}
+	}
+	sort.Slice(preferences, func(i, j int) bool {
+		if preferences[i].Channel != preferences[j].Channel {
+			return preferences[i].Channel < preferences[j].Channel
+		}
+		return preferences[i].EventType < preferences[j].EventType
+	})
+	return preferences, nil
+}
+
+// UpdateNotificationPreferences stores the settings and upserts each preference, preferences that
+// are not given are left as they are
+func (db *MemoryDB) UpdateNotificationPreferences(ctx context.Context, settings models.NotificationSettings, preferences []models.NotificationPreference) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user(settings.UserID) == nil {
+		return fmt.Errorf("Failed to save notification settings: %v", errNoUser(settings.UserID))
+	}
+
+	before, exists := s.notificationSettings[settings.UserID]
+	if !exists {
+		before = models.NotificationSettings{UserID: settings.UserID}
+	}
+	if settings.Locale == "" {
+		settings.Locale = defaultNotificationLocale
+	}
+	s.notificationSettings[settings.UserID] = settings
+
+	for _, p := range preferences {
+		p.UserID = settings.UserID
+		s.notificationPreferences[memoryPreferenceKey{settings.UserID, p.Channel, p.EventType}] = p
+	}
+
+	return db.recordAudit("notification.preferences", "notification_settings", settings.UserID, settings.UserID, auditNotificationSettings(before), map[string]interface{}{
+		"settings":    auditNotificationSettings(settings),
+		"preferences": preferences,
+	})
+}
+
+func (db *MemoryDB) LogNotificationDelivery(ctx context.Context, delivery models.NotificationDelivery) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery.ID = int64(len(s.notificationDeliveries) + 1)
+	delivery.CreatedOn = memoryNow()
+	s.notificationDeliveries = append(s.notificationDeliveries, delivery)
+	return nil
+}
+
+// GetNotificationDeliveries pages through the delivery log of a user, newest first, or of every user when userID is 0
+func (db *MemoryDB) GetNotificationDeliveries(ctx context.Context, userID, page, limit int) ([]models.NotificationDelivery, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []models.NotificationDelivery
+	for i := len(s.notificationDeliveries) - 1; i >= 0; i-- {
+		if d := s.notificationDeliveries[i]; userID == 0 || d.UserID == userID {
+			matching = append(matching, d)
+		}
+	}
+
+	start, end, err := memoryPage(len(matching), limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch notification deliveries: %v", err)
+	}
+	return append([]models.NotificationDelivery{}, matching[start:end]...), nil
+}
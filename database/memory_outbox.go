@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+type memoryOutboxEvent struct {
+	event        models.DomainEvent
+	attempts     int
+	deliveredTo  []string
+	claimedUntil *time.Time
+	publishedOn  *time.Time
+	deadOn       *time.Time
+	lastError    string
+}
+
+// enqueueDomainEvent writes the domain event for a ledger entry into the outbox
+func (s *memoryStore) enqueueDomainEvent(pointsEvent models.PointsEvent) {
+	event := models.DomainEvent{
+		ID:            uuid.New().String(),
+		Type:          "points." + pointsEvent.EventType,
+		UserID:        pointsEvent.UserID,
+		Points:        pointsEvent.Points,
+		TransactionID: pointsEvent.TransactionID,
+		Reason:        pointsEvent.Reason,
+		Balance:       s.balances[pointsEvent.UserID],
+		OccurredOn:    time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	// the purchase category identifies the merchant
+	if txn := s.transactionIDs[event.TransactionID]; txn != nil {
+		event.Merchant = txn.Category
+	}
+	s.outbox = append(s.outbox, &memoryOutboxEvent{event: event})
+}
+
+// ClaimOutboxEvents returns the oldest events that were neither published nor given up on, and
+// that no other relay holds a claim on, claiming them for lease
+func (db *MemoryDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := memoryNow()
+	var events []models.OutboxEvent
+	for i, pending := range s.outbox {
+		if len(events) >= limit {
+			break
+		}
+		if pending.publishedOn != nil || pending.deadOn != nil || (pending.claimedUntil != nil && !pending.claimedUntil.Before(now)) {
+			continue
+		}
+		claimedUntil := now.Add(lease)
+		pending.claimedUntil = &claimedUntil
+		events = append(events, models.OutboxEvent{
+			ID:          int64(i + 1),
+			Event:       pending.event,
+			Attempts:    pending.attempts,
+			DeliveredTo: append([]string(nil), pending.deliveredTo...),
+		})
+	}
+	return events, nil
+}
+
+// MarkOutboxEventDelivered records that publisher took the event, so a retry skips it
+func (db *MemoryDB) MarkOutboxEventDelivered(ctx context.Context, id int64, publisher string) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event := s.outboxEvent(id); event != nil {
+		event.deliveredTo = append(event.deliveredTo, publisher)
+	}
+	return nil
+}
+
+func (db *MemoryDB) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event := s.outboxEvent(id); event != nil {
+		now := memoryNow()
+		event.publishedOn = &now
+		event.attempts++
+		event.lastError = ""
+		event.claimedUntil = nil
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed attempt and releases the claim. Once maxAttempts were
+// made the event is given up on and true is returned.
+func (db *MemoryDB) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, maxAttempts int) (bool, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := s.outboxEvent(id)
+	if event == nil {
+		return false, nil
+	}
+	event.attempts++
+	event.lastError = reason
+	event.claimedUntil = nil
+	if event.attempts >= maxAttempts {
+		now := memoryNow()
+		event.deadOn = &now
+	}
+	return event.deadOn != nil, nil
+}
+
+func (s *memoryStore) outboxEvent(id int64) *memoryOutboxEvent {
+	if id < 1 || id > int64(len(s.outbox)) {
+		return nil
+	}
+	return s.outbox[id-1]
+}
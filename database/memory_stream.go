@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// StreamPointsHistory passes every history row matching the filter to fn in insertion order,
+// a zero UserID exports every user. The rows are copied out first so fn runs without the lock.
+func (db *MemoryDB) StreamPointsHistory(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.PointsHistory) error) error {
+	start, end, err := timeRange(filter.StartDate, filter.EndDate)
+	if err != nil {
+		return fmt.Errorf("Failed to export points history: %v", err)
+	}
+
+	s := db.store
+	s.mu.Lock()
+	var rows []models.PointsHistory
+	for _, entry := range s.history {
+		if (filter.UserID > 0 && entry.UserID != filter.UserID) || !inTimeRange(entry.Date, start, end) ||
+			(filter.TransactionType != "" && entry.PointsType != filter.TransactionType) {
+			continue
+		}
+		rows = append(rows, entry)
+	}
+	s.mu.Unlock()
+
+	for _, entry := range rows {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("Failed to export points history: %v", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamTransactions is StreamPointsHistory for transactions, TransactionType filters on the category
+func (db *MemoryDB) StreamTransactions(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.Transaction) error) error {
+	start, end, err := timeRange(filter.StartDate, filter.EndDate)
+	if err != nil {
+		return fmt.Errorf("Failed to export transactions: %v", err)
+	}
+
+	s := db.store
+	s.mu.Lock()
+	var rows []models.Transaction
+	for _, txn := range s.transactions {
+		if (filter.UserID > 0 && txn.UserID != filter.UserID) || !inTimeRange(txn.TransactionDate, start, end) ||
+			(filter.TransactionType != "" && txn.Category != filter.TransactionType) {
+			continue
+		}
+		rows = append(rows, txn.Transaction)
+	}
+	s.mu.Unlock()
+
+	for _, txn := range rows {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("Failed to export transactions: %v", err)
+		}
+		if err := fn(txn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+func (db *MemoryDB) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription.ID = len(s.subscriptions) + 1
+	subscription.Active = true
+	subscription.CreatedOn = memoryNow()
+	stored := *subscription
+	stored.EventTypes = append([]string{}, subscription.EventTypes...)
+
+	err := db.recordAudit("webhook.subscribe", "webhook_subscription", subscription.ID, 0, nil, map[string]interface{}{
+		"merchant":    subscription.Merchant,
+		"url":         subscription.URL,
+		"event_types": subscription.EventTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.subscriptions = append(s.subscriptions, &stored)
+	return subscription, nil
+}
+
+// GetWebhookSubscriptions lists subscriptions of a merchant, or of every merchant when merchant is empty
+func (db *MemoryDB) GetWebhookSubscriptions(ctx context.Context, merchant string, activeOnly bool) ([]models.WebhookSubscription, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var subscriptions []models.WebhookSubscription
+	for _, subscription := range s.subscriptions {
+		if (merchant != "" && subscription.Merchant != merchant) || (activeOnly && !subscription.Active) {
+			continue
+		}
+		subscriptions = append(subscriptions, copySubscription(subscription))
+	}
+	return subscriptions, nil
+}
+
+func (db *MemoryDB) GetWebhookSubscription(ctx context.Context, id int) (*models.WebhookSubscription, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > len(s.subscriptions) {
+		return nil, fmt.Errorf("Webhook subscription %d not found", id)
+	}
+	subscription := copySubscription(s.subscriptions[id-1])
+	return &subscription, nil
+}
+
+func (db *MemoryDB) DeactivateWebhookSubscription(ctx context.Context, id int) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > len(s.subscriptions) || !s.subscriptions[id-1].Active {
+		return fmt.Errorf("Active webhook subscription %d not found", id)
+	}
+
+	s.subscriptions[id-1].Active = false
+	return db.recordAudit("webhook.unsubscribe", "webhook_subscription", id, 0,
+		map[string]bool{"active": true}, map[string]bool{"active": false})
+}
+
+// CreateWebhookDeliveries queues an event for each subscription, an event relayed twice is queued once
+func (db *MemoryDB) CreateWebhookDeliveries(ctx context.Context, event models.DomainEvent, subscriptionIDs []int) error {
+	if len(subscriptionIDs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Failed to encode webhook payload: %v", err)
+	}
+
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subscriptionID := range subscriptionIDs {
+		if subscriptionID < 1 || subscriptionID > len(s.subscriptions) {
+			return fmt.Errorf("Failed to queue webhook delivery: webhook subscription %d does not exist", subscriptionID)
+		}
+	}
+
+	now := memoryNow()
+	for _, subscriptionID := range subscriptionIDs {
+		queued := false
+		for _, d := range s.deliveries {
+			if d.SubscriptionID == subscriptionID && d.EventID == event.ID {
+				queued = true
+				break
+			}
+		}
+		if queued {
+			continue
+		}
+
+		nextAttemptOn := now
+		s.deliveries = append(s.deliveries, &models.WebhookDelivery{
+			ID:             int64(len(s.deliveries) + 1),
+			SubscriptionID: subscriptionID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptOn:  &nextAttemptOn,
+			CreatedOn:      now,
+			UpdatedOn:      now,
+		})
+	}
+	return nil
+}
+
+// ClaimDueWebhookDeliveries returns the pending deliveries whose retry time has come and moves
+// their retry time lease ahead, so no other worker sends them meanwhile
+func (db *MemoryDB) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := memoryNow()
+	var deliveries []models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == models.WebhookDeliveryPending && d.NextAttemptOn != nil && !d.NextAttemptOn.After(now) {
+			deliveries = append(deliveries, *d)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptOn.Equal(*deliveries[j].NextAttemptOn) {
+			return deliveries[i].NextAttemptOn.Before(*deliveries[j].NextAttemptOn)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if limit >= 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	claimedUntil := now.Add(lease)
+	for _, claimed := range deliveries {
+		for _, d := range s.deliveries {
+			if d.ID == claimed.ID {
+				d.NextAttemptOn = &claimedUntil
+			}
+		}
+	}
+	return deliveries, nil
+}
+
+func (db *MemoryDB) GetWebhookDeliveries(ctx context.Context, subscriptionID, page, limit int) ([]models.WebhookDelivery, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []models.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if d := s.deliveries[i]; d.SubscriptionID == subscriptionID {
+			matching = append(matching, *d)
+		}
+	}
+
+	start, end, err := memoryPage(len(matching), limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch webhook deliveries: %v", err)
+	}
+	if start == end {
+		return nil, nil
+	}
+	return matching[start:end], nil
+}
+
+func (db *MemoryDB) GetWebhookDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.delivery(id)
+	if d == nil {
+		return nil, fmt.Errorf("Webhook delivery %d not found", id)
+	}
+	delivery := *d
+	return &delivery, nil
+}
+
+// RecordWebhookAttempt logs an attempt and stores the delivery's new state
+func (db *MemoryDB) RecordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt models.WebhookDeliveryAttempt) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.delivery(delivery.ID)
+	if stored == nil {
+		return fmt.Errorf("Failed to log webhook attempt: webhook delivery %d does not exist", delivery.ID)
+	}
+
+	attempt.ID = int64(len(s.deliveryAttempt) + 1)
+	attempt.DeliveryID = delivery.ID
+	s.deliveryAttempt = append(s.deliveryAttempt, attempt)
+
+	stored.Status, stored.Attempts, stored.LastError, stored.ResponseStatus = delivery.Status, delivery.Attempts, delivery.LastError, delivery.ResponseStatus
+	stored.NextAttemptOn = nil
+	if delivery.NextAttemptOn != nil {
+		nextAttemptOn := *delivery.NextAttemptOn
+		stored.NextAttemptOn = &nextAttemptOn
+	}
+	stored.UpdatedOn = memoryNow()
+	return nil
+}
+
+func (db *MemoryDB) GetWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attempts []models.WebhookDeliveryAttempt
+	for _, a := range s.deliveryAttempt {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+// RedeliverWebhook puts a delivery back in the queue with a fresh retry budget
+func (db *MemoryDB) RedeliverWebhook(ctx context.Context, deliveryID int64) error {
+	s := db.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.delivery(deliveryID)
+	if d == nil {
+		return fmt.Errorf("Webhook delivery %d not found", deliveryID)
+	}
+
+	status := d.Status
+	now := memoryNow()
+	d.Status, d.Attempts, d.NextAttemptOn, d.UpdatedOn = models.WebhookDeliveryPending, 0, &now, now
+	return db.recordAudit("webhook.redeliver", "webhook_delivery", deliveryID, 0,
+		map[string]string{"status": status}, map[string]string{"status": models.WebhookDeliveryPending})
+}
+
+func (s *memoryStore) delivery(id int64) *models.WebhookDelivery {
+	if id < 1 || id > int64(len(s.deliveries)) {
+		return nil
+	}
+	return s.deliveries[id-1]
+}
+
+func copySubscription(subscription *models.WebhookSubscription) models.WebhookSubscription {
+	copied := *subscription
+	copied.EventTypes = append([]string{}, subscription.EventTypes...)
+	return copied
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles holds a directory per dialect of <version>_<name>.up.sql and .down.sql scripts
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLock keeps two instances from migrating the same database at once
+const migrationLock = "schema-migrations"
+
+// Migration is one version of the schema, AppliedOn is nil while it is pending
+type Migration struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedOn *time.Time `json:"applied_on,omitempty"`
+
+	up, down string
+}
+
+// Migrator is implemented by databases whose schema is versioned by the embedded migrations
+type Migrator interface {
+	// SchemaVersion returns the version the database is at and the latest version there is
+	SchemaVersion(ctx context.Context) (current, latest int, err error)
+	// Migrations lists every migration in version order with when it was applied
+	Migrations(ctx context.Context) ([]Migration, error)
+	// MigrateTo applies or reverts migrations until the database is at version, returning the
+	// migrations it ran in the order it ran them, reverted ones with a nil AppliedOn
+	MigrateTo(ctx context.Context, version int) ([]Migration, error)
+}
+
+// AsMigrator returns the Migrator behind db, looking through wrappers such as the one adding timeouts,
+// migrations themselves run without a timeout
+func AsMigrator(db Database) (Migrator, bool) {
+	for {
+		if migrator, ok := db.(Migrator); ok {
+			return migrator, true
+		}
+		wrapper, ok := db.(interface{ Unwrap() Database })
+		if !ok {
+			return nil, false
+		}
+		db = wrapper.Unwrap()
+	}
+}
+
+// CheckSchema acts on the database.migrations setting when a service starts: "up" applies pending
+// migrations, "check" fails while the schema is behind, and "off" or empty does nothing. Databases
+// without a schema pass.
+func CheckSchema(ctx context.Context, db Database, mode string) error {
+	migrator, ok := AsMigrator(db)
+	if !ok || mode == "" || mode == "off" {
+		return nil
+	}
+
+	current, latest, err := migrator.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case "up":
+		_, err := migrator.MigrateTo(ctx, latest)
+		return err
+	case "check":
+		if current < latest {
+			return fmt.Errorf("database schema is at version %d but %d is required, run `go run main.go migrate up`", current, latest)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrations mode %q, want off, check or up", mode)
+	}
+}
+
+// loadMigrations reads the migrations of a dialect in version order
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := path.Join("migrations", d.String())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read migrations: %v", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		script, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read migration %s: %v", entry.Name(), err)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, version := range sortedKeys(byVersion) {
+		m := byVersion[version]
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// appliedMigrations returns the applied migrations by version, creating the table on first use
+func (db *PostgresDB) appliedMigrations(ctx context.Context) (map[int]Migration, error) {
+	_, err := db.connection.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			applied_on TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create schema_migrations: %v", err)
+	}
+
+	rows, err := db.connection.QueryContext(ctx, `SELECT version, name, applied_on FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]Migration{}
+	for rows.Next() {
+		var m Migration
+		var appliedOn time.Time
+		if err := rows.Scan(&m.Version, &m.Name, &appliedOn); err != nil {
+			return nil, err
+		}
+		m.AppliedOn = &appliedOn
+		applied[m.Version] = m
+	}
+	return applied, rows.Err()
+}
+
+func (db *PostgresDB) SchemaVersion(ctx context.Context) (int, int, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return 0, 0, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	current, latest := 0, 0
+	if len(applied) > 0 {
+		versions := sortedKeys(applied)
+		current = versions[len(versions)-1]
+	}
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	return current, latest, nil
+}
+
+// Migrations also lists versions the database has but this build does not know, such as those of
+// a newer build that migrated it
+func (db *PostgresDB) Migrations(ctx context.Context) ([]Migration, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range migrations {
+		if a, ok := applied[m.Version]; ok {
+			migrations[i].AppliedOn = a.AppliedOn
+			delete(applied, m.Version)
+		}
+	}
+	for _, version := range sortedKeys(applied) {
+		migrations = append(migrations, applied[version])
+	}
+	sort.SliceStable(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateTo runs every migration in its own transaction together with its schema_migrations row,
+// so a failed migration leaves the database at the version before it
+func (db *PostgresDB) MigrateTo(ctx context.Context, version int) ([]Migration, error) {
+	if version < 0 {
+		return nil, fmt.Errorf("migration version must not be negative")
+	}
+
+	// a SQLite transaction holds the write lock of the whole database, and every step checks
+	// schema_migrations again inside its transaction
+	if db.dialect == postgresDialect {
+		locker := db.NewLocker(migrationLock)
+		acquired, err := locker.TryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			return nil, fmt.Errorf("another instance is migrating the database")
+		}
+		defer locker.Unlock(context.Background())
+	}
+
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := version == 0
+	for _, m := range migrations {
+		known = known || m.Version == version
+	}
+	if !known {
+		return nil, fmt.Errorf("there is no migration %d", version)
+	}
+	// versions past the latest one came from a newer build, only that build can revert them
+	latest := migrations[len(migrations)-1].Version
+	if version < latest {
+		for _, applied := range sortedKeys(applied) {
+			if applied > latest {
+				return nil, fmt.Errorf("migration %d was applied by a newer build, which has to revert it", applied)
+			}
+		}
+	}
+
+	var ran []Migration
+	// revert newest first whatever is above the target, then apply oldest first what is missing
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		done, err := db.migrationStep(ctx, &m, false)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran = append(ran, m)
+		}
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok || m.Version > version {
+			continue
+		}
+		done, err := db.migrationStep(ctx, &m, true)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran = append(ran, m)
+		}
+	}
+	return ran, nil
+}
+
+// migrationStep applies or reverts one migration, reporting false when another instance did it first
+func (db *PostgresDB) migrationStep(ctx context.Context, m *Migration, up bool) (bool, error) {
+	done := false
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var applied bool
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM schema_migrations WHERE version = $1`, m.Version).Scan(&applied); err != nil {
+			return fmt.Errorf("Failed to check migration %d: %v", m.Version, err)
+		}
+		if applied == up {
+			return nil
+		}
+
+		if up {
+			if _, err := tx.ExecContext(ctx, m.up); err != nil {
+				return fmt.Errorf("Failed to apply migration %d_%s: %v", m.Version, m.Name, err)
+			}
+			now := time.Now()
+			if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_on) VALUES ($1, $2, $3)`, m.Version, m.Name, now); err != nil {
+				return fmt.Errorf("Failed to record migration %d: %v", m.Version, err)
+			}
+			m.AppliedOn = &now
+		} else {
+			if _, err := tx.ExecContext(ctx, m.down); err != nil {
+				return fmt.Errorf("Failed to revert migration %d_%s: %v", m.Version, m.Name, err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+				return fmt.Errorf("Failed to record migration %d: %v", m.Version, err)
+			}
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
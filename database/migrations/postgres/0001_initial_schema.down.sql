@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS points_history;
+DROP TABLE IF EXISTS points_balance;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS users;
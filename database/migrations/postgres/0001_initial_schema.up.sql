@@ -1,5 +1,9 @@
+-- The schema exactly as the original dbscript.sql created it. Tables are only created when missing,
+-- so a database set up from dbscript.sql is adopted by running this migration, and the migrations
+-- after it bring it up to date.
+
 -- Users Table
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     username VARCHAR(50) UNIQUE NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
@@ -8,7 +12,7 @@ CREATE TABLE users (
 );
 
 -- Transactions Table
-CREATE TABLE transactions (
+CREATE TABLE IF NOT EXISTS transactions (
     id SERIAL PRIMARY KEY,
     transaction_id VARCHAR(50) UNIQUE NOT NULL,
     user_id INT REFERENCES users(id),
@@ -21,14 +25,14 @@ CREATE TABLE transactions (
 );
 
 -- Points Balance Table
-CREATE TABLE points_balance (
+CREATE TABLE IF NOT EXISTS points_balance (
     user_id INT PRIMARY KEY REFERENCES users(id),
     total_points INT DEFAULT 0,
     points_redeemed INT DEFAULT 0
 );
 
 -- Points History Table
-CREATE TABLE points_history (
+CREATE TABLE IF NOT EXISTS points_history (
     id SERIAL PRIMARY KEY,
     user_id INT REFERENCES users(id),
     transaction_id VARCHAR(50),
@@ -37,4 +41,3 @@ CREATE TABLE points_history (
     reason VARCHAR(255),
     date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
-
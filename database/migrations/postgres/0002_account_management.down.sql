@@ -0,0 +1,8 @@
+-- forfeit rows written meanwhile are kept, the narrower check only applies to new rows
+ALTER TABLE points_history DROP CONSTRAINT IF EXISTS points_history_points_type_check;
+ALTER TABLE points_history ADD CONSTRAINT points_history_points_type_check
+    CHECK (points_type IN ('earn', 'redeem', 'expired')) NOT VALID;
+
+ALTER TABLE users DROP COLUMN IF EXISTS closed_on;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verification_token;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
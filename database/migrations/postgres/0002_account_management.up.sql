@@ -0,0 +1,8 @@
+-- Profile updates with email verification and account closure, which forfeits the balance
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(100);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_token VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS closed_on TIMESTAMP;
+
+ALTER TABLE points_history DROP CONSTRAINT IF EXISTS points_history_points_type_check;
+ALTER TABLE points_history ADD CONSTRAINT points_history_points_type_check
+    CHECK (points_type IN ('earn', 'redeem', 'expired', 'forfeit'));
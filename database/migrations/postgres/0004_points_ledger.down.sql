@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS points_events;
+
+-- adjust and refund rows written meanwhile are kept, the narrower check only applies to new rows
+ALTER TABLE points_history DROP CONSTRAINT IF EXISTS points_history_points_type_check;
+ALTER TABLE points_history ADD CONSTRAINT points_history_points_type_check
+    CHECK (points_type IN ('earn', 'redeem', 'expired', 'forfeit')) NOT VALID;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS refunded_on;
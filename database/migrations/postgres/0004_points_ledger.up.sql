@@ -0,0 +1,19 @@
+-- The append only ledger points_balance is projected from, with refunds and manual adjustments
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded_on TIMESTAMP;
+
+ALTER TABLE points_history DROP CONSTRAINT IF EXISTS points_history_points_type_check;
+ALTER TABLE points_history ADD CONSTRAINT points_history_points_type_check
+    CHECK (points_type IN ('earn', 'redeem', 'expired', 'forfeit', 'adjust', 'refund'));
+
+-- Points Events Table
+CREATE TABLE IF NOT EXISTS points_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id),
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('earned', 'redeemed', 'expired', 'adjusted', 'refunded')),
+    points INT NOT NULL,
+    transaction_id VARCHAR(50),
+    reason VARCHAR(255),
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS points_events_user_id_idx ON points_events (user_id, id);
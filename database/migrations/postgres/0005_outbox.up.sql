@@ -0,0 +1,14 @@
+-- Outbox Table, domain events written with the ledger change and relayed afterwards
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(36) UNIQUE NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INT,
+    payload JSON NOT NULL,
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    published_on TIMESTAMP,
+    attempts INT DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_on IS NULL;
@@ -0,0 +1,40 @@
+-- Webhook Subscriptions Table, event_types is a comma separated filter, empty receives everything
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    merchant VARCHAR(50) NOT NULL,
+    url TEXT NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    event_types TEXT NOT NULL DEFAULT '',
+    active BOOLEAN DEFAULT TRUE,
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook Deliveries Table
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id INT REFERENCES webhook_subscriptions(id),
+    event_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INT DEFAULT 0,
+    next_attempt_on TIMESTAMP,
+    last_error TEXT,
+    response_status INT,
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_on) WHERE status = 'pending';
+
+-- Webhook Delivery Attempts Table, the delivery log
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT REFERENCES webhook_deliveries(id),
+    attempt INT NOT NULL,
+    response_status INT,
+    error TEXT,
+    duration_ms BIGINT,
+    attempted_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
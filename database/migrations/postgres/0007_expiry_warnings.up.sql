@@ -0,0 +1,14 @@
+-- Expiry Warnings Table, one row per lot and warning window so each warning is sent once
+CREATE TABLE IF NOT EXISTS expiry_warnings (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(id),
+    transaction_id VARCHAR(50) NOT NULL,
+    window_days INT NOT NULL,
+    points INT NOT NULL,
+    expires_on TIMESTAMP NOT NULL,
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notified_on TIMESTAMP,
+    UNIQUE (transaction_id, window_days)
+);
+
+CREATE INDEX IF NOT EXISTS expiry_warnings_pending_idx ON expiry_warnings (user_id) WHERE notified_on IS NULL;
@@ -0,0 +1,34 @@
+-- Notification Settings Table, where and in which language a user is contacted
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    locale VARCHAR(10) NOT NULL DEFAULT 'en',
+    phone VARCHAR(30),
+    device_token VARCHAR(255),
+    updated_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notification Preferences Table, a user's opt in or out per channel and event type ('*' for every event)
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT REFERENCES users(id),
+    channel VARCHAR(20) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    updated_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, channel, event_type)
+);
+
+-- Notification Deliveries Table, the log of every message sent, failed or skipped
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id VARCHAR(36) NOT NULL,
+    user_id INT,
+    event_type VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    recipient VARCHAR(255),
+    subject VARCHAR(255),
+    status VARCHAR(10) NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    error TEXT,
+    created_on TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notification_deliveries_user_id_idx ON notification_deliveries (user_id, id);
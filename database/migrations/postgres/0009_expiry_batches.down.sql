@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS job_checkpoints;
+DROP INDEX IF EXISTS transactions_expirable_idx;
+ALTER TABLE transactions DROP COLUMN IF EXISTS expired_on;
@@ -0,0 +1,16 @@
+-- Expiry in checkpointed batches, a lot is marked once it expired
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS expired_on TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS transactions_expirable_idx ON transactions (transaction_date, id) WHERE expired_on IS NULL AND points_earned > 0;
+
+-- Job Checkpoints Table, how far a paged job got so it can resume after a crash
+CREATE TABLE IF NOT EXISTS job_checkpoints (
+    job_name VARCHAR(50) PRIMARY KEY,
+    cutoff TIMESTAMP NOT NULL,
+    cursor_date TIMESTAMP NOT NULL,
+    cursor_id INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    started_on TIMESTAMP NOT NULL,
+    updated_on TIMESTAMP NOT NULL,
+    completed_on TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- The tier expiry policies can be set for
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier VARCHAR(20) NOT NULL DEFAULT 'standard';
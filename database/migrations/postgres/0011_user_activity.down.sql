@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS last_activity_on;
@@ -0,0 +1,2 @@
+-- When a user last earned or redeemed, inactivity policies expire points counting from it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_activity_on TIMESTAMP;
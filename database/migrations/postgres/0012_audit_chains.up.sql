@@ -0,0 +1,5 @@
+-- The audit log is split into hash chains by user so audited writes of different users do not wait
+-- on each other, the events written before are all on chain 0
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS chain INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS audit_log_chain_idx ON audit_log (chain, id);
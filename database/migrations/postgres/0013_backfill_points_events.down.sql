@@ -0,0 +1,2 @@
+DELETE FROM points_events
+WHERE reason IN ('Backfilled from transactions', 'Backfilled from points history', 'Carried over from before the ledger');
@@ -0,0 +1,40 @@
+-- Balances kept before the ledger existed have no events, replaying the ledger would zero them.
+-- Their events are backfilled from the transactions and points history they were built from, and
+-- whatever those no longer account for is carried over as an opening event, so every user's events
+-- project to the balance stored today.
+CREATE TEMPORARY TABLE ledger_backfill_users ON COMMIT DROP AS
+SELECT b.user_id FROM points_balance b
+WHERE NOT EXISTS (SELECT 1 FROM points_events e WHERE e.user_id = b.user_id);
+
+INSERT INTO points_events (user_id, event_type, points, transaction_id, reason, created_on)
+SELECT t.user_id, 'earned', t.points_earned, t.transaction_id, 'Backfilled from transactions', t.transaction_date
+FROM transactions t
+JOIN ledger_backfill_users u ON u.user_id = t.user_id
+ORDER BY t.transaction_date, t.id;
+
+INSERT INTO points_events (user_id, event_type, points, transaction_id, reason, created_on)
+SELECT h.user_id, CASE h.points_type WHEN 'redeem' THEN 'redeemed' ELSE 'expired' END, h.points, h.transaction_id,
+    'Backfilled from points history', h.date
+FROM points_history h
+JOIN ledger_backfill_users u ON u.user_id = h.user_id
+WHERE h.points_type IN ('redeem', 'expired')
+ORDER BY h.date, h.id;
+
+-- redemptions the history lost, then the points the rest of the backfill does not explain
+INSERT INTO points_events (user_id, event_type, points, reason)
+SELECT b.user_id, 'redeemed', b.points_redeemed - COALESCE(SUM(e.points) FILTER (WHERE e.event_type = 'redeemed'), 0),
+    'Carried over from before the ledger'
+FROM points_balance b
+JOIN ledger_backfill_users u ON u.user_id = b.user_id
+LEFT JOIN points_events e ON e.user_id = b.user_id
+GROUP BY b.user_id, b.points_redeemed
+HAVING b.points_redeemed <> COALESCE(SUM(e.points) FILTER (WHERE e.event_type = 'redeemed'), 0);
+
+INSERT INTO points_events (user_id, event_type, points, reason)
+SELECT b.user_id, 'adjusted', b.total_points - COALESCE(SUM(CASE WHEN e.event_type IN ('earned', 'adjusted') THEN e.points ELSE -e.points END), 0),
+    'Carried over from before the ledger'
+FROM points_balance b
+JOIN ledger_backfill_users u ON u.user_id = b.user_id
+LEFT JOIN points_events e ON e.user_id = b.user_id
+GROUP BY b.user_id, b.total_points
+HAVING b.total_points <> COALESCE(SUM(CASE WHEN e.event_type IN ('earned', 'adjusted') THEN e.points ELSE -e.points END), 0);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS outbox_events_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_on IS NULL;
+
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS dead_on;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS delivered_to;
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS scheduler_locks;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notification_settings;
+DROP TABLE IF EXISTS job_checkpoints;
+DROP TABLE IF EXISTS expiry_warnings;
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS points_events;
+DROP TABLE IF EXISTS points_history;
+DROP TABLE IF EXISTS points_balance;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,214 @@
+-- The schema the sqlite driver created on its own before migrations existed, which is the whole
+-- schema of database/migrations/postgres up to its latest migration then, plus the scheduler_locks
+-- table. Timestamps are stored as text in the sqliteTimeFormat wall clock and NOW() is registered by
+-- the sqlite3-rewards driver. Tables are only created when missing, so those databases are adopted by
+-- running it. Later changes are new migrations, as for Postgres.
+
+-- Users Table
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    email VARCHAR(100) UNIQUE NOT NULL,
+    user_password VARCHAR(255) NOT NULL,
+    pending_email VARCHAR(100),
+    email_verification_token VARCHAR(64),
+    tier VARCHAR(20) NOT NULL DEFAULT 'standard',
+    last_activity_on TIMESTAMP,
+    closed_on TIMESTAMP,
+    created_on TIMESTAMP DEFAULT (NOW())
+);
+
+-- Transactions Table
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id VARCHAR(50) UNIQUE NOT NULL,
+    user_id INT REFERENCES users(id),
+    transaction_amount DECIMAL(10, 2) NOT NULL,
+    category VARCHAR(50) NOT NULL,
+    transaction_date TIMESTAMP NOT NULL,
+    product_code VARCHAR(50),
+    points_earned INT NOT NULL,
+    refunded_on TIMESTAMP,
+    expired_on TIMESTAMP,
+    created_on TIMESTAMP DEFAULT (NOW())
+);
+
+CREATE INDEX IF NOT EXISTS transactions_expirable_idx ON transactions (transaction_date, id) WHERE expired_on IS NULL AND points_earned > 0;
+
+-- Points Balance Table
+CREATE TABLE IF NOT EXISTS points_balance (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    total_points INT DEFAULT 0,
+    points_redeemed INT DEFAULT 0
+);
+
+-- Points History Table
+CREATE TABLE IF NOT EXISTS points_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id),
+    transaction_id VARCHAR(50),
+    points INT NOT NULL,
+    points_type VARCHAR(10) CHECK (points_type IN ('earn', 'redeem', 'expired', 'forfeit', 'adjust', 'refund')),
+    reason VARCHAR(255),
+    date TIMESTAMP DEFAULT (NOW())
+);
+
+-- Points Events Table, the append only ledger points_balance is projected from
+CREATE TABLE IF NOT EXISTS points_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id),
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('earned', 'redeemed', 'expired', 'adjusted', 'refunded')),
+    points INT NOT NULL,
+    transaction_id VARCHAR(50),
+    reason VARCHAR(255),
+    created_on TIMESTAMP DEFAULT (NOW())
+);
+
+CREATE INDEX IF NOT EXISTS points_events_user_id_idx ON points_events (user_id, id);
+
+-- Outbox Table, domain events written with the ledger change and relayed afterwards
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id VARCHAR(36) UNIQUE NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INT,
+    payload JSON NOT NULL,
+    created_on TIMESTAMP DEFAULT (NOW()),
+    published_on TIMESTAMP,
+    attempts INT DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_on IS NULL;
+
+-- Webhook Subscriptions Table, event_types is a comma separated filter, empty receives everything
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    merchant VARCHAR(50) NOT NULL,
+    url TEXT NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    event_types TEXT NOT NULL DEFAULT '',
+    active BOOLEAN DEFAULT TRUE,
+    created_on TIMESTAMP DEFAULT (NOW())
+);
+
+-- Webhook Deliveries Table
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INT REFERENCES webhook_subscriptions(id),
+    event_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INT DEFAULT 0,
+    next_attempt_on TIMESTAMP,
+    last_error TEXT,
+    response_status INT,
+    created_on TIMESTAMP DEFAULT (NOW()),
+    updated_on TIMESTAMP DEFAULT (NOW()),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_on) WHERE status = 'pending';
+
+-- Webhook Delivery Attempts Table, the delivery log
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id BIGINT REFERENCES webhook_deliveries(id),
+    attempt INT NOT NULL,
+    response_status INT,
+    error TEXT,
+    duration_ms BIGINT,
+    attempted_on TIMESTAMP DEFAULT (NOW())
+);
+
+-- Expiry Warnings Table, one row per lot and warning window so each warning is sent once
+CREATE TABLE IF NOT EXISTS expiry_warnings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT REFERENCES users(id),
+    transaction_id VARCHAR(50) NOT NULL,
+    window_days INT NOT NULL,
+    points INT NOT NULL,
+    expires_on TIMESTAMP NOT NULL,
+    created_on TIMESTAMP DEFAULT (NOW()),
+    notified_on TIMESTAMP,
+    UNIQUE (transaction_id, window_days)
+);
+
+CREATE INDEX IF NOT EXISTS expiry_warnings_pending_idx ON expiry_warnings (user_id) WHERE notified_on IS NULL;
+
+-- Job Checkpoints Table, how far a paged job got so it can resume after a crash
+CREATE TABLE IF NOT EXISTS job_checkpoints (
+    job_name VARCHAR(50) PRIMARY KEY,
+    cutoff TIMESTAMP NOT NULL,
+    cursor_date TIMESTAMP NOT NULL,
+    cursor_id INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    started_on TIMESTAMP NOT NULL,
+    updated_on TIMESTAMP NOT NULL,
+    completed_on TIMESTAMP
+);
+
+-- Notification Settings Table, where and in which language a user is contacted
+CREATE TABLE IF NOT EXISTS notification_settings (
+    user_id INT PRIMARY KEY REFERENCES users(id),
+    locale VARCHAR(10) NOT NULL DEFAULT 'en',
+    phone VARCHAR(30),
+    device_token VARCHAR(255),
+    updated_on TIMESTAMP DEFAULT (NOW())
+);
+
+-- Notification Preferences Table, a user's opt in or out per channel and event type ('*' for every event)
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT REFERENCES users(id),
+    channel VARCHAR(20) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    updated_on TIMESTAMP DEFAULT (NOW()),
+    PRIMARY KEY (user_id, channel, event_type)
+);
+
+-- Notification Deliveries Table, the log of every message sent, failed or skipped
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    notification_id VARCHAR(36) NOT NULL,
+    user_id INT,
+    event_type VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    recipient VARCHAR(255),
+    subject VARCHAR(255),
+    status VARCHAR(10) NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    error TEXT,
+    created_on TIMESTAMP DEFAULT (NOW())
+);
+
+CREATE INDEX IF NOT EXISTS notification_deliveries_user_id_idx ON notification_deliveries (user_id, id);
+
+-- Audit Log Table, append only and chained by hash
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(100) NOT NULL,
+    user_id INT,
+    before_value JSON,
+    after_value JSON,
+    request_id VARCHAR(100),
+    created_on TIMESTAMP NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target_type, target_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log BEGIN SELECT RAISE(IGNORE); END;
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log BEGIN SELECT RAISE(IGNORE); END;
+
+-- Scheduler Locks Table, a lease per lock name that its holder renews, SQLite has no advisory locks
+CREATE TABLE IF NOT EXISTS scheduler_locks (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(36) NOT NULL,
+    expires_on TIMESTAMP NOT NULL
+);
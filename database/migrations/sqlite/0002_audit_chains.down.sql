@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS audit_log_chain_idx;
+ALTER TABLE audit_log DROP COLUMN chain;
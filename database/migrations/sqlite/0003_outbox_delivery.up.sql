@@ -0,0 +1,8 @@
+-- Outbox delivery state: the publishers an event already reached, when a relay's claim on it runs
+-- out, and when it was given up on after too many attempts
+ALTER TABLE outbox_events ADD COLUMN delivered_to TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox_events ADD COLUMN claimed_until TIMESTAMP;
+ALTER TABLE outbox_events ADD COLUMN dead_on TIMESTAMP;
+
+DROP INDEX IF EXISTS outbox_events_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_on IS NULL AND dead_on IS NULL;
@@ -1,14 +1,21 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // User
 type User struct {
-	ID           int       `json:"id,omitempty"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	UserPassword string    `json:"user_password,omitempty"`
-	CreatedOn    time.Time `json:"created_on,omitempty"`
+	ID             int        `json:"id,omitempty"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	UserPassword   string     `json:"user_password,omitempty"`
+	PendingEmail   string     `json:"pending_email,omitempty"`
+	Tier           string     `json:"tier,omitempty"`
+	LastActivityOn *time.Time `json:"last_activity_on,omitempty"`
+	ClosedOn       *time.Time `json:"closed_on,omitempty"`
+	CreatedOn      time.Time  `json:"created_on,omitempty"`
 }
 
 // transaction
@@ -50,10 +57,12 @@ type PointsBalance struct {
 }
 
 type PointsHistory struct {
-	Points     int       `json:"points"`
-	PointsType string    `json:"points_type"` // earn, redeem, expire
-	Reason     string    `json:"reason"`
-	Date       time.Time `json:"date"`
+	UserID        int       `json:"user_id,omitempty"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Points        int       `json:"points"`
+	PointsType    string    `json:"points_type"` // earn, redeem, expire
+	Reason        string    `json:"reason"`
+	Date          time.Time `json:"date"`
 }
 
 type RedeemPointsRequest struct {
@@ -65,3 +74,303 @@ type LoginRequest struct {
 	UserEmail string `json:"userEmail"`
 	Password  string `json:"password"`
 }
+
+type UpdateProfileRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ChangePasswordRequest struct {
+	UserID          int    `json:"user_id"`
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type CloseAccountRequest struct {
+	UserID   int    `json:"user_id"`
+	Password string `json:"password"`
+}
+
+// AccountClosure is the outcome of closing an account
+type AccountClosure struct {
+	UserID        int       `json:"user_id"`
+	Policy        string    `json:"policy"` // forfeit, cashout
+	PointsSettled int       `json:"points_settled"`
+	CashOutAmount float64   `json:"cash_out_amount,omitempty"`
+	ClosedOn      time.Time `json:"closed_on"`
+}
+
+// AuditMeta identifies who is making a change and in which request
+type AuditMeta struct {
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+}
+
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	UserID     int             `json:"user_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	CreatedOn  time.Time       `json:"created_on"`
+	Chain      int             `json:"chain"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	UserID     int
+	RequestID  string
+	StartDate  string
+	EndDate    string
+	Page       int
+	PageSize   int
+}
+
+// AuditVerification is the result of walking the audit hash chain
+type AuditVerification struct {
+	Valid         bool   `json:"valid"`
+	EventsChecked int    `json:"events_checked"`
+	FirstBrokenID int64  `json:"first_broken_id,omitempty"`
+	BrokenReason  string `json:"broken_reason,omitempty"`
+}
+
+const (
+	PointsEventEarned   = "earned"
+	PointsEventRedeemed = "redeemed"
+	PointsEventExpired  = "expired"
+	PointsEventAdjusted = "adjusted"
+	PointsEventRefunded = "refunded"
+)
+
+// PointsEvent is an entry of the points ledger, points is signed only for adjustments
+type PointsEvent struct {
+	ID            int64     `json:"id"`
+	UserID        int       `json:"user_id"`
+	EventType     string    `json:"event_type"`
+	Points        int       `json:"points"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Reason        string    `json:"reason"`
+	CreatedOn     time.Time `json:"created_on"`
+}
+
+type AdjustPointsRequest struct {
+	UserID int    `json:"user_id"`
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+type RefundTransactionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BalanceDiscrepancy compares the stored balance with the one projected from the ledger
+type BalanceDiscrepancy struct {
+	UserID    int           `json:"user_id"`
+	Stored    PointsBalance `json:"stored"`
+	Projected PointsBalance `json:"projected"`
+}
+
+// BalanceSources are the per user totals a balance can be recomputed from
+type BalanceSources struct {
+	UserID    int           `json:"user_id"`
+	Earned    int           `json:"earned"`
+	Redeemed  int           `json:"redeemed"`
+	Expired   int           `json:"expired"`
+	Forfeited int           `json:"forfeited"`
+	Refunded  int           `json:"refunded"`
+	Adjusted  int           `json:"adjusted"`
+	Stored    PointsBalance `json:"stored"`
+}
+
+// DomainEvent is published to downstream consumers through the outbox
+type DomainEvent struct {
+	ID            string        `json:"id"`
+	Type          string        `json:"type"`
+	UserID        int           `json:"user_id"`
+	Points        int           `json:"points"`
+	TransactionID string        `json:"transaction_id,omitempty"`
+	Merchant      string        `json:"merchant,omitempty"`
+	Reason        string        `json:"reason"`
+	Balance       PointsBalance `json:"balance"`
+	OccurredOn    time.Time     `json:"occurred_on"`
+}
+
+// OutboxEvent is a domain event waiting in the outbox table to be relayed
+type OutboxEvent struct {
+	ID       int64       `json:"id"`
+	Event    DomainEvent `json:"event"`
+	Attempts int         `json:"attempts"`
+	// DeliveredTo names the publishers that already took the event
+	DeliveredTo []string `json:"delivered_to"`
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	Merchant   string    `json:"merchant"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"` // empty receives every event type
+	Active     bool      `json:"active"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptOn  *time.Time      `json:"next_attempt_on,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	CreatedOn      time.Time       `json:"created_on"`
+	UpdatedOn      time.Time       `json:"updated_on"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID             int64     `json:"id"`
+	DeliveryID     int64     `json:"delivery_id"`
+	Attempt        int       `json:"attempt"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DurationMs     int64     `json:"duration_ms"`
+	AttemptedOn    time.Time `json:"attempted_on"`
+}
+
+type CreateWebhookRequest struct {
+	Merchant   string   `json:"merchant"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type BatchTransactionRequest struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+const (
+	BatchItemCreated   = "created"
+	BatchItemDuplicate = "duplicate"
+	BatchItemInvalid   = "invalid"
+)
+
+// BatchTransactionResult reports the outcome of one item of a batch, by its position in the request
+type BatchTransactionResult struct {
+	Index         int    `json:"index"`
+	Status        string `json:"status"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	PointsEarned  int    `json:"points_earned,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ExpiryWarning is a warning that the points of one earning transaction expire within WindowDays
+type ExpiryWarning struct {
+	ID            int64      `json:"id"`
+	UserID        int        `json:"user_id"`
+	Email         string     `json:"email,omitempty"`
+	TransactionID string     `json:"transaction_id"`
+	WindowDays    int        `json:"window_days"`
+	Points        int        `json:"points"`
+	ExpiresOn     time.Time  `json:"expires_on"`
+	CreatedOn     time.Time  `json:"created_on"`
+	NotifiedOn    *time.Time `json:"notified_on,omitempty"`
+}
+
+// ExpiryCandidate is an earning transaction whose points have not expired yet, with the user
+// details its expiry policy depends on
+type ExpiryCandidate struct {
+	Transaction
+	Tier string `json:"tier"`
+	// LastActivityOn is the user's latest purchase or redemption
+	LastActivityOn time.Time `json:"last_activity_on"`
+	// ExpiryReason is recorded in the ledger when the lot is expired
+	ExpiryReason string `json:"expiry_reason,omitempty"`
+}
+
+type UserTierRequest struct {
+	Tier string `json:"tier"`
+}
+
+// JobCheckpoint is how far a paged job got through its input. It is saved in the same database
+// transaction as each batch, so a job that dies resumes right after the last batch it committed.
+type JobCheckpoint struct {
+	Job string `json:"job"`
+	// Cutoff is fixed when a run starts so a resumed run works on the same input
+	Cutoff      time.Time  `json:"cutoff"`
+	CursorDate  time.Time  `json:"cursor_date"`
+	CursorID    int        `json:"cursor_id"`
+	Processed   int        `json:"processed"`
+	StartedOn   time.Time  `json:"started_on"`
+	UpdatedOn   time.Time  `json:"updated_on"`
+	CompletedOn *time.Time `json:"completed_on,omitempty"`
+}
+
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+	NotificationChannelPush  = "push"
+
+	NotificationDeliverySent    = "sent"
+	NotificationDeliveryFailed  = "failed"
+	NotificationDeliverySkipped = "skipped"
+)
+
+// NotificationSettings holds a user's contact details beyond the account email
+type NotificationSettings struct {
+	UserID      int    `json:"user_id"`
+	Locale      string `json:"locale"`
+	Phone       string `json:"phone,omitempty"`
+	DeviceToken string `json:"device_token,omitempty"`
+}
+
+// NotificationPreference opts a user in or out of a channel for an event type, "*" matches every event
+type NotificationPreference struct {
+	UserID    int    `json:"user_id"`
+	Channel   string `json:"channel"`
+	EventType string `json:"event_type"`
+	Enabled   bool   `json:"enabled"`
+}
+
+type NotificationPreferencesRequest struct {
+	UserID      int                      `json:"user_id"`
+	Locale      string                   `json:"locale"`
+	Phone       string                   `json:"phone"`
+	DeviceToken string                   `json:"device_token"`
+	Preferences []NotificationPreference `json:"preferences"`
+}
+
+// NotificationDelivery is an entry of the notification delivery log
+type NotificationDelivery struct {
+	ID             int64     `json:"id"`
+	NotificationID string    `json:"notification_id"`
+	UserID         int       `json:"user_id"`
+	EventType      string    `json:"event_type"`
+	Channel        string    `json:"channel"`
+	Recipient      string    `json:"recipient,omitempty"`
+	Subject        string    `json:"subject,omitempty"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	CreatedOn      time.Time `json:"created_on"`
+}
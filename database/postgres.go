@@ -1,25 +1,68 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	utils "github.com/lakshay88/reward-management-system/Utils"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database/models"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// PostgresDB is the SQL implementation of Database. Its queries are written for Postgres, on
+// SQLite the sqlite3-rewards driver translates them and dialect covers what it cannot.
 type PostgresDB struct {
 	connection *sql.DB
+	dialect    dialect
+	audit      models.AuditMeta
+}
+
+// dialect is the SQL database a PostgresDB runs on
+type dialect int
+
+const (
+	postgresDialect dialect = iota
+	sqliteDialect
+)
+
+// String names the dialect's directory of migrations
+func (d dialect) String() string {
+	if d == sqliteDialect {
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx so helpers can run inside or outside a transaction
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
 func ConnectionToPostgres(cfg config.DatabaseConfig) (Database, error) {
 	connectionString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
 
-	connection, err := sql.Open(cfg.Driver, connectionString)
+	connection, err := openPostgres(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := connection.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &PostgresDB{connection: connection}, nil
+}
+
+// openPostgres opens a pool to the database at connectionString without connecting yet
+func openPostgres(connectionString string) (*sql.DB, error) {
+	connection, err := sql.Open("postgres", connectionString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open connection: %w", err)
 	}
@@ -28,24 +71,64 @@ func ConnectionToPostgres(cfg config.DatabaseConfig) (Database, error) {
 	connection.SetMaxOpenConns(25)
 	connection.SetMaxIdleConns(25)
 	connection.SetConnMaxLifetime(5 * time.Minute)
+	return connection, nil
+}
 
-	if err := connection.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+func (db *PostgresDB) Close() error {
+	return db.connection.Close()
+}
+
+// withTx runs fn in a transaction, committing only when fn succeeds
+func (db *PostgresDB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.connection.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to start transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	return &PostgresDB{connection: connection}, nil
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit transaction: %v", err)
+	}
+	return nil
 }
 
-func (db *PostgresDB) Close() error {
-	return db.connection.Close()
+func isUniqueViolation(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "23505"
+	}
+	return isSQLiteUniqueViolation(err)
+}
+
+// lockPointsBalance reads a user's balance and holds its row lock until the transaction ends
+func lockPointsBalance(ctx context.Context, tx *sql.Tx, userID int) (models.PointsBalance, bool, error) {
+	var balance models.PointsBalance
+	err := tx.QueryRowContext(ctx, `SELECT total_points, points_redeemed FROM points_balance WHERE user_id = $1 FOR UPDATE`, userID).
+		Scan(&balance.TotalPoints, &balance.PointsRedeemed)
+	if err == sql.ErrNoRows {
+		return balance, false, nil
+	} else if err != nil {
+		return balance, false, fmt.Errorf("Failed to fetch points balance: %v", err)
+	}
+	return balance, true, nil
 }
 
-func (db *PostgresDB) CreateUser(user *models.User) (*models.User, error) {
+func (db *PostgresDB) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	// Insert user into the database
-	query := `INSERT INTO users (username, email, user_password) VALUES ($1, $2, $3) RETURNING id, created_on`
+	query := `INSERT INTO users (username, email, user_password, tier) VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'standard')) RETURNING id, tier, created_on`
+
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		// Execute the query
+		err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.UserPassword, user.Tier).Scan(&user.ID, &user.Tier, &user.CreatedOn)
+		if err != nil {
+			return err
+		}
 
-	// Execute the query
-	err := db.connection.QueryRow(query, user.Username, user.Email, user.UserPassword).Scan(&user.ID, &user.CreatedOn)
+		return db.recordAudit(ctx, tx, "user.create", "user", user.ID, user.ID, nil,
+			map[string]interface{}{"tier": user.Tier})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -56,33 +139,42 @@ func (db *PostgresDB) CreateUser(user *models.User) (*models.User, error) {
 	return user, nil
 }
 
-func (db *PostgresDB) GetUserByID(userId int, user *models.User) (*models.User, error) {
+func (db *PostgresDB) GetUserByID(ctx context.Context, userId int, user *models.User) (*models.User, error) {
 
 	// Handling Nil
 	if user == nil {
 		user = &models.User{}
 	}
 
-	query := `SELECT id, username, email, created_on FROM users WHERE id = $1`
-	err := db.connection.QueryRow(query, userId).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedOn)
+	var pendingEmail sql.NullString
+	var lastActivityOn, closedOn sql.NullTime
+	query := `SELECT id, username, email, pending_email, tier, last_activity_on, closed_on, created_on FROM users WHERE id = $1`
+	err := db.connection.QueryRowContext(ctx, query, userId).Scan(&user.ID, &user.Username, &user.Email, &pendingEmail, &user.Tier, &lastActivityOn, &closedOn, &user.CreatedOn)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("User with ID %s not found", userId)
+		return nil, fmt.Errorf("User with ID %d not found", userId)
 	} else if err != nil {
 		return nil, fmt.Errorf("Failed to fetch user: %v", err)
 	}
+	user.PendingEmail = pendingEmail.String
+	if lastActivityOn.Valid {
+		user.LastActivityOn = &lastActivityOn.Time
+	}
+	if closedOn.Valid {
+		user.ClosedOn = &closedOn.Time
+	}
 
 	return user, nil
 }
 
-func (db *PostgresDB) GetUserByEmail(userEmail string, user *models.User) (*models.User, error) {
+func (db *PostgresDB) GetUserByEmail(ctx context.Context, userEmail string, user *models.User) (*models.User, error) {
 
 	// Handling Nil
 	if user == nil {
 		user = &models.User{}
 	}
 
-	query := `SELECT id, username, email, user_password, created_on FROM users WHERE email = $1`
-	err := db.connection.QueryRow(query, userEmail).Scan(&user.ID, &user.Username, &user.Email, &user.UserPassword, &user.CreatedOn)
+	query := `SELECT id, username, email, user_password, created_on FROM users WHERE email = $1 AND closed_on IS NULL`
+	err := db.connection.QueryRowContext(ctx, query, userEmail).Scan(&user.ID, &user.Username, &user.Email, &user.UserPassword, &user.CreatedOn)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("User with Email %s not found", userEmail)
 	} else if err != nil {
@@ -92,12 +184,225 @@ func (db *PostgresDB) GetUserByEmail(userEmail string, user *models.User) (*mode
 	return user, nil
 }
 
+// UpdateUserProfile changes the username right away, an email change is parked in pending_email
+// until it is confirmed with the returned verification token.
+func (db *PostgresDB) UpdateUserProfile(ctx context.Context, user *models.User) (*models.User, string, error) {
+	var current models.User
+	var verificationToken string
+
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var closedOn sql.NullTime
+		var pendingEmail sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT id, username, email, pending_email, closed_on FROM users WHERE id = $1 FOR UPDATE`, user.ID).
+			Scan(&current.ID, &current.Username, &current.Email, &pendingEmail, &closedOn)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("User with ID %d not found", user.ID)
+		} else if err != nil {
+			return fmt.Errorf("Failed to fetch user: %v", err)
+		}
+		if closedOn.Valid {
+			return fmt.Errorf("User with ID %d is closed", user.ID)
+		}
+		current.PendingEmail = pendingEmail.String
+
+		usernameChanged := user.Username != "" && user.Username != current.Username
+		if usernameChanged {
+			_, err = tx.ExecContext(ctx, `UPDATE users SET username = $1 WHERE id = $2`, user.Username, user.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to update username: %v", err)
+			}
+			current.Username = user.Username
+		}
+
+		emailChangeRequested := user.Email != "" && user.Email != current.Email
+		if emailChangeRequested {
+			// another user's unverified change claims the address as well
+			var emailCount int
+			err = tx.QueryRowContext(ctx, `SELECT COUNT(1) FROM users WHERE (email = $1 OR pending_email = $1) AND id <> $2`, user.Email, user.ID).Scan(&emailCount)
+			if err != nil {
+				return fmt.Errorf("Failed to check email: %v", err)
+			}
+			if emailCount > 0 {
+				return fmt.Errorf("Email %s is already in use", user.Email)
+			}
+
+			verificationToken = strings.ReplaceAll(uuid.New().String(), "-", "")
+			_, err = tx.ExecContext(ctx, `UPDATE users SET pending_email = $1, email_verification_token = $2 WHERE id = $3`,
+				user.Email, verificationToken, user.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to update email: %v", err)
+			}
+			current.PendingEmail = user.Email
+		}
+
+		return db.recordAudit(ctx, tx, "user.update_profile", "user", user.ID, user.ID, nil,
+			auditProfileChange(usernameChanged, emailChangeRequested))
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &current, verificationToken, nil
+}
+
+// VerifyUserEmail swaps the pending email in once its verification token is presented
+func (db *PostgresDB) VerifyUserEmail(ctx context.Context, token string) (*models.User, error) {
+	user := &models.User{}
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email_verification_token = $1 AND pending_email IS NOT NULL AND closed_on IS NULL FOR UPDATE`, token).
+			Scan(&user.ID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("Invalid or expired verification token")
+		} else if err != nil {
+			return fmt.Errorf("Failed to verify email: %v", err)
+		}
+
+		query := `
+			UPDATE users
+			SET email = pending_email, pending_email = NULL, email_verification_token = NULL
+			WHERE id = $1
+			RETURNING username, email, created_on`
+		err = tx.QueryRowContext(ctx, query, user.ID).Scan(&user.Username, &user.Email, &user.CreatedOn)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("Email is already in use")
+		} else if err != nil {
+			return fmt.Errorf("Failed to verify email: %v", err)
+		}
+
+		return db.recordAudit(ctx, tx, "user.verify_email", "user", user.ID, user.ID, nil, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (db *PostgresDB) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE users SET user_password = $1 WHERE id = $2 AND closed_on IS NULL`, hashedPassword, userID)
+		if err != nil {
+			return fmt.Errorf("Failed to update password: %v", err)
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return fmt.Errorf("User with ID %d not found", userID)
+		}
+
+		// password hashes are never copied into the audit log
+		return db.recordAudit(ctx, tx, "user.change_password", "user", userID, userID, nil, nil)
+	})
+}
+
+// SetUserTier moves an open account to another tier and returns the tier it was in
+func (db *PostgresDB) SetUserTier(ctx context.Context, userID int, tier string) (string, error) {
+	var previous string
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var closedOn sql.NullTime
+		err := tx.QueryRowContext(ctx, `SELECT tier, closed_on FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previous, &closedOn)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("User with ID %d not found", userID)
+		} else if err != nil {
+			return fmt.Errorf("Failed to fetch user: %v", err)
+		}
+		if closedOn.Valid {
+			return fmt.Errorf("User with ID %d is closed", userID)
+		}
+		if previous == tier {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET tier = $1 WHERE id = $2`, tier, userID); err != nil {
+			return fmt.Errorf("Failed to update tier: %v", err)
+		}
+		return db.recordAudit(ctx, tx, "user.tier", "user", userID, userID,
+			map[string]string{"tier": previous}, map[string]string{"tier": tier})
+	})
+	if err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// CloseUserAccount settles the remaining points per policy and anonymizes the user's PII.
+// Transactions and points history are kept so the ledger stays intact.
+func (db *PostgresDB) CloseUserAccount(ctx context.Context, userID int, policy string, cashOutRate float64) (*models.AccountClosure, error) {
+	closure := &models.AccountClosure{UserID: userID, Policy: policy}
+
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var closedOn sql.NullTime
+		err := tx.QueryRowContext(ctx, `SELECT closed_on FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&closedOn)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("User with ID %d not found", userID)
+		} else if err != nil {
+			return fmt.Errorf("Failed to fetch user: %v", err)
+		}
+		if closedOn.Valid {
+			return fmt.Errorf("User with ID %d is already closed", userID)
+		}
+
+		balance, _, err := lockPointsBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if remainingPoints := balance.TotalPoints; remainingPoints > 0 {
+			after := balance
+			after.TotalPoints = 0
+			switch policy {
+			case "cashout":
+				after.PointsRedeemed += remainingPoints
+				_, err = tx.ExecContext(ctx, `UPDATE points_balance SET total_points = 0, points_redeemed = points_redeemed + $1 WHERE user_id = $2`, remainingPoints, userID)
+				if err == nil {
+					err = appendPointsEvent(ctx, tx, userID, models.PointsEventRedeemed, remainingPoints, "", "Points cashed out on account closure")
+				}
+				if err == nil {
+					err = logPointsHistory(ctx, tx, userID, "", remainingPoints, "redeem", "Points cashed out on account closure")
+				}
+				closure.CashOutAmount = float64(remainingPoints) * cashOutRate
+			case "forfeit":
+				_, err = tx.ExecContext(ctx, `UPDATE points_balance SET total_points = 0 WHERE user_id = $1`, userID)
+				if err == nil {
+					err = appendPointsEvent(ctx, tx, userID, models.PointsEventAdjusted, -remainingPoints, "", "Points forfeited on account closure")
+				}
+				if err == nil {
+					err = logPointsHistory(ctx, tx, userID, "", remainingPoints, "forfeit", "Points forfeited on account closure")
+				}
+			default:
+				return fmt.Errorf("Unknown account closure policy %q", policy)
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to settle points balance: %v", err)
+			}
+			if err := db.recordAudit(ctx, tx, "points.settle_on_closure", "points_balance", userID, userID, balance, after); err != nil {
+				return err
+			}
+			closure.PointsSettled = remainingPoints
+		}
+
+		anonymizeQuery := `
+			UPDATE users
+			SET username = $1, email = $2, user_password = '', pending_email = NULL, email_verification_token = NULL, closed_on = NOW()
+			WHERE id = $3 RETURNING closed_on`
+		err = tx.QueryRowContext(ctx, anonymizeQuery, fmt.Sprintf("deleted-user-%d", userID), fmt.Sprintf("deleted-user-%d@closed.invalid", userID), userID).
+			Scan(&closure.ClosedOn)
+		if err != nil {
+			return fmt.Errorf("Failed to anonymize user: %v", err)
+		}
+
+		// the audit entry records the closure, not the PII that was just removed
+		return db.recordAudit(ctx, tx, "user.close", "user", userID, userID, nil, closure)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return closure, nil
+}
+
 func (db *PostgresDB) PointBalance(userId string) error {
 
 	return nil
 }
 
-func (db *PostgresDB) AddTransaction(txn *models.Transaction) (*models.Transaction, error) {
+func (db *PostgresDB) AddTransaction(ctx context.Context, txn *models.Transaction) (*models.Transaction, error) {
 
 	// Handling Nil
 	if txn == nil {
@@ -106,8 +411,8 @@ func (db *PostgresDB) AddTransaction(txn *models.Transaction) (*models.Transacti
 
 	// User validation
 	var userCount int
-	checkUserQuery := `SELECT COUNT(1) FROM users WHERE id = $1`
-	err := db.connection.QueryRow(checkUserQuery, txn.UserID).Scan(&userCount)
+	checkUserQuery := `SELECT COUNT(1) FROM users WHERE id = $1 AND closed_on IS NULL`
+	err := db.connection.QueryRowContext(ctx, checkUserQuery, txn.UserID).Scan(&userCount)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to check if user exists: %v", err)
 	}
@@ -116,7 +421,19 @@ func (db *PostgresDB) AddTransaction(txn *models.Transaction) (*models.Transacti
 		return nil, fmt.Errorf("User with ID %d does not exist", txn.UserID)
 	}
 
-	txn.TransactionID = uuid.New().String()
+	// A caller supplied transaction ID makes the insert idempotent
+	if txn.TransactionID == "" {
+		txn.TransactionID = uuid.New().String()
+	} else {
+		var existing int
+		err = db.connection.QueryRowContext(ctx, `SELECT COUNT(1) FROM transactions WHERE transaction_id = $1`, txn.TransactionID).Scan(&existing)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to check transaction: %v", err)
+		}
+		if existing > 0 {
+			return nil, ErrDuplicateTransaction
+		}
+	}
 	if txn.TransactionDate.IsZero() {
 		txn.TransactionDate = time.Now()
 	}
@@ -126,36 +443,68 @@ func (db *PostgresDB) AddTransaction(txn *models.Transaction) (*models.Transacti
 	categoryMultiplier := utils.GetCategoryMultiplier(txn.Category)
 	pointsEarned = int(txn.TransactionAmount) * categoryMultiplier
 
-	// Transaction add logic
-	transactionQuery := `INSERT INTO transactions (transaction_id, user_id, transaction_amount, category, transaction_date, product_code, points_earned) 
-						VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 	var transactionID int
-	err = db.connection.QueryRow(transactionQuery, txn.TransactionID, txn.UserID, txn.TransactionAmount,
-		txn.Category, txn.TransactionDate, txn.ProductCode, pointsEarned).Scan(&transactionID)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to insert transaction: %v", err)
-	}
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		// Transaction add logic
+		transactionQuery := `INSERT INTO transactions (transaction_id, user_id, transaction_amount, category, transaction_date, product_code, points_earned) 
+						VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		err := tx.QueryRowContext(ctx, transactionQuery, txn.TransactionID, txn.UserID, txn.TransactionAmount,
+			txn.Category, txn.TransactionDate, txn.ProductCode, pointsEarned).Scan(&transactionID)
+		if isUniqueViolation(err) {
+			return ErrDuplicateTransaction
+		} else if err != nil {
+			return fmt.Errorf("Failed to insert transaction: %v", err)
+		}
 
-	// Update if points_balance already exist
-	pointsBalanceQuery := `UPDATE points_balance SET total_points = total_points + $1 WHERE user_id = $2`
-	result, err := db.connection.Exec(pointsBalanceQuery, pointsEarned, txn.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to update points balance: %v", err)
-	}
+		before, exists, err := lockPointsBalance(ctx, tx, txn.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Update if points_balance already exist, otherwise create a new entry.
+		if exists {
+			pointsBalanceQuery := `UPDATE points_balance SET total_points = total_points + $1 WHERE user_id = $2`
+			_, err = tx.ExecContext(ctx, pointsBalanceQuery, pointsEarned, txn.UserID)
+			if err != nil {
+				return fmt.Errorf("Failed to update points balance: %v", err)
+			}
+		} else {
+			pointsBalanceQuery := `INSERT INTO points_balance (user_id, total_points) VALUES ($1, $2)`
+			_, err = tx.ExecContext(ctx, pointsBalanceQuery, txn.UserID, pointsEarned)
+			if err != nil {
+				return fmt.Errorf("Failed to create points balance: %v", err)
+			}
+		}
 
-	// If no rows were affected create a new entry.
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		pointsBalanceQuery := `INSERT INTO points_balance (user_id, total_points) VALUES ($1, $2)`
-		_, err = db.connection.Exec(pointsBalanceQuery, txn.UserID, pointsEarned)
+		err = appendPointsEvent(ctx, tx, txn.UserID, models.PointsEventEarned, pointsEarned, txn.TransactionID, "Points earned for transaction")
 		if err != nil {
-			return nil, fmt.Errorf("Failed to create points balance: %v", err)
+			return err
+		}
+
+		if err := touchActivity(ctx, tx, txn.UserID, txn.TransactionDate); err != nil {
+			return err
+		}
+
+		err = logPointsHistory(ctx, tx, txn.UserID, txn.TransactionID, pointsEarned, "earn", "Points earned for transaction")
+		if err != nil {
+			return fmt.Errorf("Failed to log points history: %v", err)
 		}
-	}
 
-	err = db.LogPointsHistory(txn.UserID, pointsEarned, "earn", "Points earned for transaction")
+		after := before
+		after.TotalPoints += pointsEarned
+		err = db.recordAudit(ctx, tx, "transaction.add", "transaction", txn.TransactionID, txn.UserID, nil, map[string]interface{}{
+			"transaction_amount": txn.TransactionAmount,
+			"category":           txn.Category,
+			"product_code":       txn.ProductCode,
+			"points_earned":      pointsEarned,
+		})
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, "points.earn", "points_balance", txn.UserID, txn.UserID, before, after)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to log points history: %v", err)
+		return nil, err
 	}
 
 	txn.ID = transactionID
@@ -163,42 +512,76 @@ func (db *PostgresDB) AddTransaction(txn *models.Transaction) (*models.Transacti
 	return txn, nil
 }
 
-func (db *PostgresDB) GetPointsBalance(userID int) (models.PointsBalance, error) {
+func (db *PostgresDB) GetTransactionsByUser(ctx context.Context, userID, page, limit int) ([]models.Transaction, error) {
+	offset := (page - 1) * limit
+
+	query := `
+		SELECT id, transaction_id, user_id, transaction_amount, category, transaction_date, COALESCE(product_code, ''), points_earned, created_on
+		FROM transactions
+		WHERE user_id = $1
+		ORDER BY id LIMIT $2 OFFSET $3`
+	rows, err := db.connection.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch transactions: %v", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		var txn models.Transaction
+		err := rows.Scan(&txn.ID, &txn.TransactionID, &txn.UserID, &txn.TransactionAmount, &txn.Category,
+			&txn.TransactionDate, &txn.ProductCode, &txn.PointsEarned, &txn.CreatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan transaction: %v", err)
+		}
+		transactions = append(transactions, txn)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (db *PostgresDB) GetPointsBalance(ctx context.Context, userID int) (models.PointsBalance, error) {
 	var balance models.PointsBalance
 	query := `SELECT total_points, points_redeemed FROM points_balance WHERE user_id = $1`
-	err := db.connection.QueryRow(query, userID).Scan(&balance.TotalPoints, &balance.PointsRedeemed)
+	err := db.connection.QueryRowContext(ctx, query, userID).Scan(&balance.TotalPoints, &balance.PointsRedeemed)
 	if err == sql.ErrNoRows {
-		return balance, fmt.Errorf("User with ID %d has no points balance", userID)
+		return balance, fmt.Errorf("User with ID %d has %w", userID, ErrNoPointsBalance)
 	} else if err != nil {
 		return balance, err
 	}
 	return balance, nil
 }
 
-func (db *PostgresDB) GetPointsHistory(userID, page, limit int, startDate, endDate, transactionType string) ([]models.PointsHistory, error) {
+func (db *PostgresDB) GetPointsHistory(ctx context.Context, userID, page, limit int, startDate, endDate, transactionType string) ([]models.PointsHistory, error) {
 	offset := (page - 1) * limit
 
 	query := `SELECT points, points_type, reason, date FROM points_history 
               WHERE user_id = $1`
 	args := []interface{}{userID}
 
-	if startDate != "" {
+	// parsed here so every dialect compares timestamps rather than text
+	start, end, err := timeRange(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	if !start.IsZero() {
 		query += " AND date >= $" + fmt.Sprint(len(args)+1)
-		args = append(args, startDate)
+		args = append(args, start)
 	}
-	if endDate != "" {
+	if !end.IsZero() {
 		query += " AND date <= $" + fmt.Sprint(len(args)+1)
-		args = append(args, endDate)
+		args = append(args, end)
 	}
 	if transactionType != "" {
 		query += " AND points_type = $" + fmt.Sprint(len(args)+1)
 		args = append(args, transactionType)
 	}
 
-	query += " ORDER BY date DESC LIMIT $" + fmt.Sprint(len(args)+1) + " OFFSET $" + fmt.Sprint(len(args)+2)
+	// the id breaks ties so pages neither repeat nor skip entries written in the same instant
+	query += " ORDER BY date DESC, id DESC LIMIT $" + fmt.Sprint(len(args)+1) + " OFFSET $" + fmt.Sprint(len(args)+2)
 	args = append(args, limit, offset)
 
-	rows, err := db.connection.Query(query, args...)
+	rows, err := db.connection.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -216,88 +599,119 @@ func (db *PostgresDB) GetPointsHistory(userID, page, limit int, startDate, endDa
 	return history, nil
 }
 
-func (db *PostgresDB) GetAvailablePoints(userID int) (int, error) {
-	var totalPoints int
-	query := `
-		SELECT COALESCE(SUM(points), 0) 
-		FROM points_history 
-		WHERE user_id = $1 AND points_type = 'earn' AND date >= NOW() - INTERVAL '1 year'`
-	err := db.connection.QueryRow(query, userID).Scan(&totalPoints)
-	if err != nil {
-		return 0, fmt.Errorf("Failed to retrieve available points: %v", err)
-	}
-	return totalPoints, nil
-}
-
-func (db *PostgresDB) DeductPoints(userID int, pointsToRedeem int) (int, error) {
-	// Update points balance
-	updateBalanceQuery := `
-		UPDATE points_balance 
-		SET total_points = total_points - $1, points_redeemed = points_redeemed + $1 
-		WHERE user_id = $2 RETURNING total_points`
+func (db *PostgresDB) DeductPoints(ctx context.Context, userID int, pointsToRedeem int) (int, error) {
 	var remainingBalance int
-	err := db.connection.QueryRow(updateBalanceQuery, pointsToRedeem, userID).Scan(&remainingBalance)
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		before, exists, err := lockPointsBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("User with ID %d has %w", userID, ErrNoPointsBalance)
+		}
+		if before.TotalPoints < pointsToRedeem {
+			return ErrInsufficientPoints
+		}
+
+		// Update points balance
+		updateBalanceQuery := `
+			UPDATE points_balance 
+			SET total_points = total_points - $1, points_redeemed = points_redeemed + $1 
+			WHERE user_id = $2 RETURNING total_points`
+		err = tx.QueryRowContext(ctx, updateBalanceQuery, pointsToRedeem, userID).Scan(&remainingBalance)
+		if err != nil {
+			return fmt.Errorf("Failed to update points balance: %v", err)
+		}
+
+		err = appendPointsEvent(ctx, tx, userID, models.PointsEventRedeemed, pointsToRedeem, "", "Points redeemed for discount")
+		if err != nil {
+			return err
+		}
+		if err := logPointsHistory(ctx, tx, userID, "", pointsToRedeem, "redeem", "Points redeemed for discount"); err != nil {
+			return err
+		}
+
+		if err := touchActivity(ctx, tx, userID, time.Now()); err != nil {
+			return err
+		}
+
+		after := models.PointsBalance{TotalPoints: remainingBalance, PointsRedeemed: before.PointsRedeemed + pointsToRedeem}
+		return db.recordAudit(ctx, tx, "points.redeem", "points_balance", userID, userID, before, after)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("Failed to update points balance: %v", err)
+		return 0, err
 	}
 	return remainingBalance, nil
 }
 
-func (db *PostgresDB) LogPointsHistory(userID int, points int, pointsType string, reason string) error {
+func (db *PostgresDB) LogPointsHistory(ctx context.Context, userID int, points int, pointsType string, reason string) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		if err := logPointsHistory(ctx, tx, userID, "", points, pointsType, reason); err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, "points_history.log", "points_history", userID, userID, nil, map[string]interface{}{
+			"points":      points,
+			"points_type": pointsType,
+			"reason":      reason,
+		})
+	})
+}
+
+func logPointsHistory(ctx context.Context, q queryer, userID int, transactionID string, points int, pointsType string, reason string) error {
 	pointsHistoryQuery := `
-		INSERT INTO points_history (user_id, points, points_type, reason, date)
-		VALUES ($1, $2, $3, $4, $5)`
-	_, err := db.connection.Exec(pointsHistoryQuery, userID, points, pointsType, reason, time.Now())
+		INSERT INTO points_history (user_id, transaction_id, points, points_type, reason, date)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := q.ExecContext(ctx, pointsHistoryQuery, userID, sql.NullString{String: transactionID, Valid: transactionID != ""}, points, pointsType, reason, time.Now())
 	if err != nil {
 		return fmt.Errorf("Failed to log points history: %v", err)
 	}
 	return nil
 }
 
-func (db *PostgresDB) TransactionOlderThanGivenTime(timePeriod time.Time) ([]models.Transaction, error) {
-	// Prepare a slice to store the transactions
-	var transactions []models.Transaction
-
-	rows, err := db.connection.Query(`
-		SELECT user_id, transaction_id, points_earned, transaction_date 
-		FROM transactions
-		WHERE transaction_date <= $1 AND points_earned > 0
-	`, timePeriod)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch transactions: %v", err)
-	}
-	defer rows.Close()
+func (db *PostgresDB) ExpirePoints(ctx context.Context, userId int, transactionID string, pointsEarned int, transactionDate time.Time) error {
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		before, _, err := lockPointsBalance(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
 
-	for rows.Next() {
-		var txn models.Transaction
-		err := rows.Scan(&txn.UserID, &txn.TransactionID, &txn.PointsEarned, &txn.TransactionDate)
+		// a transaction is only ever expired once, whichever path gets to it first
+		result, err := tx.ExecContext(ctx, `UPDATE transactions SET expired_on = $1 WHERE transaction_id = $2 AND expired_on IS NULL`, time.Now(), transactionID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan transaction: %v", err)
+			return fmt.Errorf("Failed to mark transaction expired: %v", err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return errAlreadyExpired
 		}
 
-		transactions = append(transactions, txn)
-	}
+		_, err = tx.ExecContext(ctx, `
+		UPDATE points_balance 
+		SET total_points = total_points - $1 
+		WHERE user_id = $2
+	`, pointsEarned, userId)
+		if err != nil {
+			return fmt.Errorf("failed to update points balance: %v", err)
+		}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error : %v", err)
-	}
+		err = appendPointsEvent(ctx, tx, userId, models.PointsEventExpired, pointsEarned, transactionID, expiryReason)
+		if err != nil {
+			return err
+		}
 
-	return transactions, nil
-}
+		err = logPointsHistory(ctx, tx, userId, transactionID, pointsEarned, "expired", expiryReason)
+		if err != nil {
+			return fmt.Errorf("Failed to log points history: %v", err)
+		}
 
-func (db *PostgresDB) ExpirePoints(userId int, transactionID string, pointsEarned int, transactionDate time.Time) error {
-	_, err := db.connection.Exec(`
-	UPDATE points_balance 
-	SET total_points = total_points - $1 
-	WHERE user_id = $2
-`, pointsEarned, userId)
-	if err != nil {
-		return fmt.Errorf("failed to update points balance: %v", err)
+		after := before
+		after.TotalPoints -= pointsEarned
+		return db.recordAudit(ctx, tx, "points.expire", "points_balance", userId, userId, before, after)
+	})
+	if err == errAlreadyExpired {
+		return nil
 	}
-
-	err = db.LogPointsHistory(userId, pointsEarned, "expired", "Point expired due to inactivity")
 	if err != nil {
-		return fmt.Errorf("Failed to log points history: %v", err)
+		return err
 	}
 
 	fmt.Printf("Expired %d points for user %d, transaction %s.\n", pointsEarned, userId, transactionID)
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// auditChainLockKey with the chain number serializes the audit inserts of a chain so it stays linear
+const auditChainLockKey = 7305241
+
+// WithAuditMeta returns a handle whose writes are attributed to the given actor and request
+func (db *PostgresDB) WithAuditMeta(meta models.AuditMeta) Database {
+	scoped := *db
+	scoped.audit = meta
+	return &scoped
+}
+
+// recordAudit appends an audit event inside the caller's transaction
+func (db *PostgresDB) recordAudit(ctx context.Context, tx *sql.Tx, action, targetType string, targetID interface{}, userID int, before, after interface{}) error {
+	event, err := newAuditEvent(db.audit, action, targetType, targetID, userID, before, after)
+	if err != nil {
+		return err
+	}
+
+	if err := db.lockAuditChains(ctx, tx, event.UserID); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log WHERE chain = $1 ORDER BY id DESC LIMIT 1`, event.Chain).Scan(&event.PrevHash)
+	if err == sql.ErrNoRows {
+		event.PrevHash = auditGenesisHash
+	} else if err != nil {
+		return fmt.Errorf("failed to read audit chain: %v", err)
+	}
+	event.Hash = auditHash(event)
+
+	query := `
+		INSERT INTO audit_log (actor, action, target_type, target_id, user_id, before_value, after_value, request_id, created_on, chain, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err = tx.ExecContext(ctx, query, event.Actor, event.Action, event.TargetType, event.TargetID, nullInt(event.UserID),
+		nullJSON(event.Before), nullJSON(event.After), event.RequestID, event.CreatedOn, event.Chain, event.PrevHash, event.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %v", err)
+	}
+	return nil
+}
+
+// lockAuditChains holds the chains of the given users until the transaction ends. A transaction
+// auditing several users takes their chains up front, in order, before its first recordAudit, so
+// two of them never wait on each other's chains. A SQLite transaction already holds the write lock
+// of the whole database.
+func (db *PostgresDB) lockAuditChains(ctx context.Context, tx *sql.Tx, userIDs ...int) error {
+	if db.dialect != postgresDialect {
+		return nil
+	}
+	chains := map[int]bool{}
+	for _, userID := range userIDs {
+		chains[auditChain(userID)] = true
+	}
+	for _, chain := range sortedKeys(chains) {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, auditChainLockKey, chain); err != nil {
+			return fmt.Errorf("failed to lock audit log: %v", err)
+		}
+	}
+	return nil
+}
+
+func (db *PostgresDB) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	query := `SELECT id, actor, action, target_type, target_id, user_id, before_value, after_value, request_id, created_on, chain, prev_hash, hash
+              FROM audit_log WHERE 1 = 1`
+	args := []interface{}{}
+
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		query += fmt.Sprintf(" AND %s $%d", condition, len(args))
+	}
+	if filter.Actor != "" {
+		addFilter("actor =", filter.Actor)
+	}
+	if filter.Action != "" {
+		addFilter("action =", filter.Action)
+	}
+	if filter.TargetType != "" {
+		addFilter("target_type =", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		addFilter("target_id =", filter.TargetID)
+	}
+	if filter.UserID != 0 {
+		addFilter("user_id =", filter.UserID)
+	}
+	if filter.RequestID != "" {
+		addFilter("request_id =", filter.RequestID)
+	}
+	start, end, err := timeRange(filter.StartDate, filter.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch audit events: %v", err)
+	}
+	if !start.IsZero() {
+		addFilter("created_on >=", start)
+	}
+	if !end.IsZero() {
+		addFilter("created_on <=", end)
+	}
+
+	query += " ORDER BY id"
+	if filter.PageSize > 0 {
+		page := filter.Page
+		if page < 1 {
+			page = 1
+		}
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+		args = append(args, filter.PageSize, (page-1)*filter.PageSize)
+	}
+
+	rows, err := db.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch audit events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// VerifyAuditChain recomputes every hash in the audit log, page by page
+func (db *PostgresDB) VerifyAuditChain(ctx context.Context) (*models.AuditVerification, error) {
+	const pageSize = 1000
+
+	result := &models.AuditVerification{Valid: true}
+	heads := map[int]string{}
+	var lastID int64
+
+	for {
+		rows, err := db.connection.QueryContext(ctx, `
+			SELECT id, actor, action, target_type, target_id, user_id, before_value, after_value, request_id, created_on, chain, prev_hash, hash
+			FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`, lastID, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to fetch audit events: %v", err)
+		}
+
+		var events []models.AuditEvent
+		for rows.Next() {
+			event, err := scanAuditEvent(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		verifyAuditChain(events, heads, result)
+		if !result.Valid || len(events) < pageSize {
+			return result, nil
+		}
+		lastID = events[len(events)-1].ID
+	}
+}
+
+func scanAuditEvent(rows *sql.Rows) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	var userID sql.NullInt64
+	var requestID sql.NullString
+	var before, after []byte
+	err := rows.Scan(&event.ID, &event.Actor, &event.Action, &event.TargetType, &event.TargetID, &userID,
+		&before, &after, &requestID, &event.CreatedOn, &event.Chain, &event.PrevHash, &event.Hash)
+	if err != nil {
+		return event, fmt.Errorf("Failed to scan audit event: %v", err)
+	}
+	event.UserID = int(userID.Int64)
+	event.RequestID = requestID.String
+	event.Before = before
+	event.After = after
+	return event, nil
+}
+
+func nullInt(value int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(value), Valid: value != 0}
+}
+
+func nullJSON(value []byte) interface{} {
+	if value == nil {
+		return nil
+	}
+	return string(value)
+}
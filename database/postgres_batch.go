@@ -0,0 +1,415 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lib/pq"
+)
+
+// batchInsertChunk keeps multi-row inserts well under the 65535 bind parameter limit
+const batchInsertChunk = 500
+
+const earnReason = "Points earned for transaction"
+
+// AddTransactionsBatch records many transactions in one database transaction: a multi-row insert
+// for the transactions, COPY for history, ledger and outbox rows, and one balance update per user.
+// Items for unknown users or already recorded transaction IDs are reported and skipped.
+func (db *PostgresDB) AddTransactionsBatch(ctx context.Context, txns []models.Transaction) ([]models.BatchTransactionResult, error) {
+	results := make([]models.BatchTransactionResult, len(txns))
+	if len(txns) == 0 {
+		return results, nil
+	}
+
+	userIDs := map[int]bool{}
+	suppliedIDs := []string{}
+	for _, txn := range txns {
+		userIDs[txn.UserID] = true
+		if txn.TransactionID != "" {
+			suppliedIDs = append(suppliedIDs, txn.TransactionID)
+		}
+	}
+
+	activeUsers, err := db.activeUserIDs(ctx, sortedKeys(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := db.recordedTransactionIDs(ctx, suppliedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pending := []int{}
+	seen := map[string]bool{}
+	for i := range txns {
+		txn := &txns[i]
+		results[i].Index = i
+
+		if !activeUsers[txn.UserID] {
+			results[i].Status = models.BatchItemInvalid
+			results[i].Error = fmt.Sprintf("User with ID %d does not exist", txn.UserID)
+			continue
+		}
+		if txn.TransactionID == "" {
+			txn.TransactionID = uuid.New().String()
+		} else if recorded[txn.TransactionID] || seen[txn.TransactionID] {
+			results[i].Status = models.BatchItemDuplicate
+			results[i].TransactionID = txn.TransactionID
+			continue
+		}
+		seen[txn.TransactionID] = true
+
+		if txn.TransactionDate.IsZero() {
+			txn.TransactionDate = now
+		}
+		txn.PointsEarned = int(txn.TransactionAmount) * utils.GetCategoryMultiplier(txn.Category)
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	err = db.withTx(ctx, func(tx *sql.Tx) error {
+		pendingUsers := map[int]bool{}
+		for _, i := range pending {
+			pendingUsers[txns[i].UserID] = true
+		}
+		// a missing balance row cannot be locked, it is created first so that a concurrent batch
+		// for the same user waits here instead of overwriting the balance written by this one
+		if err := createPointsBalances(ctx, tx, sortedKeys(pendingUsers)); err != nil {
+			return err
+		}
+		balances, err := lockPointsBalances(ctx, tx, sortedKeys(pendingUsers))
+		if err != nil {
+			return err
+		}
+
+		inserted, err := insertTransactionRows(ctx, tx, txns, pending)
+		if err != nil {
+			return err
+		}
+
+		// a concurrent writer may have recorded the same ID since it was checked
+		created := make([]int, 0, len(pending))
+		for _, i := range pending {
+			if id, ok := inserted[txns[i].TransactionID]; ok {
+				txns[i].ID = id
+				created = append(created, i)
+			} else {
+				results[i].Status = models.BatchItemDuplicate
+				results[i].TransactionID = txns[i].TransactionID
+			}
+		}
+		if len(created) == 0 {
+			return nil
+		}
+
+		before := map[int]models.PointsBalance{}
+		for userID, balance := range balances {
+			before[userID] = balance
+		}
+		events := make([]models.DomainEvent, 0, len(created))
+		for _, i := range created {
+			txn := txns[i]
+			balance := balances[txn.UserID]
+			balance.TotalPoints += txn.PointsEarned
+			balances[txn.UserID] = balance
+
+			events = append(events, models.DomainEvent{
+				ID:            uuid.New().String(),
+				Type:          "points." + models.PointsEventEarned,
+				UserID:        txn.UserID,
+				Points:        txn.PointsEarned,
+				TransactionID: txn.TransactionID,
+				Merchant:      txn.Category,
+				Reason:        earnReason,
+				Balance:       balance,
+				OccurredOn:    now.UTC(),
+			})
+		}
+
+		if err := db.copyEarnRows(ctx, tx, txns, created, events, now); err != nil {
+			return err
+		}
+		if err := upsertBalances(ctx, tx, balances); err != nil {
+			return err
+		}
+
+		activity := map[int]time.Time{}
+		for _, i := range created {
+			if txn := txns[i]; txn.TransactionDate.After(activity[txn.UserID]) {
+				activity[txn.UserID] = txn.TransactionDate
+			}
+		}
+		for _, userID := range sortedKeys(activity) {
+			if err := touchActivity(ctx, tx, userID, activity[userID]); err != nil {
+				return err
+			}
+		}
+
+		if err := db.lockAuditChains(ctx, tx, append(sortedKeys(balances), 0)...); err != nil {
+			return err
+		}
+		for _, userID := range sortedKeys(balances) {
+			if before[userID] == balances[userID] {
+				continue
+			}
+			if err := db.recordAudit(ctx, tx, "points.earn_batch", "points_balance", userID, userID, before[userID], balances[userID]); err != nil {
+				return err
+			}
+		}
+		return db.recordAudit(ctx, tx, "transaction.add_batch", "transaction_batch", events[0].TransactionID, 0, nil, map[string]int{
+			"transactions": len(created),
+			"users":        len(pendingUsers),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range pending {
+		if results[i].Status == "" {
+			results[i].Status = models.BatchItemCreated
+			results[i].TransactionID = txns[i].TransactionID
+			results[i].PointsEarned = txns[i].PointsEarned
+		}
+	}
+	return results, nil
+}
+
+func (db *PostgresDB) activeUserIDs(ctx context.Context, userIDs []int) (map[int]bool, error) {
+	rows, err := db.connection.QueryContext(ctx, `SELECT id FROM users WHERE id = ANY($1) AND closed_on IS NULL`, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check if users exist: %v", err)
+	}
+	defer rows.Close()
+
+	active := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		active[id] = true
+	}
+	return active, rows.Err()
+}
+
+func (db *PostgresDB) recordedTransactionIDs(ctx context.Context, transactionIDs []string) (map[string]bool, error) {
+	recorded := map[string]bool{}
+	if len(transactionIDs) == 0 {
+		return recorded, nil
+	}
+
+	rows, err := db.connection.QueryContext(ctx, `SELECT transaction_id FROM transactions WHERE transaction_id = ANY($1)`, pq.Array(transactionIDs))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check transactions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		recorded[id] = true
+	}
+	return recorded, rows.Err()
+}
+
+// lockPointsBalances locks the balance rows of the users, in user order to avoid deadlocks
+func lockPointsBalances(ctx context.Context, tx *sql.Tx, userIDs []int) (map[int]models.PointsBalance, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, total_points, points_redeemed FROM points_balance
+		WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE`, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock points balances: %v", err)
+	}
+	defer rows.Close()
+
+	balances := make(map[int]models.PointsBalance, len(userIDs))
+	for _, userID := range userIDs {
+		balances[userID] = models.PointsBalance{}
+	}
+	for rows.Next() {
+		var userID int
+		var balance models.PointsBalance
+		if err := rows.Scan(&userID, &balance.TotalPoints, &balance.PointsRedeemed); err != nil {
+			return nil, err
+		}
+		balances[userID] = balance
+	}
+	return balances, rows.Err()
+}
+
+// createPointsBalances adds an empty balance row for each user that has none yet
+func createPointsBalances(ctx context.Context, tx *sql.Tx, userIDs []int) error {
+	values := make([]string, len(userIDs))
+	args := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		values[i] = fmt.Sprintf("($%d)", i+1)
+		args[i] = userID
+	}
+
+	query := `INSERT INTO points_balance (user_id) VALUES ` + strings.Join(values, ", ") + ` ON CONFLICT (user_id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("Failed to create points balances: %v", err)
+	}
+	return nil
+}
+
+// insertTransactionRows inserts in chunks and returns the database ID of every row that was inserted
+func insertTransactionRows(ctx context.Context, tx *sql.Tx, txns []models.Transaction, indexes []int) (map[string]int, error) {
+	inserted := make(map[string]int, len(indexes))
+	for start := 0; start < len(indexes); start += batchInsertChunk {
+		end := start + batchInsertChunk
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*7)
+		for _, i := range indexes[start:end] {
+			txn := txns[i]
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, txn.TransactionID, txn.UserID, txn.TransactionAmount, txn.Category, txn.TransactionDate, txn.ProductCode, txn.PointsEarned)
+		}
+
+		query := `INSERT INTO transactions (transaction_id, user_id, transaction_amount, category, transaction_date, product_code, points_earned)
+			VALUES ` + strings.Join(values, ", ") + `
+			ON CONFLICT (transaction_id) DO NOTHING
+			RETURNING transaction_id, id`
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to insert transactions: %v", err)
+		}
+		for rows.Next() {
+			var transactionID string
+			var id int
+			if err := rows.Scan(&transactionID, &id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			inserted[transactionID] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return inserted, nil
+}
+
+// copyEarnRows streams the history, ledger and outbox rows of the created transactions with COPY
+func (db *PostgresDB) copyEarnRows(ctx context.Context, tx *sql.Tx, txns []models.Transaction, created []int, events []models.DomainEvent, now time.Time) error {
+	err := db.copyRows(ctx, tx, "points_history", []string{"user_id", "transaction_id", "points", "points_type", "reason", "date"}, len(created),
+		func(n int) []interface{} {
+			txn := txns[created[n]]
+			return []interface{}{txn.UserID, txn.TransactionID, txn.PointsEarned, "earn", earnReason, now}
+		})
+	if err != nil {
+		return err
+	}
+
+	err = db.copyRows(ctx, tx, "points_events", []string{"user_id", "event_type", "points", "transaction_id", "reason", "created_on"}, len(created),
+		func(n int) []interface{} {
+			txn := txns[created[n]]
+			return []interface{}{txn.UserID, models.PointsEventEarned, txn.PointsEarned, txn.TransactionID, earnReason, now}
+		})
+	if err != nil {
+		return err
+	}
+
+	payloads := make([]string, len(events))
+	for n, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("Failed to encode outbox event: %v", err)
+		}
+		payloads[n] = string(payload)
+	}
+	return db.copyRows(ctx, tx, "outbox_events", []string{"event_id", "event_type", "user_id", "payload", "created_on"}, len(events),
+		func(n int) []interface{} {
+			return []interface{}{events[n].ID, events[n].Type, events[n].UserID, payloads[n], events[n].OccurredOn}
+		})
+}
+
+// copyRows uses COPY on Postgres, SQLite has no COPY and gets one prepared insert per row
+func (db *PostgresDB) copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, count int, row func(n int) []interface{}) error {
+	if db.dialect == sqliteDialect {
+		return insertRows(ctx, tx, table, columns, count, row)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return fmt.Errorf("Failed to start copy into %s: %v", table, err)
+	}
+	defer stmt.Close()
+
+	for n := 0; n < count; n++ {
+		if _, err := stmt.ExecContext(ctx, row(n)...); err != nil {
+			return fmt.Errorf("Failed to copy into %s: %v", table, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("Failed to finish copy into %s: %v", table, err)
+	}
+	return nil
+}
+
+func insertRows(ctx context.Context, tx *sql.Tx, table string, columns []string, count int, row func(n int) []interface{}) error {
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return fmt.Errorf("Failed to prepare insert into %s: %v", table, err)
+	}
+	defer stmt.Close()
+
+	for n := 0; n < count; n++ {
+		if _, err := stmt.ExecContext(ctx, row(n)...); err != nil {
+			return fmt.Errorf("Failed to insert into %s: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// upsertBalances writes the final balance of every user with a single statement
+func upsertBalances(ctx context.Context, tx *sql.Tx, balances map[int]models.PointsBalance) error {
+	values := make([]string, 0, len(balances))
+	args := make([]interface{}, 0, len(balances)*3)
+	for _, userID := range sortedKeys(balances) {
+		balance := balances[userID]
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+		args = append(args, userID, balance.TotalPoints, balance.PointsRedeemed)
+	}
+
+	query := `INSERT INTO points_balance (user_id, total_points, points_redeemed) VALUES ` + strings.Join(values, ", ") + `
+		ON CONFLICT (user_id) DO UPDATE SET total_points = EXCLUDED.total_points, points_redeemed = EXCLUDED.points_redeemed`
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("Failed to update points balances: %v", err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lib/pq"
+)
+
+const expiryReason = "Points expired"
+
+// errAlreadyExpired rolls back an expiry that lost the race to another one
+var errAlreadyExpired = errors.New("transaction already expired")
+
+// touchActivity resets a user's inactivity clock to at, it never moves the clock backwards so a
+// backdated purchase does not count as recent activity. A purchase dated in the future counts as
+// activity now, otherwise it would keep the account active until that date.
+func touchActivity(ctx context.Context, tx *sql.Tx, userID int, at time.Time) error {
+	if now := time.Now(); at.After(now) {
+		at = now
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE users SET last_activity_on = $1 WHERE id = $2 AND (last_activity_on IS NULL OR last_activity_on < $1)`, at, userID)
+	if err != nil {
+		return fmt.Errorf("Failed to record activity: %v", err)
+	}
+	return nil
+}
+
+// GetExpiryCandidates returns up to limit earning transactions of open accounts, of one user or of
+// every user when userID is 0, whose points were neither expired nor refunded, in
+// (transaction_date, id) order after the given cursor. A transaction is returned when it was made
+// on or before cutoff, or on or before idleCutoff by a user idle since then; a zero cutoff
+// matches nothing.
+func (db *PostgresDB) GetExpiryCandidates(ctx context.Context, userID int, cutoff, idleCutoff time.Time, cursorDate time.Time, cursorID int, limit int) ([]models.ExpiryCandidate, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT t.id, t.transaction_id, t.user_id, t.transaction_amount, t.category, t.transaction_date,
+			COALESCE(t.product_code, ''), t.points_earned, t.created_on, u.tier, u.last_activity_on, u.created_on
+		FROM transactions t
+		JOIN users u ON u.id = t.user_id
+		WHERE ($1 = 0 OR t.user_id = $1) AND u.closed_on IS NULL
+			AND t.expired_on IS NULL AND t.refunded_on IS NULL AND t.points_earned > 0
+			AND (t.transaction_date <= $2
+				OR (t.transaction_date <= $3 AND COALESCE(u.last_activity_on, u.created_on) <= $3))
+			AND (t.transaction_date, t.id) > ($4, $5)
+		ORDER BY t.transaction_date, t.id
+		LIMIT $6`, userID, cutoff, idleCutoff, cursorDate, cursorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch expiry candidates: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []models.ExpiryCandidate
+	for rows.Next() {
+		var c models.ExpiryCandidate
+		var lastActivityOn sql.NullTime
+		err := rows.Scan(&c.ID, &c.TransactionID, &c.UserID, &c.TransactionAmount, &c.Category, &c.TransactionDate,
+			&c.ProductCode, &c.PointsEarned, &c.CreatedOn, &c.Tier, &lastActivityOn, &c.LastActivityOn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan expiry candidate: %v", err)
+		}
+		// a user who never bought anything has been idle since signing up
+		if lastActivityOn.Valid {
+			c.LastActivityOn = lastActivityOn.Time
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// ExpireTransactions expires a batch of transactions and saves checkpoint in one database
+// transaction, so after a crash either both are there or neither is. A transaction that was
+// expired already is skipped. It returns how many transactions and points were expired.
+func (db *PostgresDB) ExpireTransactions(ctx context.Context, txns []models.ExpiryCandidate, checkpoint models.JobCheckpoint) (int, int, error) {
+	expired, points := 0, 0
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		expired, points = 0, 0
+
+		users := map[int]bool{}
+		for _, txn := range txns {
+			users[txn.UserID] = true
+		}
+		userIDs := sortedKeys(users)
+		before, err := lockPointsBalances(ctx, tx, userIDs)
+		if err != nil {
+			return err
+		}
+
+		deducted := map[int]int{}
+		now := time.Now()
+		for _, txn := range txns {
+			result, err := tx.ExecContext(ctx, `UPDATE transactions SET expired_on = $1 WHERE id = $2 AND expired_on IS NULL AND refunded_on IS NULL`, now, txn.ID)
+			if err != nil {
+				return fmt.Errorf("Failed to mark transaction expired: %v", err)
+			}
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				continue
+			}
+
+			reason := txn.ExpiryReason
+			if reason == "" {
+				reason = expiryReason
+			}
+			if err := appendPointsEvent(ctx, tx, txn.UserID, models.PointsEventExpired, txn.PointsEarned, txn.TransactionID, reason); err != nil {
+				return err
+			}
+			if err := logPointsHistory(ctx, tx, txn.UserID, txn.TransactionID, txn.PointsEarned, "expired", reason); err != nil {
+				return fmt.Errorf("Failed to log points history: %v", err)
+			}
+			deducted[txn.UserID] += txn.PointsEarned
+			expired++
+			points += txn.PointsEarned
+		}
+
+		if err := db.lockAuditChains(ctx, tx, userIDs...); err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if deducted[userID] == 0 {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `UPDATE points_balance SET total_points = total_points - $1 WHERE user_id = $2`, deducted[userID], userID)
+			if err != nil {
+				return fmt.Errorf("failed to update points balance: %v", err)
+			}
+
+			after := before[userID]
+			after.TotalPoints -= deducted[userID]
+			if err := db.recordAudit(ctx, tx, "points.expire", "points_balance", userID, userID, before[userID], after); err != nil {
+				return err
+			}
+		}
+
+		return saveJobCheckpoint(ctx, tx, checkpoint)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return expired, points, nil
+}
+
+// GetJobCheckpoint returns the last saved checkpoint of a job, nil when it never saved one
+func (db *PostgresDB) GetJobCheckpoint(ctx context.Context, job string) (*models.JobCheckpoint, error) {
+	var cp models.JobCheckpoint
+	var completedOn sql.NullTime
+	err := db.connection.QueryRowContext(ctx, `
+		SELECT job_name, cutoff, cursor_date, cursor_id, processed, started_on, updated_on, completed_on
+		FROM job_checkpoints WHERE job_name = $1`, job).
+		Scan(&cp.Job, &cp.Cutoff, &cp.CursorDate, &cp.CursorID, &cp.Processed, &cp.StartedOn, &cp.UpdatedOn, &completedOn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch checkpoint of job %s: %v", job, err)
+	}
+	if completedOn.Valid {
+		cp.CompletedOn = &completedOn.Time
+	}
+	return &cp, nil
+}
+
+func (db *PostgresDB) SaveJobCheckpoint(ctx context.Context, checkpoint models.JobCheckpoint) error {
+	return saveJobCheckpoint(ctx, db.connection, checkpoint)
+}
+
+func saveJobCheckpoint(ctx context.Context, q queryer, cp models.JobCheckpoint) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO job_checkpoints (job_name, cutoff, cursor_date, cursor_id, processed, started_on, updated_on, completed_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (job_name) DO UPDATE SET
+			cutoff = EXCLUDED.cutoff, cursor_date = EXCLUDED.cursor_date, cursor_id = EXCLUDED.cursor_id,
+			processed = EXCLUDED.processed, started_on = EXCLUDED.started_on,
+			updated_on = EXCLUDED.updated_on, completed_on = EXCLUDED.completed_on`,
+		cp.Job, cp.Cutoff, cp.CursorDate, cp.CursorID, cp.Processed, cp.StartedOn, time.Now(), cp.CompletedOn)
+	if err != nil {
+		return fmt.Errorf("Failed to save checkpoint of job %s: %v", cp.Job, err)
+	}
+	return nil
+}
+
+// RecordExpiryWarnings stores warnings that do not exist yet for their lot and window and returns
+// how many were new, so a lot is only ever warned about once per window
+func (db *PostgresDB) RecordExpiryWarnings(ctx context.Context, warnings []models.ExpiryWarning) (int, error) {
+	query := `
+		INSERT INTO expiry_warnings (user_id, transaction_id, window_days, points, expires_on, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (transaction_id, window_days) DO NOTHING`
+
+	recorded := 0
+	now := time.Now()
+	for _, warning := range warnings {
+		result, err := db.connection.ExecContext(ctx, query, warning.UserID, warning.TransactionID, warning.WindowDays, warning.Points, warning.ExpiresOn, now)
+		if err != nil {
+			return recorded, fmt.Errorf("Failed to record expiry warning: %v", err)
+		}
+		rowsAffected, _ := result.RowsAffected()
+		recorded += int(rowsAffected)
+	}
+	return recorded, nil
+}
+
+// GetPendingExpiryWarnings returns warnings that were not delivered yet, grouped by user
+func (db *PostgresDB) GetPendingExpiryWarnings(ctx context.Context, limit int) ([]models.ExpiryWarning, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT w.id, w.user_id, u.email, w.transaction_id, w.window_days, w.points, w.expires_on, w.created_on
+		FROM expiry_warnings w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.notified_on IS NULL AND u.closed_on IS NULL
+		ORDER BY w.user_id, w.window_days, w.expires_on, w.id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch expiry warnings: %v", err)
+	}
+	defer rows.Close()
+
+	var warnings []models.ExpiryWarning
+	for rows.Next() {
+		var w models.ExpiryWarning
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Email, &w.TransactionID, &w.WindowDays, &w.Points, &w.ExpiresOn, &w.CreatedOn); err != nil {
+			return nil, fmt.Errorf("Failed to scan expiry warning: %v", err)
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings, rows.Err()
+}
+
+func (db *PostgresDB) MarkExpiryWarningsNotified(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := db.connection.ExecContext(ctx, `UPDATE expiry_warnings SET notified_on = $1 WHERE id = ANY($2)`, time.Now(), pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("Failed to mark expiry warnings notified: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// appendPointsEvent adds an event to the ledger inside the caller's transaction, after the balance
+// was updated, and queues the matching domain event in the outbox.
+func appendPointsEvent(ctx context.Context, tx *sql.Tx, userID int, eventType string, points int, transactionID, reason string) error {
+	query := `
+		INSERT INTO points_events (user_id, event_type, points, transaction_id, reason)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, query, userID, eventType, points, sql.NullString{String: transactionID, Valid: transactionID != ""}, reason)
+	if err != nil {
+		return fmt.Errorf("Failed to append points event: %v", err)
+	}
+
+	return enqueueDomainEvent(ctx, tx, models.PointsEvent{
+		UserID:        userID,
+		EventType:     eventType,
+		Points:        points,
+		TransactionID: transactionID,
+		Reason:        reason,
+	})
+}
+
+func (db *PostgresDB) GetPointsEvents(ctx context.Context, userID int) ([]models.PointsEvent, error) {
+	query := `
+		SELECT id, user_id, event_type, points, COALESCE(transaction_id, ''), COALESCE(reason, ''), created_on
+		FROM points_events
+		WHERE user_id = $1
+		ORDER BY id`
+	rows, err := db.connection.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch points events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.PointsEvent
+	for rows.Next() {
+		var event models.PointsEvent
+		err := rows.Scan(&event.ID, &event.UserID, &event.EventType, &event.Points, &event.TransactionID, &event.Reason, &event.CreatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan points event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListLedgerUserIDs returns every user that has either ledger events or a stored balance
+func (db *PostgresDB) ListLedgerUserIDs(ctx context.Context) ([]int, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT user_id FROM points_events
+		UNION
+		SELECT user_id FROM points_balance
+		ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch ledger users: %v", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("Failed to scan ledger user: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// SetPointsBalance overwrites the stored projection, used when rebuilding from the ledger. The
+// balance is only written while it is still stored and the user's last event is still lastEventID,
+// otherwise the ledger moved on since it was replayed and ErrBalanceChanged is returned.
+func (db *PostgresDB) SetPointsBalance(ctx context.Context, userID int, stored models.PointsBalance, lastEventID int64, balance models.PointsBalance) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		before, _, err := lockPointsBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// every change to the balance appends its event while holding the balance row
+		var currentEventID int64
+		err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM points_events WHERE user_id = $1`, userID).Scan(&currentEventID)
+		if err != nil {
+			return fmt.Errorf("Failed to fetch points events: %v", err)
+		}
+		if before != stored || currentEventID != lastEventID {
+			return ErrBalanceChanged
+		}
+
+		query := `
+			INSERT INTO points_balance (user_id, total_points, points_redeemed) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET total_points = EXCLUDED.total_points, points_redeemed = EXCLUDED.points_redeemed`
+		if _, err := tx.ExecContext(ctx, query, userID, balance.TotalPoints, balance.PointsRedeemed); err != nil {
+			return fmt.Errorf("Failed to set points balance: %v", err)
+		}
+
+		return db.recordAudit(ctx, tx, "points.rebuild", "points_balance", userID, userID, before, balance)
+	})
+}
+
+// AdjustPoints applies a signed manual correction to a user's balance
+func (db *PostgresDB) AdjustPoints(ctx context.Context, userID int, points int, reason string) (models.PointsBalance, error) {
+	var after models.PointsBalance
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		before, exists, err := lockPointsBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			_, err = tx.ExecContext(ctx, `UPDATE points_balance SET total_points = total_points + $1 WHERE user_id = $2`, points, userID)
+		} else {
+			_, err = tx.ExecContext(ctx, `INSERT INTO points_balance (user_id, total_points) VALUES ($1, $2)`, userID, points)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to adjust points balance: %v", err)
+		}
+
+		if err := appendPointsEvent(ctx, tx, userID, models.PointsEventAdjusted, points, "", reason); err != nil {
+			return err
+		}
+		if err := logPointsHistory(ctx, tx, userID, "", points, "adjust", reason); err != nil {
+			return err
+		}
+
+		after = before
+		after.TotalPoints += points
+		return db.recordAudit(ctx, tx, "points.adjust", "points_balance", userID, userID, before, after)
+	})
+	return after, err
+}
+
+// RefundTransaction takes back the points earned on a refunded purchase
+func (db *PostgresDB) RefundTransaction(ctx context.Context, transactionID string, reason string) (*models.PointsEvent, error) {
+	event := &models.PointsEvent{EventType: models.PointsEventRefunded, TransactionID: transactionID, Reason: reason}
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var refundedOn sql.NullTime
+		err := tx.QueryRowContext(ctx, `SELECT user_id, points_earned, refunded_on FROM transactions WHERE transaction_id = $1 FOR UPDATE`, transactionID).
+			Scan(&event.UserID, &event.Points, &refundedOn)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("Transaction %s not found", transactionID)
+		} else if err != nil {
+			return fmt.Errorf("Failed to fetch transaction: %v", err)
+		}
+		if refundedOn.Valid {
+			return fmt.Errorf("Transaction %s is already refunded", transactionID)
+		}
+
+		before, _, err := lockPointsBalance(ctx, tx, event.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `UPDATE transactions SET refunded_on = NOW() WHERE transaction_id = $1 RETURNING refunded_on`, transactionID).
+			Scan(&event.CreatedOn)
+		if err != nil {
+			return fmt.Errorf("Failed to mark transaction refunded: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE points_balance SET total_points = total_points - $1 WHERE user_id = $2`, event.Points, event.UserID)
+		if err != nil {
+			return fmt.Errorf("Failed to update points balance: %v", err)
+		}
+
+		if err := appendPointsEvent(ctx, tx, event.UserID, models.PointsEventRefunded, event.Points, transactionID, reason); err != nil {
+			return err
+		}
+		if err := logPointsHistory(ctx, tx, event.UserID, transactionID, event.Points, "refund", reason); err != nil {
+			return err
+		}
+
+		after := before
+		after.TotalPoints -= event.Points
+		return db.recordAudit(ctx, tx, "transaction.refund", "transaction", transactionID, event.UserID, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// AdvisoryLocker is a Locker backed by a session level Postgres advisory lock. The lock belongs
+// to the session, so it is taken on a dedicated connection kept out of the pool for as long as
+// the lock is held; when the process or the connection dies Postgres releases it.
+type AdvisoryLocker struct {
+	db   *sql.DB
+	name string
+	key  int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+	held bool
+	// pid is the backend holding the lock, kept for Terminate
+	pid int
+}
+
+// NewLocker returns an advisory lock keyed by a hash of name, or a lease on SQLite
+func (db *PostgresDB) NewLocker(name string) Locker {
+	if db.dialect == sqliteDialect {
+		return newLeaseLocker(db.connection, name)
+	}
+	return &AdvisoryLocker{db: db.connection, name: name, key: advisoryLockKey(name)}
+}
+
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held {
+		return true, nil
+	}
+
+	if l.conn == nil {
+		conn, err := l.db.Conn(ctx)
+		if err != nil {
+			return false, fmt.Errorf("Failed to open lock connection: %v", err)
+		}
+		l.conn = conn
+	}
+
+	var acquired bool
+	if err := l.conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1), pg_backend_pid()`, l.key).Scan(&acquired, &l.pid); err != nil {
+		l.closeConn()
+		return false, fmt.Errorf("Failed to take lock %s: %v", l.name, err)
+	}
+	l.held = acquired
+	if !acquired {
+		// give the connection back until the next attempt
+		l.closeConn()
+	}
+	return acquired, nil
+}
+
+func (l *AdvisoryLocker) Check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+
+	if err := l.conn.PingContext(ctx); err != nil {
+		l.held = false
+		l.closeConn()
+		return fmt.Errorf("lost lock %s: %v", l.name, err)
+	}
+	return nil
+}
+
+func (l *AdvisoryLocker) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	_, err := l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key)
+	// closing the session releases the lock even if the unlock failed
+	l.closeConn()
+	if err != nil {
+		return fmt.Errorf("Failed to release lock %s: %v", l.name, err)
+	}
+	return nil
+}
+
+// Terminate ends the session holding the lock from another connection, the way the server sees a
+// holder that crashed. It is meant for failover drills such as the leader failover test.
+func (l *AdvisoryLocker) Terminate(ctx context.Context) error {
+	l.mu.Lock()
+	pid, held := l.pid, l.held
+	l.mu.Unlock()
+	if !held {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+
+	if _, err := l.db.ExecContext(ctx, `SELECT pg_terminate_backend($1)`, pid); err != nil {
+		return fmt.Errorf("Failed to terminate lock session %d: %v", pid, err)
+	}
+	return nil
+}
+
+func (l *AdvisoryLocker) closeConn() {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
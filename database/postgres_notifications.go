@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const defaultNotificationLocale = "en"
+
+// GetNotificationSettings returns a user's settings, a user who never saved any gets the defaults
+func (db *PostgresDB) GetNotificationSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	settings := models.NotificationSettings{UserID: userID, Locale: defaultNotificationLocale}
+	err := db.connection.QueryRowContext(ctx, `
+		SELECT locale, COALESCE(phone, ''), COALESCE(device_token, '')
+		FROM notification_settings WHERE user_id = $1`, userID).
+		Scan(&settings.Locale, &settings.Phone, &settings.DeviceToken)
+	if err != nil && err != sql.ErrNoRows {
+		return settings, fmt.Errorf("Failed to fetch notification settings: %v", err)
+	}
+	return settings, nil
+}
+
+func (db *PostgresDB) GetNotificationPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT user_id, channel, event_type, enabled FROM notification_preferences
+		WHERE user_id = $1 ORDER BY channel, event_type`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch notification preferences: %v", err)
+	}
+	defer rows.Close()
+
+	preferences := []models.NotificationPreference{}
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.UserID, &p.Channel, &p.EventType, &p.Enabled); err != nil {
+			return nil, fmt.Errorf("Failed to scan notification preference: %v", err)
+		}
+		preferences = append(preferences, p)
+	}
+	return preferences, rows.Err()
+}
+
+// UpdateNotificationPreferences stores the settings and upserts each preference, preferences that
+// are not given are left as they are
+func (db *PostgresDB) UpdateNotificationPreferences(ctx context.Context, settings models.NotificationSettings, preferences []models.NotificationPreference) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		before := models.NotificationSettings{UserID: settings.UserID}
+		err := tx.QueryRowContext(ctx, `SELECT locale, COALESCE(phone, ''), COALESCE(device_token, '') FROM notification_settings WHERE user_id = $1 FOR UPDATE`, settings.UserID).
+			Scan(&before.Locale, &before.Phone, &before.DeviceToken)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("Failed to fetch notification settings: %v", err)
+		}
+
+		if settings.Locale == "" {
+			settings.Locale = defaultNotificationLocale
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO notification_settings (user_id, locale, phone, device_token, updated_on)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+			ON CONFLICT (user_id) DO UPDATE
+			SET locale = EXCLUDED.locale, phone = EXCLUDED.phone, device_token = EXCLUDED.device_token, updated_on = EXCLUDED.updated_on`,
+			settings.UserID, settings.Locale, settings.Phone, settings.DeviceToken, time.Now())
+		if err != nil {
+			return fmt.Errorf("Failed to save notification settings: %v", err)
+		}
+
+		for _, p := range preferences {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO notification_preferences (user_id, channel, event_type, enabled, updated_on)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (user_id, channel, event_type) DO UPDATE
+				SET enabled = EXCLUDED.enabled, updated_on = EXCLUDED.updated_on`,
+				settings.UserID, p.Channel, p.EventType, p.Enabled, time.Now())
+			if err != nil {
+				return fmt.Errorf("Failed to save notification preference: %v", err)
+			}
+		}
+
+		return db.recordAudit(ctx, tx, "notification.preferences", "notification_settings", settings.UserID, settings.UserID, auditNotificationSettings(before), map[string]interface{}{
+			"settings":    auditNotificationSettings(settings),
+			"preferences": preferences,
+		})
+	})
+}
+
+func (db *PostgresDB) LogNotificationDelivery(ctx context.Context, delivery models.NotificationDelivery) error {
+	_, err := db.connection.ExecContext(ctx, `
+		INSERT INTO notification_deliveries (notification_id, user_id, event_type, channel, recipient, subject, status, error, created_on)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), $9)`,
+		delivery.NotificationID, delivery.UserID, delivery.EventType, delivery.Channel, delivery.Recipient,
+		delivery.Subject, delivery.Status, delivery.Error, time.Now())
+	if err != nil {
+		return fmt.Errorf("Failed to log notification delivery: %v", err)
+	}
+	return nil
+}
+
+// GetNotificationDeliveries pages through the delivery log of a user, newest first, or of every user when userID is 0
+func (db *PostgresDB) GetNotificationDeliveries(ctx context.Context, userID, page, limit int) ([]models.NotificationDelivery, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT id, notification_id, COALESCE(user_id, 0), event_type, channel, COALESCE(recipient, ''),
+			COALESCE(subject, ''), status, COALESCE(error, ''), created_on
+		FROM notification_deliveries
+		WHERE ($1 = 0 OR user_id = $1)
+		ORDER BY id DESC LIMIT $2 OFFSET $3`, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch notification deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var d models.NotificationDelivery
+		err := rows.Scan(&d.ID, &d.NotificationID, &d.UserID, &d.EventType, &d.Channel, &d.Recipient,
+			&d.Subject, &d.Status, &d.Error, &d.CreatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan notification delivery: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
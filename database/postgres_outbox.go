@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lib/pq"
+)
+
+// enqueueDomainEvent writes the domain event for a ledger entry into the outbox, in the same
+// transaction as the balance change so an event exists if and only if the change committed
+func enqueueDomainEvent(ctx context.Context, tx *sql.Tx, pointsEvent models.PointsEvent) error {
+	event := models.DomainEvent{
+		ID:            uuid.New().String(),
+		Type:          "points." + pointsEvent.EventType,
+		UserID:        pointsEvent.UserID,
+		Points:        pointsEvent.Points,
+		TransactionID: pointsEvent.TransactionID,
+		Reason:        pointsEvent.Reason,
+		OccurredOn:    time.Now().UTC(),
+	}
+
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(total_points, 0), COALESCE(points_redeemed, 0) FROM points_balance WHERE user_id = $1`, event.UserID).
+		Scan(&event.Balance.TotalPoints, &event.Balance.PointsRedeemed)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Failed to read balance for outbox event: %v", err)
+	}
+
+	// the purchase category identifies the merchant
+	if event.TransactionID != "" {
+		err = tx.QueryRowContext(ctx, `SELECT category FROM transactions WHERE transaction_id = $1`, event.TransactionID).Scan(&event.Merchant)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("Failed to read merchant for outbox event: %v", err)
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Failed to encode outbox event: %v", err)
+	}
+
+	query := `INSERT INTO outbox_events (event_id, event_type, user_id, payload, created_on) VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, query, event.ID, event.Type, event.UserID, string(payload), event.OccurredOn)
+	if err != nil {
+		return fmt.Errorf("Failed to write outbox event: %v", err)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents returns the oldest events that were neither published nor given up on, and
+// that no other relay holds a claim on, claiming them for lease. Rows another relay is claiming at
+// the same moment are skipped rather than waited for.
+func (db *PostgresDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var events []models.OutboxEvent
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, payload, attempts, delivered_to FROM outbox_events
+			WHERE published_on IS NULL AND dead_on IS NULL AND (claimed_until IS NULL OR claimed_until < $1)
+			ORDER BY id LIMIT $2
+			FOR UPDATE SKIP LOCKED`, now, limit)
+		if err != nil {
+			return fmt.Errorf("Failed to fetch outbox events: %v", err)
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var event models.OutboxEvent
+			var payload []byte
+			var deliveredTo string
+			if err := rows.Scan(&event.ID, &payload, &event.Attempts, &deliveredTo); err != nil {
+				return fmt.Errorf("Failed to scan outbox event: %v", err)
+			}
+			if err := json.Unmarshal(payload, &event.Event); err != nil {
+				return fmt.Errorf("Failed to decode outbox event %d: %v", event.ID, err)
+			}
+			if deliveredTo != "" {
+				event.DeliveredTo = strings.Split(deliveredTo, ",")
+			}
+			events = append(events, event)
+			ids = append(ids, event.ID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE outbox_events SET claimed_until = $1 WHERE id = ANY($2)`, now.Add(lease), pq.Array(ids))
+		if err != nil {
+			return fmt.Errorf("Failed to claim outbox events: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkOutboxEventDelivered records that publisher took the event, so a retry skips it
+func (db *PostgresDB) MarkOutboxEventDelivered(ctx context.Context, id int64, publisher string) error {
+	_, err := db.connection.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET delivered_to = CASE WHEN delivered_to = '' THEN $1 ELSE delivered_to || ',' || $1 END
+		WHERE id = $2`, publisher, id)
+	if err != nil {
+		return fmt.Errorf("Failed to record outbox delivery: %v", err)
+	}
+	return nil
+}
+
+func (db *PostgresDB) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	_, err := db.connection.ExecContext(ctx, `
+		UPDATE outbox_events SET published_on = NOW(), attempts = attempts + 1, last_error = NULL, claimed_until = NULL
+		WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("Failed to mark outbox event published: %v", err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed attempt and releases the claim. Once maxAttempts were
+// made the event is given up on and true is returned.
+func (db *PostgresDB) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, maxAttempts int) (bool, error) {
+	var dead bool
+	err := db.connection.QueryRowContext(ctx, `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $1, claimed_until = NULL,
+			dead_on = CASE WHEN attempts + 1 >= $2 THEN NOW() END
+		WHERE id = $3
+		RETURNING dead_on IS NOT NULL`, reason, maxAttempts, id).Scan(&dead)
+	if err != nil {
+		return false, fmt.Errorf("Failed to record outbox failure: %v", err)
+	}
+	return dead, nil
+}
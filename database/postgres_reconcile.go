@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// GetBalanceSources aggregates transactions and points history per user next to the stored balance
+func (db *PostgresDB) GetBalanceSources(ctx context.Context) ([]models.BalanceSources, error) {
+	query := `
+		SELECT u.id,
+			COALESCE(t.earned, 0),
+			COALESCE(h.redeemed, 0), COALESCE(h.expired, 0), COALESCE(h.forfeited, 0), COALESCE(h.refunded, 0), COALESCE(h.adjusted, 0),
+			COALESCE(pb.total_points, 0), COALESCE(pb.points_redeemed, 0)
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id, SUM(points_earned) AS earned FROM transactions GROUP BY user_id
+		) t ON t.user_id = u.id
+		LEFT JOIN (
+			SELECT user_id,
+				SUM(CASE WHEN points_type = 'redeem' THEN points ELSE 0 END) AS redeemed,
+				SUM(CASE WHEN points_type = 'expired' THEN points ELSE 0 END) AS expired,
+				SUM(CASE WHEN points_type = 'forfeit' THEN points ELSE 0 END) AS forfeited,
+				SUM(CASE WHEN points_type = 'refund' THEN points ELSE 0 END) AS refunded,
+				SUM(CASE WHEN points_type = 'adjust' THEN points ELSE 0 END) AS adjusted
+			FROM points_history GROUP BY user_id
+		) h ON h.user_id = u.id
+		LEFT JOIN points_balance pb ON pb.user_id = u.id
+		ORDER BY u.id`
+	rows, err := db.connection.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to aggregate balance sources: %v", err)
+	}
+	defer rows.Close()
+
+	var sources []models.BalanceSources
+	for rows.Next() {
+		var s models.BalanceSources
+		err := rows.Scan(&s.UserID, &s.Earned, &s.Redeemed, &s.Expired, &s.Forfeited, &s.Refunded, &s.Adjusted,
+			&s.Stored.TotalPoints, &s.Stored.PointsRedeemed)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan balance sources: %v", err)
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+// ApplyReconciliationCorrection moves the stored balance to the recomputed one. The difference is
+// recorded as a ledger adjustment but not in points_history, which the expected value came from.
+// The balance is only corrected while it is still stored, the value expected was computed next to,
+// otherwise it changed since and ErrBalanceChanged is returned.
+func (db *PostgresDB) ApplyReconciliationCorrection(ctx context.Context, userID int, stored, expected models.PointsBalance, reason string) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		before, _, err := lockPointsBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if before == expected {
+			return nil
+		}
+		if before != stored {
+			return ErrBalanceChanged
+		}
+
+		query := `
+			INSERT INTO points_balance (user_id, total_points, points_redeemed) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id) DO UPDATE SET total_points = EXCLUDED.total_points, points_redeemed = EXCLUDED.points_redeemed`
+		if _, err := tx.ExecContext(ctx, query, userID, expected.TotalPoints, expected.PointsRedeemed); err != nil {
+			return fmt.Errorf("Failed to correct points balance: %v", err)
+		}
+
+		if difference := expected.TotalPoints - before.TotalPoints; difference != 0 {
+			if err := appendPointsEvent(ctx, tx, userID, models.PointsEventAdjusted, difference, "", reason); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, "points.reconcile", "points_balance", userID, userID, before, expected)
+	})
+}
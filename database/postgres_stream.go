@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// StreamPointsHistory passes every history row matching the filter to fn in insertion order,
+// a zero UserID exports every user. Rows are read from the cursor one at a time.
+func (db *PostgresDB) StreamPointsHistory(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.PointsHistory) error) error {
+	query := `SELECT user_id, COALESCE(transaction_id, ''), points, points_type, COALESCE(reason, ''), date
+		FROM points_history WHERE 1 = 1`
+	query, args, err := exportFilter(query, filter, "date", "points_type")
+	if err != nil {
+		return fmt.Errorf("Failed to export points history: %v", err)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("Failed to export points history: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.PointsHistory
+		if err := rows.Scan(&entry.UserID, &entry.TransactionID, &entry.Points, &entry.PointsType, &entry.Reason, &entry.Date); err != nil {
+			return fmt.Errorf("Failed to scan points history: %v", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamTransactions is StreamPointsHistory for transactions, TransactionType filters on the category
+func (db *PostgresDB) StreamTransactions(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.Transaction) error) error {
+	query := `SELECT id, transaction_id, user_id, transaction_amount, category, transaction_date, COALESCE(product_code, ''), points_earned, created_on
+		FROM transactions WHERE 1 = 1`
+	query, args, err := exportFilter(query, filter, "transaction_date", "category")
+	if err != nil {
+		return fmt.Errorf("Failed to export transactions: %v", err)
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("Failed to export transactions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txn models.Transaction
+		err := rows.Scan(&txn.ID, &txn.TransactionID, &txn.UserID, &txn.TransactionAmount, &txn.Category,
+			&txn.TransactionDate, &txn.ProductCode, &txn.PointsEarned, &txn.CreatedOn)
+		if err != nil {
+			return fmt.Errorf("Failed to scan transaction: %v", err)
+		}
+		if err := fn(txn); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func exportFilter(query string, filter models.PointsHistoryRequest, dateColumn, typeColumn string) (string, []interface{}, error) {
+	start, end, err := timeRange(filter.StartDate, filter.EndDate)
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := []interface{}{}
+	if filter.UserID > 0 {
+		args = append(args, filter.UserID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if !start.IsZero() {
+		args = append(args, start)
+		query += fmt.Sprintf(" AND %s >= $%d", dateColumn, len(args))
+	}
+	if !end.IsZero() {
+		args = append(args, end)
+		query += fmt.Sprintf(" AND %s <= $%d", dateColumn, len(args))
+	}
+	if filter.TransactionType != "" {
+		args = append(args, filter.TransactionType)
+		query += fmt.Sprintf(" AND %s = $%d", typeColumn, len(args))
+	}
+	return query, args, nil
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lib/pq"
+)
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_on,
+	COALESCE(last_error, ''), COALESCE(response_status, 0), created_on, updated_on`
+
+func (db *PostgresDB) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO webhook_subscriptions (merchant, url, secret, event_types)
+			VALUES ($1, $2, $3, $4) RETURNING id, active, created_on`
+		err := tx.QueryRowContext(ctx, query, subscription.Merchant, subscription.URL, subscription.Secret, strings.Join(subscription.EventTypes, ",")).
+			Scan(&subscription.ID, &subscription.Active, &subscription.CreatedOn)
+		if err != nil {
+			return fmt.Errorf("Failed to create webhook subscription: %v", err)
+		}
+
+		return db.recordAudit(ctx, tx, "webhook.subscribe", "webhook_subscription", subscription.ID, 0, nil, map[string]interface{}{
+			"merchant":    subscription.Merchant,
+			"url":         subscription.URL,
+			"event_types": subscription.EventTypes,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// GetWebhookSubscriptions lists subscriptions of a merchant, or of every merchant when merchant is empty
+func (db *PostgresDB) GetWebhookSubscriptions(ctx context.Context, merchant string, activeOnly bool) ([]models.WebhookSubscription, error) {
+	query := `SELECT id, merchant, url, secret, event_types, active, created_on FROM webhook_subscriptions WHERE 1 = 1`
+	args := []interface{}{}
+	if merchant != "" {
+		args = append(args, merchant)
+		query += fmt.Sprintf(" AND merchant = $%d", len(args))
+	}
+	if activeOnly {
+		query += " AND active"
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.connection.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch webhook subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []models.WebhookSubscription
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (db *PostgresDB) GetWebhookSubscription(ctx context.Context, id int) (*models.WebhookSubscription, error) {
+	rows, err := db.connection.QueryContext(ctx, `SELECT id, merchant, url, secret, event_types, active, created_on FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch webhook subscription: %v", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Webhook subscription %d not found", id)
+	}
+	subscription, err := scanWebhookSubscription(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (db *PostgresDB) DeactivateWebhookSubscription(ctx context.Context, id int) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE webhook_subscriptions SET active = FALSE WHERE id = $1 AND active`, id)
+		if err != nil {
+			return fmt.Errorf("Failed to deactivate webhook subscription: %v", err)
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			return fmt.Errorf("Active webhook subscription %d not found", id)
+		}
+
+		return db.recordAudit(ctx, tx, "webhook.unsubscribe", "webhook_subscription", id, 0,
+			map[string]bool{"active": true}, map[string]bool{"active": false})
+	})
+}
+
+// CreateWebhookDeliveries queues an event for each subscription, an event relayed twice is queued once
+func (db *PostgresDB) CreateWebhookDeliveries(ctx context.Context, event models.DomainEvent, subscriptionIDs []int) error {
+	if len(subscriptionIDs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Failed to encode webhook payload: %v", err)
+	}
+
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_on)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (subscription_id, event_id) DO NOTHING`
+		for _, subscriptionID := range subscriptionIDs {
+			_, err := tx.ExecContext(ctx, query, subscriptionID, event.ID, event.Type, string(payload), models.WebhookDeliveryPending, time.Now())
+			if err != nil {
+				return fmt.Errorf("Failed to queue webhook delivery: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ClaimDueWebhookDeliveries returns the pending deliveries whose retry time has come and moves
+// their retry time lease ahead, so no other worker sends them meanwhile. The attempt recorded for
+// a delivery sets its real next retry time. Rows another worker is claiming are skipped.
+func (db *PostgresDB) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		now := time.Now()
+		query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_on <= $2
+			ORDER BY next_attempt_on, id LIMIT $3
+			FOR UPDATE SKIP LOCKED`
+		var err error
+		deliveries, err = queryWebhookDeliveries(ctx, tx, query, models.WebhookDeliveryPending, now, limit)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(deliveries))
+		for i, d := range deliveries {
+			ids[i] = d.ID
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_on = $1 WHERE id = ANY($2)`, now.Add(lease), pq.Array(ids))
+		if err != nil {
+			return fmt.Errorf("Failed to claim webhook deliveries: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (db *PostgresDB) GetWebhookDeliveries(ctx context.Context, subscriptionID, page, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`
+	return queryWebhookDeliveries(ctx, db.connection, query, subscriptionID, limit, (page-1)*limit)
+}
+
+func (db *PostgresDB) GetWebhookDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	deliveries, err := queryWebhookDeliveries(ctx, db.connection, `SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("Webhook delivery %d not found", id)
+	}
+	return &deliveries[0], nil
+}
+
+// RecordWebhookAttempt logs an attempt and stores the delivery's new state
+func (db *PostgresDB) RecordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt models.WebhookDeliveryAttempt) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_delivery_attempts (delivery_id, attempt, response_status, error, duration_ms, attempted_on)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			delivery.ID, attempt.Attempt, nullInt(attempt.ResponseStatus), attempt.Error, attempt.DurationMs, attempt.AttemptedOn)
+		if err != nil {
+			return fmt.Errorf("Failed to log webhook attempt: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = $2, next_attempt_on = $3, last_error = $4, response_status = $5, updated_on = NOW()
+			WHERE id = $6`,
+			delivery.Status, delivery.Attempts, delivery.NextAttemptOn, delivery.LastError, nullInt(delivery.ResponseStatus), delivery.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to update webhook delivery: %v", err)
+		}
+		return nil
+	})
+}
+
+func (db *PostgresDB) GetWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	rows, err := db.connection.QueryContext(ctx, `
+		SELECT id, delivery_id, attempt, COALESCE(response_status, 0), COALESCE(error, ''), COALESCE(duration_ms, 0), attempted_on
+		FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch webhook attempts: %v", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.WebhookDeliveryAttempt
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.ResponseStatus, &a.Error, &a.DurationMs, &a.AttemptedOn); err != nil {
+			return nil, fmt.Errorf("Failed to scan webhook attempt: %v", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// RedeliverWebhook puts a delivery back in the queue with a fresh retry budget
+func (db *PostgresDB) RedeliverWebhook(ctx context.Context, deliveryID int64) error {
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		err := tx.QueryRowContext(ctx, `SELECT status FROM webhook_deliveries WHERE id = $1 FOR UPDATE`, deliveryID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("Webhook delivery %d not found", deliveryID)
+		} else if err != nil {
+			return fmt.Errorf("Failed to fetch webhook delivery: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_on = $2, updated_on = NOW() WHERE id = $3`,
+			models.WebhookDeliveryPending, time.Now(), deliveryID)
+		if err != nil {
+			return fmt.Errorf("Failed to requeue webhook delivery: %v", err)
+		}
+
+		return db.recordAudit(ctx, tx, "webhook.redeliver", "webhook_delivery", deliveryID, 0,
+			map[string]string{"status": status}, map[string]string{"status": models.WebhookDeliveryPending})
+	})
+}
+
+func queryWebhookDeliveries(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch webhook deliveries: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload []byte
+		var nextAttemptOn sql.NullTime
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &nextAttemptOn,
+			&d.LastError, &d.ResponseStatus, &d.CreatedOn, &d.UpdatedOn)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan webhook delivery: %v", err)
+		}
+		d.Payload = payload
+		if nextAttemptOn.Valid {
+			d.NextAttemptOn = &nextAttemptOn.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookSubscription(rows *sql.Rows) (models.WebhookSubscription, error) {
+	var s models.WebhookSubscription
+	var eventTypes string
+	if err := rows.Scan(&s.ID, &s.Merchant, &s.URL, &s.Secret, &eventTypes, &s.Active, &s.CreatedOn); err != nil {
+		return s, fmt.Errorf("Failed to scan webhook subscription: %v", err)
+	}
+	s.EventTypes = []string{}
+	if eventTypes != "" {
+		s.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return s, nil
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// replicaLagQuery reports whether the database is a standby and how far its replay is behind, 0
+// once it replayed everything it received
+const replicaLagQuery = `
+	SELECT pg_is_in_recovery(),
+		CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`
+
+// replicaDB is the primary with its balance and history reads spread over read only replicas.
+// Everything else, writes included, goes to the primary.
+type replicaDB struct {
+	Database
+	replicas *replicaSet
+}
+
+// replicaSet checks the replicas in the background and picks the one serving a read. A user's reads
+// only go to a replica that replayed past that user's last write through this process, so users
+// read their own writes, and writes made elsewhere show up within the configured lag.
+type replicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     uint32
+
+	mu sync.Mutex
+	// writes holds when each user was last written to, forgotten once no replica can be that far behind
+	writes map[int]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// replica is a read only standby and what its last check found
+type replica struct {
+	name string
+	db   *PostgresDB
+
+	mu sync.RWMutex
+	// serving is false until a check passes, and again once a check or a read fails
+	serving bool
+	// caughtUp is how far the replica had replayed the primary's writes at its last check
+	caughtUp time.Time
+}
+
+// WithReplicas spreads the balance and history reads of db over the replicas configured in cfg,
+// returning db itself when there are none. Replicas that are down or too far behind are skipped
+// until a later check finds them fit, with no replica left the primary serves every read.
+func WithReplicas(db Database, cfg config.DatabaseConfig) (Database, error) {
+	rc := cfg.Replicas
+	if len(rc.DSNs) == 0 {
+		return db, nil
+	}
+	if cfg.Driver != "postgres" {
+		return nil, fmt.Errorf("replicas need the postgres driver, not %s", cfg.Driver)
+	}
+	if rc.MaxLagInSec <= 0 || rc.CheckIntervalInSec <= 0 {
+		return nil, fmt.Errorf("replicas need a positive maxLagInSec and checkIntervalInSec")
+	}
+
+	set := &replicaSet{
+		maxLag:   time.Duration(rc.MaxLagInSec) * time.Second,
+		interval: time.Duration(rc.CheckIntervalInSec) * time.Second,
+		writes:   make(map[int]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i, dsn := range rc.DSNs {
+		// nothing connects yet, a replica that is down only keeps the reads on the primary
+		connection, err := openPostgres(dsn)
+		if err != nil {
+			for _, r := range set.replicas {
+				r.db.Close()
+			}
+			return nil, fmt.Errorf("replica %d: %v", i+1, err)
+		}
+		set.replicas = append(set.replicas, &replica{name: replicaName(dsn, i), db: &PostgresDB{connection: connection}})
+	}
+	go set.run()
+
+	return &replicaDB{Database: db, replicas: set}, nil
+}
+
+// replicaName names a replica in logs by its host, its DSN holds the password
+func replicaName(dsn string, i int) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		return u.Host
+	}
+	for _, field := range strings.Fields(dsn) {
+		if host := strings.TrimPrefix(field, "host="); host != field {
+			return host
+		}
+	}
+	return fmt.Sprintf("replica %d", i+1)
+}
+
+// Unwrap returns the primary
+func (db *replicaDB) Unwrap() Database {
+	return db.Database
+}
+
+func (db *replicaDB) WithAuditMeta(meta models.AuditMeta) Database {
+	return &replicaDB{Database: db.Database.WithAuditMeta(meta), replicas: db.replicas}
+}
+
+// Close stops the replica checks and closes the replicas and then the primary
+func (db *replicaDB) Close() error {
+	db.replicas.close()
+	return db.Database.Close()
+}
+
+// routed runs read against a replica that may serve userID, or against the primary when none may.
+// A replica whose read fails where the primary's succeeds is taken out until its next check passes.
+func routed[T any](ctx context.Context, db *replicaDB, userID int, read func(Database) (T, error)) (T, error) {
+	r := db.replicas.pick(userID)
+	if r == nil {
+		return read(db.Database)
+	}
+
+	result, err := read(r.db)
+	if err == nil || ctx.Err() != nil {
+		return result, err
+	}
+	result, primaryErr := read(db.Database)
+	if primaryErr == nil {
+		r.failed(err)
+	}
+	return result, primaryErr
+}
+
+func (db *replicaDB) GetPointsBalance(ctx context.Context, userID int) (models.PointsBalance, error) {
+	return routed(ctx, db, userID, func(from Database) (models.PointsBalance, error) {
+		return from.GetPointsBalance(ctx, userID)
+	})
+}
+
+func (db *replicaDB) GetPointsHistory(ctx context.Context, userID, page, limit int, startDate, endDate, transactionType string) ([]models.PointsHistory, error) {
+	return routed(ctx, db, userID, func(from Database) ([]models.PointsHistory, error) {
+		return from.GetPointsHistory(ctx, userID, page, limit, startDate, endDate, transactionType)
+	})
+}
+
+// The writes below change a user's balance or history, their user's reads stay on the primary
+// until a replica replayed them. They are recorded even when they fail, a failed commit may
+// still have been applied.
+
+func (db *replicaDB) CloseUserAccount(ctx context.Context, userID int, policy string, cashOutRate float64) (*models.AccountClosure, error) {
+	defer db.replicas.wrote(userID)
+	return db.Database.CloseUserAccount(ctx, userID, policy, cashOutRate)
+}
+
+func (db *replicaDB) AddTransaction(ctx context.Context, txn *models.Transaction) (*models.Transaction, error) {
+	defer db.replicas.wrote(txn.UserID)
+	return db.Database.AddTransaction(ctx, txn)
+}
+
+func (db *replicaDB) AddTransactionsBatch(ctx context.Context, txns []models.Transaction) ([]models.BatchTransactionResult, error) {
+	userIDs := make([]int, len(txns))
+	for i, txn := range txns {
+		userIDs[i] = txn.UserID
+	}
+	defer db.replicas.wrote(userIDs...)
+	return db.Database.AddTransactionsBatch(ctx, txns)
+}
+
+func (db *replicaDB) DeductPoints(ctx context.Context, userID int, points int) (int, error) {
+	defer db.replicas.wrote(userID)
+	return db.Database.DeductPoints(ctx, userID, points)
+}
+
+func (db *replicaDB) LogPointsHistory(ctx context.Context, userID int, points int, pointsType string, reason string) error {
+	defer db.replicas.wrote(userID)
+	return db.Database.LogPointsHistory(ctx, userID, points, pointsType, reason)
+}
+
+func (db *replicaDB) ExpireTransactions(ctx context.Context, candidates []models.ExpiryCandidate, checkpoint models.JobCheckpoint) (int, int, error) {
+	userIDs := make([]int, len(candidates))
+	for i, c := range candidates {
+		userIDs[i] = c.UserID
+	}
+	defer db.replicas.wrote(userIDs...)
+	return db.Database.ExpireTransactions(ctx, candidates, checkpoint)
+}
+
+func (db *replicaDB) ExpirePoints(ctx context.Context, userID int, transactionID string, pointsEarned int, transactionDate time.Time) error {
+	defer db.replicas.wrote(userID)
+	return db.Database.ExpirePoints(ctx, userID, transactionID, pointsEarned, transactionDate)
+}
+
+func (db *replicaDB) SetPointsBalance(ctx context.Context, userID int, stored models.PointsBalance, lastEventID int64, balance models.PointsBalance) error {
+	defer db.replicas.wrote(userID)
+	return db.Database.SetPointsBalance(ctx, userID, stored, lastEventID, balance)
+}
+
+func (db *replicaDB) AdjustPoints(ctx context.Context, userID int, points int, reason string) (models.PointsBalance, error) {
+	defer db.replicas.wrote(userID)
+	return db.Database.AdjustPoints(ctx, userID, points, reason)
+}
+
+// RefundTransaction only learns whose transaction it refunded from the event it returns
+func (db *replicaDB) RefundTransaction(ctx context.Context, transactionID string, reason string) (*models.PointsEvent, error) {
+	event, err := db.Database.RefundTransaction(ctx, transactionID, reason)
+	if event != nil {
+		db.replicas.wrote(event.UserID)
+	}
+	return event, err
+}
+
+func (db *replicaDB) ApplyReconciliationCorrection(ctx context.Context, userID int, stored, balance models.PointsBalance, reason string) error {
+	defer db.replicas.wrote(userID)
+	return db.Database.ApplyReconciliationCorrection(ctx, userID, stored, balance, reason)
+}
+
+// wrote records that userIDs were just written to
+func (s *replicaSet) wrote(userIDs ...int) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userID := range userIDs {
+		s.writes[userID] = now
+	}
+}
+
+// pick returns the next replica in turn that may serve userID, nil when only the primary may
+func (s *replicaSet) pick(userID int) *replica {
+	s.mu.Lock()
+	lastWrite := s.writes[userID]
+	s.mu.Unlock()
+
+	start := int(atomic.AddUint32(&s.next, 1))
+	for i := range s.replicas {
+		r := s.replicas[(start+i)%len(s.replicas)]
+		if r.serves(lastWrite) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		var checks sync.WaitGroup
+		for _, r := range s.replicas {
+			checks.Add(1)
+			go func(r *replica) {
+				defer checks.Done()
+				r.check(s.interval, s.maxLag)
+			}(r)
+		}
+		checks.Wait()
+
+		// a replica that serves reads from now on replayed at least up to maxLag ago, so the writes
+		// before that are on every replica that will serve them
+		cutoff := time.Now().Add(-s.maxLag)
+		s.mu.Lock()
+		for userID, wroteOn := range s.writes {
+			if wroteOn.Before(cutoff) {
+				delete(s.writes, userID)
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *replicaSet) close() {
+	close(s.stop)
+	<-s.done
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+}
+
+// check measures the replica's lag, it serves reads while it is reachable, a standby and no more
+// than maxLag behind
+func (r *replica) check(timeout, maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	started := time.Now()
+	var standby bool
+	var lagInSec float64
+	err := r.db.connection.QueryRowContext(ctx, replicaLagQuery).Scan(&standby, &lagInSec)
+	lag := time.Duration(lagInSec * float64(time.Second))
+
+	switch {
+	case err != nil:
+		r.set(false, time.Time{}, fmt.Sprintf("is down: %v", err))
+	case !standby:
+		r.set(false, time.Time{}, "is not a standby")
+	case lag > maxLag:
+		r.set(false, time.Time{}, fmt.Sprintf("is %s behind", lag.Round(time.Millisecond)))
+	default:
+		r.set(true, started.Add(-lag), "")
+	}
+}
+
+// failed takes the replica out after a failed read until its next check passes
+func (r *replica) failed(err error) {
+	r.set(false, time.Time{}, fmt.Sprintf("failed a read: %v", err))
+}
+
+// set records a check or a failure, logging when the replica starts or stops serving reads
+func (r *replica) set(serving bool, caughtUp time.Time, problem string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if serving && !r.serving {
+		log.Printf("Replica %s is serving reads", r.name)
+	} else if !serving && r.serving {
+		log.Printf("Replica %s %s, its reads go to the primary", r.name, problem)
+	}
+	r.serving = serving
+	if serving {
+		r.caughtUp = caughtUp
+	}
+}
+
+// serves reports whether the replica may serve a user last written to at lastWrite
+func (r *replica) serves(lastWrite time.Time) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.serving && !r.caughtUp.Before(lastWrite)
+}
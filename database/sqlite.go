@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/config"
+)
+
+// sqliteLockLease is how long a SQLite lock outlives a holder that stopped renewing it, unless
+// SetLease chose another lease for the holder's renewal interval
+const sqliteLockLease = 30 * time.Second
+
+// ConnectionToSQLite opens the SQLite file at cfg.Path, creating an empty one if it is missing. The
+// returned database runs the same queries as Postgres through the sqlite3-rewards driver.
+func ConnectionToSQLite(cfg config.DatabaseConfig) (Database, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("database path is required for the sqlite driver")
+	}
+
+	// transactions take the write lock when they begin, which stands in for Postgres row locks
+	params := url.Values{}
+	params.Set("_foreign_keys", "1")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_txlock", "immediate")
+
+	connection, err := sql.Open(sqliteDriverName, "file:"+cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection: %w", err)
+	}
+
+	connection.SetMaxOpenConns(25)
+	connection.SetMaxIdleConns(25)
+	connection.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := connection.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &PostgresDB{connection: connection, dialect: sqliteDialect}, nil
+}
+
+// LeaseLocker is a Locker for SQLite, which has no advisory locks. The lock is a row naming its
+// holder with an expiry that Check renews, a holder that dies loses it once the lease runs out.
+type LeaseLocker struct {
+	db     *sql.DB
+	name   string
+	holder string
+
+	mu    sync.Mutex
+	held  bool
+	lease time.Duration
+}
+
+// SetLease sets how long the lock outlives a holder that stopped renewing it. It has to span
+// several renewals, a lease running out between two of them would let another instance take the
+// lock while the holder still believes it has it.
+func (l *LeaseLocker) SetLease(lease time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lease = lease
+}
+
+func (l *LeaseLocker) TryLock(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	result, err := l.db.ExecContext(ctx, `
+		INSERT INTO scheduler_locks (name, holder, expires_on) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_on = EXCLUDED.expires_on
+		WHERE scheduler_locks.holder = EXCLUDED.holder OR scheduler_locks.expires_on < $4`,
+		l.name, l.holder, now.Add(l.lease), now)
+	if err != nil {
+		return false, fmt.Errorf("Failed to take lock %s: %v", l.name, err)
+	}
+	taken, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed to take lock %s: %v", l.name, err)
+	}
+	l.held = taken > 0
+	return l.held, nil
+}
+
+// Check renews the lease, failing once another instance took the lock over
+func (l *LeaseLocker) Check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+
+	now := time.Now()
+	result, err := l.db.ExecContext(ctx, `UPDATE scheduler_locks SET expires_on = $1 WHERE name = $2 AND holder = $3 AND expires_on >= $4`,
+		now.Add(l.lease), l.name, l.holder, now)
+	if err != nil {
+		return fmt.Errorf("Failed to renew lock %s: %v", l.name, err)
+	}
+	if renewed, err := result.RowsAffected(); err != nil || renewed == 0 {
+		l.held = false
+		return fmt.Errorf("lost lock %s", l.name)
+	}
+	return nil
+}
+
+func (l *LeaseLocker) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	if _, err := l.db.ExecContext(ctx, `DELETE FROM scheduler_locks WHERE name = $1 AND holder = $2`, l.name, l.holder); err != nil {
+		return fmt.Errorf("Failed to release lock %s: %v", l.name, err)
+	}
+	return nil
+}
+
+// Terminate ends the lease right away, the way it ends when a holder crashes and stops renewing.
+// It is meant for failover drills such as the leader failover test.
+func (l *LeaseLocker) Terminate(ctx context.Context) error {
+	l.mu.Lock()
+	held := l.held
+	l.mu.Unlock()
+	if !held {
+		return fmt.Errorf("lock %s is not held", l.name)
+	}
+
+	_, err := l.db.ExecContext(ctx, `UPDATE scheduler_locks SET expires_on = $1 WHERE name = $2 AND holder = $3`,
+		time.Time{}, l.name, l.holder)
+	if err != nil {
+		return fmt.Errorf("Failed to end lease of lock %s: %v", l.name, err)
+	}
+	return nil
+}
+
+func newLeaseLocker(db *sql.DB, name string) *LeaseLocker {
+	return &LeaseLocker{db: db, name: name, holder: uuid.NewString(), lease: sqliteLockLease}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is a SQLite driver that accepts the Postgres flavoured queries PostgresDB is
+// written in, so both databases share one implementation
+const sqliteDriverName = "sqlite3-rewards"
+
+// sqliteTimeFormat stores timestamps the way a Postgres TIMESTAMP does, as the wall clock without
+// a zone, and fixed width so they sort as text
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000"
+
+var (
+	sqlitePlaceholder = regexp.MustCompile(`\$(\d+)`)
+	sqliteAny         = regexp.MustCompile(`=\s*ANY\(\$(\d+)\)`)
+	sqliteForUpdate   = regexp.MustCompile(`\s+FOR UPDATE(\s+SKIP LOCKED)?\b`)
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqliteDriver{})
+}
+
+type sqliteDriver struct{}
+
+func (d *sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	base := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("now", func() string { return time.Now().Format(sqliteTimeFormat) }, false)
+		},
+	}
+	conn, err := base.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn: conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// sqliteQuery rewrites the Postgres only parts of a query. Row locks are dropped, transactions
+// take the database write lock when they begin instead, and arrays are passed as JSON.
+func sqliteQuery(query string) string {
+	query = sqliteAny.ReplaceAllString(query, "IN (SELECT value FROM json_each($$$1))")
+	query = sqliteForUpdate.ReplaceAllString(query, "")
+	return sqlitePlaceholder.ReplaceAllString(query, "?$1")
+}
+
+// sqliteConn passes every query through sqliteQuery and every argument through CheckNamedValue
+type sqliteConn struct {
+	conn *sqlite3.SQLiteConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(sqliteQuery(query))
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.conn.PrepareContext(ctx, sqliteQuery(query))
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.conn.QueryContext(ctx, sqliteQuery(query), args)
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.conn.ExecContext(ctx, sqliteQuery(query), args)
+}
+
+func (c *sqliteConn) Begin() (driver.Tx, error) {
+	return c.conn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.BeginTx(ctx, opts)
+}
+
+func (c *sqliteConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+func (c *sqliteConn) Close() error {
+	return c.conn.Close()
+}
+
+// CheckNamedValue stores times in sqliteTimeFormat and pq arrays as JSON arrays for json_each
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	var array interface{}
+	switch v := nv.Value.(type) {
+	case pq.GenericArray:
+		array = v.A
+	case *pq.StringArray:
+		array = []string(*v)
+	case *pq.Int64Array:
+		array = []int64(*v)
+	}
+	if array != nil {
+		encoded, err := json.Marshal(array)
+		if err != nil {
+			return err
+		}
+		nv.Value = string(encoded)
+		return nil
+	}
+
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.Format(sqliteTimeFormat)
+	}
+	nv.Value = value
+	return nil
+}
+
+func isSQLiteUniqueViolation(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
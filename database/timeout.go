@@ -0,0 +1,414 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// timeoutDB bounds every call to the Database it wraps by the timeout of the call's operation, its
+// method name. A call still running when the timeout is up is cancelled and fails with ErrTimeout.
+type timeoutDB struct {
+	db       Database
+	timeouts config.QueryTimeoutConfig
+}
+
+// WithTimeouts wraps db so its calls time out as configured, rejecting timeouts of operations
+// Database does not have
+func WithTimeouts(db Database, timeouts config.QueryTimeoutConfig) (Database, error) {
+	methods := reflect.TypeOf((*Database)(nil)).Elem()
+	for op, seconds := range timeouts.OperationsInSec {
+		if _, ok := methods.MethodByName(op); !ok {
+			return nil, fmt.Errorf("timeout set for unknown database operation %s", op)
+		}
+		if seconds < 0 {
+			return nil, fmt.Errorf("timeout of %s must not be negative", op)
+		}
+	}
+	if timeouts.DefaultInSec < 0 {
+		return nil, fmt.Errorf("default database timeout must not be negative")
+	}
+	return &timeoutDB{db: db, timeouts: timeouts}, nil
+}
+
+// Unwrap returns the database without timeouts
+func (t *timeoutDB) Unwrap() Database {
+	return t.db
+}
+
+func (t *timeoutDB) timeout(op string) time.Duration {
+	if seconds, ok := t.timeouts.OperationsInSec[op]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(t.timeouts.DefaultInSec) * time.Second
+}
+
+// start derives the context op runs under, call the returned function once op returned its error
+func (t *timeoutDB) start(ctx context.Context, op string) (context.Context, func(error) error) {
+	timeout := t.timeout(op)
+	if timeout == 0 {
+		return ctx, func(err error) error { return err }
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func(err error) error {
+		defer cancel()
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s %w after %s: %v", op, ErrTimeout, timeout, err)
+		}
+		return err
+	}
+}
+
+func timed[T any](t *timeoutDB, ctx context.Context, op string, call func(ctx context.Context) (T, error)) (T, error) {
+	ctx, done := t.start(ctx, op)
+	result, err := call(ctx)
+	return result, done(err)
+}
+
+func (t *timeoutDB) exec(ctx context.Context, op string, call func(ctx context.Context) error) error {
+	ctx, done := t.start(ctx, op)
+	return done(call(ctx))
+}
+
+func (t *timeoutDB) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	return timed(t, ctx, "CreateUser", func(ctx context.Context) (*models.User, error) {
+		return t.db.CreateUser(ctx, user)
+	})
+}
+
+func (t *timeoutDB) GetUserByID(ctx context.Context, userID int, user *models.User) (*models.User, error) {
+	return timed(t, ctx, "GetUserByID", func(ctx context.Context) (*models.User, error) {
+		return t.db.GetUserByID(ctx, userID, user)
+	})
+}
+
+func (t *timeoutDB) GetUserByEmail(ctx context.Context, email string, user *models.User) (*models.User, error) {
+	return timed(t, ctx, "GetUserByEmail", func(ctx context.Context) (*models.User, error) {
+		return t.db.GetUserByEmail(ctx, email, user)
+	})
+}
+
+func (t *timeoutDB) UpdateUserProfile(ctx context.Context, user *models.User) (*models.User, string, error) {
+	ctx, done := t.start(ctx, "UpdateUserProfile")
+	updated, token, err := t.db.UpdateUserProfile(ctx, user)
+	return updated, token, done(err)
+}
+
+func (t *timeoutDB) VerifyUserEmail(ctx context.Context, token string) (*models.User, error) {
+	return timed(t, ctx, "VerifyUserEmail", func(ctx context.Context) (*models.User, error) {
+		return t.db.VerifyUserEmail(ctx, token)
+	})
+}
+
+func (t *timeoutDB) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
+	return t.exec(ctx, "UpdateUserPassword", func(ctx context.Context) error {
+		return t.db.UpdateUserPassword(ctx, userID, hashedPassword)
+	})
+}
+
+func (t *timeoutDB) CloseUserAccount(ctx context.Context, userID int, policy string, cashOutRate float64) (*models.AccountClosure, error) {
+	return timed(t, ctx, "CloseUserAccount", func(ctx context.Context) (*models.AccountClosure, error) {
+		return t.db.CloseUserAccount(ctx, userID, policy, cashOutRate)
+	})
+}
+
+func (t *timeoutDB) SetUserTier(ctx context.Context, userID int, tier string) (string, error) {
+	return timed(t, ctx, "SetUserTier", func(ctx context.Context) (string, error) {
+		return t.db.SetUserTier(ctx, userID, tier)
+	})
+}
+
+func (t *timeoutDB) AddTransaction(ctx context.Context, txn *models.Transaction) (*models.Transaction, error) {
+	return timed(t, ctx, "AddTransaction", func(ctx context.Context) (*models.Transaction, error) {
+		return t.db.AddTransaction(ctx, txn)
+	})
+}
+
+func (t *timeoutDB) AddTransactionsBatch(ctx context.Context, txns []models.Transaction) ([]models.BatchTransactionResult, error) {
+	return timed(t, ctx, "AddTransactionsBatch", func(ctx context.Context) ([]models.BatchTransactionResult, error) {
+		return t.db.AddTransactionsBatch(ctx, txns)
+	})
+}
+
+func (t *timeoutDB) GetTransactionsByUser(ctx context.Context, userID, page, limit int) ([]models.Transaction, error) {
+	return timed(t, ctx, "GetTransactionsByUser", func(ctx context.Context) ([]models.Transaction, error) {
+		return t.db.GetTransactionsByUser(ctx, userID, page, limit)
+	})
+}
+
+func (t *timeoutDB) GetPointsBalance(ctx context.Context, userID int) (models.PointsBalance, error) {
+	return timed(t, ctx, "GetPointsBalance", func(ctx context.Context) (models.PointsBalance, error) {
+		return t.db.GetPointsBalance(ctx, userID)
+	})
+}
+
+func (t *timeoutDB) GetPointsHistory(ctx context.Context, userID, page, limit int, startDate, endDate, transactionType string) ([]models.PointsHistory, error) {
+	return timed(t, ctx, "GetPointsHistory", func(ctx context.Context) ([]models.PointsHistory, error) {
+		return t.db.GetPointsHistory(ctx, userID, page, limit, startDate, endDate, transactionType)
+	})
+}
+
+func (t *timeoutDB) StreamPointsHistory(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.PointsHistory) error) error {
+	return t.exec(ctx, "StreamPointsHistory", func(ctx context.Context) error {
+		return t.db.StreamPointsHistory(ctx, filter, fn)
+	})
+}
+
+func (t *timeoutDB) StreamTransactions(ctx context.Context, filter models.PointsHistoryRequest, fn func(models.Transaction) error) error {
+	return t.exec(ctx, "StreamTransactions", func(ctx context.Context) error {
+		return t.db.StreamTransactions(ctx, filter, fn)
+	})
+}
+
+func (t *timeoutDB) DeductPoints(ctx context.Context, userID int, points int) (int, error) {
+	return timed(t, ctx, "DeductPoints", func(ctx context.Context) (int, error) {
+		return t.db.DeductPoints(ctx, userID, points)
+	})
+}
+
+func (t *timeoutDB) LogPointsHistory(ctx context.Context, userID int, points int, pointsType string, reason string) error {
+	return t.exec(ctx, "LogPointsHistory", func(ctx context.Context) error {
+		return t.db.LogPointsHistory(ctx, userID, points, pointsType, reason)
+	})
+}
+
+func (t *timeoutDB) GetExpiryCandidates(ctx context.Context, userID int, cutoff, idleCutoff, cursorDate time.Time, cursorID, limit int) ([]models.ExpiryCandidate, error) {
+	return timed(t, ctx, "GetExpiryCandidates", func(ctx context.Context) ([]models.ExpiryCandidate, error) {
+		return t.db.GetExpiryCandidates(ctx, userID, cutoff, idleCutoff, cursorDate, cursorID, limit)
+	})
+}
+
+func (t *timeoutDB) ExpireTransactions(ctx context.Context, candidates []models.ExpiryCandidate, checkpoint models.JobCheckpoint) (int, int, error) {
+	ctx, done := t.start(ctx, "ExpireTransactions")
+	expired, points, err := t.db.ExpireTransactions(ctx, candidates, checkpoint)
+	return expired, points, done(err)
+}
+
+func (t *timeoutDB) ExpirePoints(ctx context.Context, userID int, transactionID string, pointsEarned int, transactionDate time.Time) error {
+	return t.exec(ctx, "ExpirePoints", func(ctx context.Context) error {
+		return t.db.ExpirePoints(ctx, userID, transactionID, pointsEarned, transactionDate)
+	})
+}
+
+func (t *timeoutDB) GetJobCheckpoint(ctx context.Context, job string) (*models.JobCheckpoint, error) {
+	return timed(t, ctx, "GetJobCheckpoint", func(ctx context.Context) (*models.JobCheckpoint, error) {
+		return t.db.GetJobCheckpoint(ctx, job)
+	})
+}
+
+func (t *timeoutDB) SaveJobCheckpoint(ctx context.Context, checkpoint models.JobCheckpoint) error {
+	return t.exec(ctx, "SaveJobCheckpoint", func(ctx context.Context) error {
+		return t.db.SaveJobCheckpoint(ctx, checkpoint)
+	})
+}
+
+func (t *timeoutDB) GetPointsEvents(ctx context.Context, userID int) ([]models.PointsEvent, error) {
+	return timed(t, ctx, "GetPointsEvents", func(ctx context.Context) ([]models.PointsEvent, error) {
+		return t.db.GetPointsEvents(ctx, userID)
+	})
+}
+
+func (t *timeoutDB) ListLedgerUserIDs(ctx context.Context) ([]int, error) {
+	return timed(t, ctx, "ListLedgerUserIDs", func(ctx context.Context) ([]int, error) {
+		return t.db.ListLedgerUserIDs(ctx)
+	})
+}
+
+func (t *timeoutDB) SetPointsBalance(ctx context.Context, userID int, stored models.PointsBalance, lastEventID int64, balance models.PointsBalance) error {
+	return t.exec(ctx, "SetPointsBalance", func(ctx context.Context) error {
+		return t.db.SetPointsBalance(ctx, userID, stored, lastEventID, balance)
+	})
+}
+
+func (t *timeoutDB) AdjustPoints(ctx context.Context, userID int, points int, reason string) (models.PointsBalance, error) {
+	return timed(t, ctx, "AdjustPoints", func(ctx context.Context) (models.PointsBalance, error) {
+		return t.db.AdjustPoints(ctx, userID, points, reason)
+	})
+}
+
+func (t *timeoutDB) RefundTransaction(ctx context.Context, transactionID string, reason string) (*models.PointsEvent, error) {
+	return timed(t, ctx, "RefundTransaction", func(ctx context.Context) (*models.PointsEvent, error) {
+		return t.db.RefundTransaction(ctx, transactionID, reason)
+	})
+}
+
+func (t *timeoutDB) GetBalanceSources(ctx context.Context) ([]models.BalanceSources, error) {
+	return timed(t, ctx, "GetBalanceSources", func(ctx context.Context) ([]models.BalanceSources, error) {
+		return t.db.GetBalanceSources(ctx)
+	})
+}
+
+func (t *timeoutDB) ApplyReconciliationCorrection(ctx context.Context, userID int, stored, balance models.PointsBalance, reason string) error {
+	return t.exec(ctx, "ApplyReconciliationCorrection", func(ctx context.Context) error {
+		return t.db.ApplyReconciliationCorrection(ctx, userID, stored, balance, reason)
+	})
+}
+
+func (t *timeoutDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	return timed(t, ctx, "ClaimOutboxEvents", func(ctx context.Context) ([]models.OutboxEvent, error) {
+		return t.db.ClaimOutboxEvents(ctx, limit, lease)
+	})
+}
+
+func (t *timeoutDB) MarkOutboxEventDelivered(ctx context.Context, id int64, publisher string) error {
+	return t.exec(ctx, "MarkOutboxEventDelivered", func(ctx context.Context) error {
+		return t.db.MarkOutboxEventDelivered(ctx, id, publisher)
+	})
+}
+
+func (t *timeoutDB) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	return t.exec(ctx, "MarkOutboxEventPublished", func(ctx context.Context) error {
+		return t.db.MarkOutboxEventPublished(ctx, id)
+	})
+}
+
+func (t *timeoutDB) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, maxAttempts int) (bool, error) {
+	return timed(t, ctx, "MarkOutboxEventFailed", func(ctx context.Context) (bool, error) {
+		return t.db.MarkOutboxEventFailed(ctx, id, reason, maxAttempts)
+	})
+}
+
+func (t *timeoutDB) RecordExpiryWarnings(ctx context.Context, warnings []models.ExpiryWarning) (int, error) {
+	return timed(t, ctx, "RecordExpiryWarnings", func(ctx context.Context) (int, error) {
+		return t.db.RecordExpiryWarnings(ctx, warnings)
+	})
+}
+
+func (t *timeoutDB) GetPendingExpiryWarnings(ctx context.Context, limit int) ([]models.ExpiryWarning, error) {
+	return timed(t, ctx, "GetPendingExpiryWarnings", func(ctx context.Context) ([]models.ExpiryWarning, error) {
+		return t.db.GetPendingExpiryWarnings(ctx, limit)
+	})
+}
+
+func (t *timeoutDB) MarkExpiryWarningsNotified(ctx context.Context, ids []int64) error {
+	return t.exec(ctx, "MarkExpiryWarningsNotified", func(ctx context.Context) error {
+		return t.db.MarkExpiryWarningsNotified(ctx, ids)
+	})
+}
+
+func (t *timeoutDB) GetNotificationSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	return timed(t, ctx, "GetNotificationSettings", func(ctx context.Context) (models.NotificationSettings, error) {
+		return t.db.GetNotificationSettings(ctx, userID)
+	})
+}
+
+func (t *timeoutDB) GetNotificationPreferences(ctx context.Context, userID int) ([]models.NotificationPreference, error) {
+	return timed(t, ctx, "GetNotificationPreferences", func(ctx context.Context) ([]models.NotificationPreference, error) {
+		return t.db.GetNotificationPreferences(ctx, userID)
+	})
+}
+
+func (t *timeoutDB) UpdateNotificationPreferences(ctx context.Context, settings models.NotificationSettings, preferences []models.NotificationPreference) error {
+	return t.exec(ctx, "UpdateNotificationPreferences", func(ctx context.Context) error {
+		return t.db.UpdateNotificationPreferences(ctx, settings, preferences)
+	})
+}
+
+func (t *timeoutDB) LogNotificationDelivery(ctx context.Context, delivery models.NotificationDelivery) error {
+	return t.exec(ctx, "LogNotificationDelivery", func(ctx context.Context) error {
+		return t.db.LogNotificationDelivery(ctx, delivery)
+	})
+}
+
+func (t *timeoutDB) GetNotificationDeliveries(ctx context.Context, userID, page, limit int) ([]models.NotificationDelivery, error) {
+	return timed(t, ctx, "GetNotificationDeliveries", func(ctx context.Context) ([]models.NotificationDelivery, error) {
+		return t.db.GetNotificationDeliveries(ctx, userID, page, limit)
+	})
+}
+
+// NewLocker is not bounded, locks take the context of each call
+func (t *timeoutDB) NewLocker(name string) Locker {
+	return t.db.NewLocker(name)
+}
+
+func (t *timeoutDB) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	return timed(t, ctx, "CreateWebhookSubscription", func(ctx context.Context) (*models.WebhookSubscription, error) {
+		return t.db.CreateWebhookSubscription(ctx, subscription)
+	})
+}
+
+func (t *timeoutDB) GetWebhookSubscriptions(ctx context.Context, merchant string, activeOnly bool) ([]models.WebhookSubscription, error) {
+	return timed(t, ctx, "GetWebhookSubscriptions", func(ctx context.Context) ([]models.WebhookSubscription, error) {
+		return t.db.GetWebhookSubscriptions(ctx, merchant, activeOnly)
+	})
+}
+
+func (t *timeoutDB) GetWebhookSubscription(ctx context.Context, id int) (*models.WebhookSubscription, error) {
+	return timed(t, ctx, "GetWebhookSubscription", func(ctx context.Context) (*models.WebhookSubscription, error) {
+		return t.db.GetWebhookSubscription(ctx, id)
+	})
+}
+
+func (t *timeoutDB) DeactivateWebhookSubscription(ctx context.Context, id int) error {
+	return t.exec(ctx, "DeactivateWebhookSubscription", func(ctx context.Context) error {
+		return t.db.DeactivateWebhookSubscription(ctx, id)
+	})
+}
+
+func (t *timeoutDB) CreateWebhookDeliveries(ctx context.Context, event models.DomainEvent, subscriptionIDs []int) error {
+	return t.exec(ctx, "CreateWebhookDeliveries", func(ctx context.Context) error {
+		return t.db.CreateWebhookDeliveries(ctx, event, subscriptionIDs)
+	})
+}
+
+func (t *timeoutDB) ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	return timed(t, ctx, "ClaimDueWebhookDeliveries", func(ctx context.Context) ([]models.WebhookDelivery, error) {
+		return t.db.ClaimDueWebhookDeliveries(ctx, limit, lease)
+	})
+}
+
+func (t *timeoutDB) GetWebhookDeliveries(ctx context.Context, subscriptionID, page, pageSize int) ([]models.WebhookDelivery, error) {
+	return timed(t, ctx, "GetWebhookDeliveries", func(ctx context.Context) ([]models.WebhookDelivery, error) {
+		return t.db.GetWebhookDeliveries(ctx, subscriptionID, page, pageSize)
+	})
+}
+
+func (t *timeoutDB) GetWebhookDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	return timed(t, ctx, "GetWebhookDelivery", func(ctx context.Context) (*models.WebhookDelivery, error) {
+		return t.db.GetWebhookDelivery(ctx, id)
+	})
+}
+
+func (t *timeoutDB) RecordWebhookAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt models.WebhookDeliveryAttempt) error {
+	return t.exec(ctx, "RecordWebhookAttempt", func(ctx context.Context) error {
+		return t.db.RecordWebhookAttempt(ctx, delivery, attempt)
+	})
+}
+
+func (t *timeoutDB) GetWebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	return timed(t, ctx, "GetWebhookDeliveryAttempts", func(ctx context.Context) ([]models.WebhookDeliveryAttempt, error) {
+		return t.db.GetWebhookDeliveryAttempts(ctx, deliveryID)
+	})
+}
+
+func (t *timeoutDB) RedeliverWebhook(ctx context.Context, id int64) error {
+	return t.exec(ctx, "RedeliverWebhook", func(ctx context.Context) error {
+		return t.db.RedeliverWebhook(ctx, id)
+	})
+}
+
+func (t *timeoutDB) WithAuditMeta(meta models.AuditMeta) Database {
+	return &timeoutDB{db: t.db.WithAuditMeta(meta), timeouts: t.timeouts}
+}
+
+func (t *timeoutDB) GetAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	return timed(t, ctx, "GetAuditEvents", func(ctx context.Context) ([]models.AuditEvent, error) {
+		return t.db.GetAuditEvents(ctx, filter)
+	})
+}
+
+func (t *timeoutDB) VerifyAuditChain(ctx context.Context) (*models.AuditVerification, error) {
+	return timed(t, ctx, "VerifyAuditChain", func(ctx context.Context) (*models.AuditVerification, error) {
+		return t.db.VerifyAuditChain(ctx)
+	})
+}
+
+func (t *timeoutDB) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,151 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// pageSize bounds how many rows are held in memory while a section is written
+const pageSize = 500
+
+// section is one JSON file inside the archive
+type section struct {
+	fileName string
+	write    func(w io.Writer) error
+}
+
+// WriteUserArchive writes everything held about a user into w as a zip of JSON files
+func WriteUserArchive(ctx context.Context, db database.Database, userID int, w io.Writer, progress func(done, total int)) error {
+	user, err := db.GetUserByID(ctx, userID, nil)
+	if err != nil {
+		return err
+	}
+
+	sections := []section{
+		{"profile.json", func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(user)
+		}},
+		{"transactions.json", func(w io.Writer) error {
+			return writeJSONArray(w, func(page int) ([]interface{}, error) {
+				transactions, err := db.GetTransactionsByUser(ctx, userID, page, pageSize)
+				items := make([]interface{}, len(transactions))
+				for i := range transactions {
+					items[i] = transactions[i]
+				}
+				return items, err
+			})
+		}},
+		{"points_history.json", func(w io.Writer) error {
+			return writeJSONArray(w, historyPages(ctx, db, userID, ""))
+		}},
+		{"redemptions.json", func(w io.Writer) error {
+			return writeJSONArray(w, historyPages(ctx, db, userID, "redeem"))
+		}},
+		{"audit_events.json", func(w io.Writer) error {
+			return writeJSONArray(w, func(page int) ([]interface{}, error) {
+				events, err := db.GetAuditEvents(ctx, models.AuditFilter{UserID: userID, Page: page, PageSize: pageSize})
+				items := make([]interface{}, len(events))
+				for i := range events {
+					items[i] = events[i]
+				}
+				return items, err
+			})
+		}},
+	}
+
+	archive := zip.NewWriter(w)
+	for i, s := range sections {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: s.fileName, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return fmt.Errorf("could not add %s to archive: %v", s.fileName, err)
+		}
+		if err := s.write(file); err != nil {
+			return fmt.Errorf("could not write %s: %v", s.fileName, err)
+		}
+		if progress != nil {
+			progress(i+1, len(sections))
+		}
+	}
+
+	return archive.Close()
+}
+
+// WriteUserArchiveFile writes the archive to a file in dir and returns its path
+func WriteUserArchiveFile(ctx context.Context, db database.Database, userID int, dir string, progress func(done, total int)) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("could not create export directory: %v", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("user-%d-%s.zip", userID, time.Now().Format("20060102150405")))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("could not create export file: %v", err)
+	}
+	defer file.Close()
+
+	if err := WriteUserArchive(ctx, db, userID, file, progress); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, file.Close()
+}
+
+func historyPages(ctx context.Context, db database.Database, userID int, pointsType string) func(page int) ([]interface{}, error) {
+	return func(page int) ([]interface{}, error) {
+		history, err := db.GetPointsHistory(ctx, userID, page, pageSize, "", "", pointsType)
+		items := make([]interface{}, len(history))
+		for i := range history {
+			items[i] = history[i]
+		}
+		return items, err
+	}
+}
+
+// writeJSONArray streams pages as a single JSON array until a short page is returned
+func writeJSONArray(w io.Writer, fetch func(page int) ([]interface{}, error)) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	for page := 1; ; page++ {
+		items, err := fetch(page)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if _, err := io.WriteString(w, ",\n"); err != nil {
+					return err
+				}
+			}
+			first = false
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+
+		if len(items) < pageSize {
+			break
+		}
+	}
+
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
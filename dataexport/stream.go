@@ -0,0 +1,135 @@
+package dataexport
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// flushEvery bounds how many rows sit in the CSV buffer before they are written out
+const flushEvery = 500
+
+var (
+	historyHeader     = []string{"user_id", "transaction_id", "points", "points_type", "reason", "date"}
+	transactionHeader = []string{"id", "transaction_id", "user_id", "transaction_amount", "category", "transaction_date", "product_code", "points_earned", "created_on"}
+)
+
+// ContentType returns the media type of an export format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// ValidFormat reports whether format can be streamed
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+// StreamPointsHistory writes the matching history rows to w as they are read from the database
+func StreamPointsHistory(ctx context.Context, db database.Database, filter models.PointsHistoryRequest, format string, w io.Writer) error {
+	rw, err := newRecordWriter(w, format, historyHeader)
+	if err != nil {
+		return err
+	}
+
+	err = db.StreamPointsHistory(ctx, filter, func(entry models.PointsHistory) error {
+		return rw.write(entry, []string{
+			strconv.Itoa(entry.UserID),
+			entry.TransactionID,
+			strconv.Itoa(entry.Points),
+			entry.PointsType,
+			entry.Reason,
+			entry.Date.Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return rw.flush()
+}
+
+// StreamTransactions writes the matching transactions to w as they are read from the database
+func StreamTransactions(ctx context.Context, db database.Database, filter models.PointsHistoryRequest, format string, w io.Writer) error {
+	rw, err := newRecordWriter(w, format, transactionHeader)
+	if err != nil {
+		return err
+	}
+
+	err = db.StreamTransactions(ctx, filter, func(txn models.Transaction) error {
+		return rw.write(txn, []string{
+			strconv.Itoa(txn.ID),
+			txn.TransactionID,
+			strconv.Itoa(txn.UserID),
+			strconv.FormatFloat(txn.TransactionAmount, 'f', 2, 64),
+			txn.Category,
+			txn.TransactionDate.Format(time.RFC3339),
+			txn.ProductCode,
+			strconv.Itoa(txn.PointsEarned),
+			txn.CreatedOn.Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return rw.flush()
+}
+
+// recordWriter writes one row at a time as a CSV record or an NDJSON line
+type recordWriter struct {
+	csv     *csv.Writer
+	json    *json.Encoder
+	pending int
+}
+
+func newRecordWriter(w io.Writer, format string, header []string) (*recordWriter, error) {
+	switch format {
+	case FormatNDJSON:
+		return &recordWriter{json: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		rw := &recordWriter{csv: csv.NewWriter(w)}
+		if err := rw.csv.Write(header); err != nil {
+			return nil, err
+		}
+		return rw, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q, use csv or ndjson", format)
+	}
+}
+
+func (rw *recordWriter) write(item interface{}, record []string) error {
+	if rw.json != nil {
+		return rw.json.Encode(item)
+	}
+
+	if err := rw.csv.Write(record); err != nil {
+		return err
+	}
+	rw.pending++
+	if rw.pending >= flushEvery {
+		rw.pending = 0
+		return rw.flush()
+	}
+	return nil
+}
+
+func (rw *recordWriter) flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
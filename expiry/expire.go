@@ -0,0 +1,118 @@
+package expiry
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const (
+	// JobName is the name the expiration job saves its checkpoint under
+	JobName = "expiry"
+
+	DefaultBatchSize = 500
+)
+
+type ExpireReport struct {
+	Cutoff       time.Time `json:"cutoff"`
+	IdleCutoff   time.Time `json:"idle_cutoff"`
+	Resumed      bool      `json:"resumed"`
+	Batches      int       `json:"batches"`
+	Transactions int       `json:"transactions"`
+	Points       int       `json:"points"`
+	Completed    bool      `json:"completed"`
+}
+
+// Expire expires the points of every lot whose policy says they are due, looking at a page of
+// batchSize candidates at a time. Each page is committed together with the job's checkpoint, so a
+// run that crashed resumes where it stopped, as of the time it started, and never expires a
+// transaction twice. Lots under an inactivity policy are only looked at for accounts idle for the
+// whole window as of the run's start. When ctx is done the current page is finished and the run stops with ctx's
+// error, to be picked up again by the next run.
+func Expire(ctx context.Context, db database.Database, policies Policies, batchSize int) (*ExpireReport, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	checkpoint, err := db.GetJobCheckpoint(ctx, JobName)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExpireReport{}
+	if checkpoint != nil && checkpoint.CompletedOn == nil {
+		report.Resumed = true
+		log.Printf("Resuming expiry run started %v, %d transactions processed so far", checkpoint.StartedOn, checkpoint.Processed)
+	} else {
+		now := time.Now()
+		checkpoint = &models.JobCheckpoint{Job: JobName, Cutoff: policies.Cutoff(now), StartedOn: now}
+		if err := db.SaveJobCheckpoint(ctx, *checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	// the checkpoint only keeps the earning cutoff, the idle one follows from when the run started
+	idleCutoff := policies.IdleCutoff(checkpoint.StartedOn)
+	report.Cutoff, report.IdleCutoff = checkpoint.Cutoff, idleCutoff
+
+	// a page's calls run detached from ctx, so a shutdown lets the page commit instead of rolling
+	// it back, each call is still bounded by its database timeout
+	pageCtx := detach(ctx)
+	for {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		candidates, err := db.GetExpiryCandidates(pageCtx, 0, checkpoint.Cutoff, idleCutoff, checkpoint.CursorDate, checkpoint.CursorID, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(candidates) == 0 {
+			completed := time.Now()
+			checkpoint.CompletedOn = &completed
+			if err := db.SaveJobCheckpoint(pageCtx, *checkpoint); err != nil {
+				return report, err
+			}
+			report.Completed = true
+			return report, nil
+		}
+
+		var due []models.ExpiryCandidate
+		for _, c := range candidates {
+			if !policies.ExpiresOn(c).After(checkpoint.StartedOn) {
+				c.ExpiryReason = policies.For(c.Category, c.Tier).Reason()
+				due = append(due, c)
+			}
+		}
+		last := candidates[len(candidates)-1]
+		checkpoint.CursorDate, checkpoint.CursorID = last.TransactionDate, last.ID
+		checkpoint.Processed += len(candidates)
+
+		// a page with nothing due still moves the checkpoint on
+		expired, points, err := db.ExpireTransactions(pageCtx, due, *checkpoint)
+		if err != nil {
+			return report, err
+		}
+		report.Batches++
+		report.Transactions += expired
+		report.Points += points
+	}
+}
+
+// detachedContext keeps the values of its parent but is never cancelled and has no deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
@@ -0,0 +1,248 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const (
+	// PolicyFixed expires points a period after they were earned
+	PolicyFixed = "fixed"
+	// PolicyEndOfQuarter expires points at the end of the quarter in which the period after earning ends
+	PolicyEndOfQuarter = "end_of_quarter"
+	// PolicyInactivity expires all of a user's points a period after their last purchase or redemption
+	PolicyInactivity = "inactivity"
+
+	lotPageSize = 500
+)
+
+// Policy decides when the points of a lot expire
+type Policy struct {
+	Type   string `json:"type"`
+	Years  int    `json:"years"`
+	Months int    `json:"months"`
+	Days   int    `json:"days"`
+}
+
+// ExpiresOn returns when the points of c expire, they are expired at any time on or after it
+func (p Policy) ExpiresOn(c models.ExpiryCandidate) time.Time {
+	switch p.Type {
+	case PolicyEndOfQuarter:
+		end := p.after(c.TransactionDate)
+		firstMonth := time.Month((int(end.Month())-1)/3*3 + 1)
+		return time.Date(end.Year(), firstMonth, 1, 0, 0, 0, 0, end.Location()).AddDate(0, 3, 0)
+	case PolicyInactivity:
+		lastActivity := c.LastActivityOn
+		if lastActivity.Before(c.TransactionDate) {
+			lastActivity = c.TransactionDate
+		}
+		return p.after(lastActivity)
+	default:
+		return p.after(c.TransactionDate)
+	}
+}
+
+// Cutoff returns the latest earning date whose points could be expired at the given time. Every
+// policy type expires points no earlier than the period after earning. For an inactivity policy it
+// is also the latest activity of a user whose points could be expired.
+func (p Policy) Cutoff(at time.Time) time.Time {
+	return at.AddDate(-p.Years, -p.Months, -p.Days)
+}
+
+// Reason is written to the points history when the policy expires a lot
+func (p Policy) Reason() string {
+	switch p.Type {
+	case PolicyInactivity:
+		return "Points expired due to inactivity"
+	case PolicyEndOfQuarter:
+		return "Points expired at quarter end"
+	default:
+		return "Points expired"
+	}
+}
+
+func (p Policy) after(t time.Time) time.Time {
+	return t.AddDate(p.Years, p.Months, p.Days)
+}
+
+func (p Policy) validate() error {
+	switch p.Type {
+	case PolicyFixed, PolicyEndOfQuarter, PolicyInactivity:
+	default:
+		return fmt.Errorf("unknown expiry policy type %q, use %s, %s or %s", p.Type, PolicyFixed, PolicyEndOfQuarter, PolicyInactivity)
+	}
+	if p.Years < 0 || p.Months < 0 || p.Days < 0 || p.Years+p.Months+p.Days == 0 {
+		return fmt.Errorf("expiry policy %s needs a positive period", p.Type)
+	}
+	return nil
+}
+
+// Rule applies a policy to the lots of a purchase category, a tier or both, empty matches any
+type Rule struct {
+	Category string `json:"category,omitempty"`
+	Tier     string `json:"tier,omitempty"`
+	Policy
+}
+
+// Policies holds the program's expiry rules. The available balance, the expiration job, the
+// warnings and the statements all read expiry dates from here so they never disagree.
+type Policies struct {
+	Default Policy
+	Rules   []Rule
+}
+
+// PoliciesFromConfig reads expiryConfig, falling back to schedulerConfig's expireTime settings for
+// the default policy
+func PoliciesFromConfig(cfg *config.AppConfig) (Policies, error) {
+	var policies Policies
+	if d := cfg.ExpiryConfig.Default; d != nil {
+		policies.Default = Policy{Type: d.Type, Years: d.Years, Months: d.Months, Days: d.Days}
+		if err := policies.Default.validate(); err != nil {
+			return Policies{}, fmt.Errorf("default expiry policy: %v", err)
+		}
+	} else {
+		// the scheduler always subtracted months and days the other way round, keep its dates
+		sc := cfg.SchedulerConfig
+		policies.Default = Policy{Type: PolicyFixed, Years: sc.ExpireTimeYear, Months: -sc.ExpireTimeMonth, Days: -sc.ExpireTimeDay}
+	}
+
+	for _, p := range cfg.ExpiryConfig.Policies {
+		rule := Rule{Category: p.Category, Tier: p.Tier, Policy: Policy{Type: p.Type, Years: p.Years, Months: p.Months, Days: p.Days}}
+		if rule.Category == "" && rule.Tier == "" {
+			return Policies{}, fmt.Errorf("expiry policy %s needs a category, a tier or both, use default for everything else", p.Type)
+		}
+		if err := rule.validate(); err != nil {
+			return Policies{}, err
+		}
+		policies.Rules = append(policies.Rules, rule)
+	}
+	return policies, nil
+}
+
+// For returns the most specific policy for a category and tier: a rule naming both, then one
+// naming the category, then one naming the tier, then the default
+func (p Policies) For(category, tier string) Policy {
+	best, bestScore := p.Default, 0
+	for _, rule := range p.Rules {
+		score := 0
+		switch {
+		case rule.Category == category && rule.Tier == tier:
+			score = 3
+		case rule.Category == category && rule.Tier == "":
+			score = 2
+		case rule.Category == "" && rule.Tier == tier:
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = rule.Policy, score
+		}
+	}
+	return best
+}
+
+// ExpiresOn returns when the points of c expire under its policy
+func (p Policies) ExpiresOn(c models.ExpiryCandidate) time.Time {
+	return p.For(c.Category, c.Tier).ExpiresOn(c)
+}
+
+// Cutoff returns the latest earning date any policy other than inactivity could expire at the
+// given time, lots earned after it are not worth looking at. It is zero when every policy is an
+// inactivity policy.
+func (p Policies) Cutoff(at time.Time) time.Time {
+	return p.latestCutoff(at, false)
+}
+
+// IdleCutoff returns the latest earning date, and the latest last activity, an inactivity policy
+// could expire at the given time. It is zero when there is no inactivity policy.
+func (p Policies) IdleCutoff(at time.Time) time.Time {
+	return p.latestCutoff(at, true)
+}
+
+func (p Policies) latestCutoff(at time.Time, inactivity bool) time.Time {
+	var cutoff time.Time
+	policies := []Policy{p.Default}
+	for _, rule := range p.Rules {
+		policies = append(policies, rule.Policy)
+	}
+	for _, policy := range policies {
+		if (policy.Type == PolicyInactivity) != inactivity {
+			continue
+		}
+		if c := policy.Cutoff(at); c.After(cutoff) {
+			cutoff = c
+		}
+	}
+	return cutoff
+}
+
+// eachLot calls fn with every unexpired lot of a user (of every user when userID is 0) that could
+// expire by the given time and the date it expires, a page at a time
+func eachLot(ctx context.Context, db database.Database, policies Policies, userID int, at time.Time, fn func(lot models.ExpiryCandidate, expiresOn time.Time)) error {
+	var cursorDate time.Time
+	cursorID := 0
+	cutoff, idleCutoff := policies.Cutoff(at), policies.IdleCutoff(at)
+	for {
+		lots, err := db.GetExpiryCandidates(ctx, userID, cutoff, idleCutoff, cursorDate, cursorID, lotPageSize)
+		if err != nil {
+			return err
+		}
+		for _, lot := range lots {
+			fn(lot, policies.ExpiresOn(lot))
+		}
+		if len(lots) < lotPageSize {
+			return nil
+		}
+		last := lots[len(lots)-1]
+		cursorDate, cursorID = last.TransactionDate, last.ID
+	}
+}
+
+// ExpiringBetween returns a user's lots that expire after from and on or before to, soonest first
+func ExpiringBetween(ctx context.Context, db database.Database, policies Policies, userID int, from, to time.Time) ([]Lot, error) {
+	lots := []Lot{}
+	err := eachLot(ctx, db, policies, userID, to, func(lot models.ExpiryCandidate, expiresOn time.Time) {
+		if expiresOn.After(from) && !expiresOn.After(to) {
+			lots = append(lots, Lot{
+				TransactionID:   lot.TransactionID,
+				Category:        lot.Category,
+				TransactionDate: lot.TransactionDate,
+				Points:          lot.PointsEarned,
+				ExpiresOn:       expiresOn,
+			})
+		}
+	})
+	sort.SliceStable(lots, func(i, j int) bool { return lots[i].ExpiresOn.Before(lots[j].ExpiresOn) })
+	return lots, err
+}
+
+// AvailablePoints returns the points a user can spend at the given time, the balance less the lots
+// that expired by then but were not taken off it by the expiration job yet
+func AvailablePoints(ctx context.Context, db database.Database, policies Policies, userID int, at time.Time) (int, error) {
+	balance, err := db.GetPointsBalance(ctx, userID)
+	if errors.Is(err, database.ErrNoPointsBalance) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	lapsed := 0
+	err = eachLot(ctx, db, policies, userID, at, func(lot models.ExpiryCandidate, expiresOn time.Time) {
+		if !expiresOn.After(at) {
+			lapsed += lot.PointsEarned
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if available := balance.TotalPoints - lapsed; available > 0 {
+		return available, nil
+	}
+	return 0, nil
+}
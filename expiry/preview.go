@@ -0,0 +1,94 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Lot is the points of one earning transaction that would expire
+type Lot struct {
+	TransactionID   string    `json:"transaction_id"`
+	Category        string    `json:"category"`
+	TransactionDate time.Time `json:"transaction_date"`
+	Points          int       `json:"points"`
+	ExpiresOn       time.Time `json:"expires_on"`
+}
+
+type UserPreview struct {
+	UserID       int   `json:"user_id"`
+	Transactions int   `json:"transactions"`
+	Points       int   `json:"points"`
+	Lots         []Lot `json:"lots"`
+}
+
+// Preview is what the expiration job would expire if it ran at AsOf
+type Preview struct {
+	AsOf         time.Time     `json:"as_of"`
+	Cutoff       time.Time     `json:"cutoff"`
+	IdleCutoff   time.Time     `json:"idle_cutoff"`
+	Users        int           `json:"users"`
+	Transactions int           `json:"transactions"`
+	Points       int           `json:"points"`
+	ByUser       []UserPreview `json:"by_user"`
+}
+
+// ParseAsOf reads a preview date, either YYYY-MM-DD, meaning the end of that day, or RFC 3339.
+// An empty value is now.
+func ParseAsOf(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	return at, nil
+}
+
+// PreviewExpiry lists the lots the expiration job would expire at asOf, with totals per user and
+// overall. It applies the same policies as the job but writes nothing, not even a checkpoint.
+func PreviewExpiry(ctx context.Context, db database.Database, policies Policies, asOf time.Time) (*Preview, error) {
+	preview := &Preview{AsOf: asOf, Cutoff: policies.Cutoff(asOf), IdleCutoff: policies.IdleCutoff(asOf)}
+	byUser := map[int]*UserPreview{}
+
+	err := eachLot(ctx, db, policies, 0, asOf, func(lot models.ExpiryCandidate, expiresOn time.Time) {
+		if expiresOn.After(asOf) {
+			return
+		}
+
+		user, exists := byUser[lot.UserID]
+		if !exists {
+			user = &UserPreview{UserID: lot.UserID}
+			byUser[lot.UserID] = user
+		}
+		user.Lots = append(user.Lots, Lot{
+			TransactionID:   lot.TransactionID,
+			Category:        lot.Category,
+			TransactionDate: lot.TransactionDate,
+			Points:          lot.PointsEarned,
+			ExpiresOn:       expiresOn,
+		})
+		user.Transactions++
+		user.Points += lot.PointsEarned
+		preview.Transactions++
+		preview.Points += lot.PointsEarned
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range byUser {
+		preview.ByUser = append(preview.ByUser, *user)
+	}
+	sort.Slice(preview.ByUser, func(i, j int) bool { return preview.ByUser[i].UserID < preview.ByUser[j].UserID })
+	preview.Users = len(preview.ByUser)
+	return preview, nil
+}
@@ -0,0 +1,161 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/notify"
+)
+
+const (
+	NotificationPointsExpiring = "points.expiring"
+
+	pendingWarningBatch = 500
+)
+
+type WarningReport struct {
+	Recorded     int `json:"recorded"`
+	Notified     int `json:"notified"`
+	Users        int `json:"users"`
+	FailedToSend int `json:"failed_to_send"`
+}
+
+// Warn records a warning for every lot expiring within one of the windows (in days) and notifies
+// each user once about the warnings not delivered yet. A lot is filed under the smallest window it
+// falls in, so it is warned about again when it crosses into a smaller window but never twice for
+// the same one. Warnings that fail to send stay pending and are retried on the next run.
+func Warn(ctx context.Context, db database.Database, notifier notify.Notifier, policies Policies, windows []int) (*WarningReport, error) {
+	report := &WarningReport{}
+
+	warnings, err := findExpiringLots(ctx, db, policies, windows, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if report.Recorded, err = db.RecordExpiryWarnings(ctx, warnings); err != nil {
+		return nil, err
+	}
+
+	for {
+		pending, err := db.GetPendingExpiryWarnings(ctx, pendingWarningBatch)
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) == 0 {
+			return report, nil
+		}
+
+		sent := false
+		for _, lots := range groupByUser(pending) {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+
+			if err := notifier.Notify(ctx, expiryNotification(lots)); err != nil {
+				report.FailedToSend += len(lots)
+				continue
+			}
+
+			ids := make([]int64, len(lots))
+			for i, lot := range lots {
+				ids[i] = lot.ID
+			}
+			if err := db.MarkExpiryWarningsNotified(ctx, ids); err != nil {
+				return nil, err
+			}
+			report.Notified += len(lots)
+			report.Users++
+			sent = true
+		}
+
+		// everything left is failing, leave it for the next run
+		if !sent || len(pending) < pendingWarningBatch {
+			return report, nil
+		}
+	}
+}
+
+func findExpiringLots(ctx context.Context, db database.Database, policies Policies, windows []int, now time.Time) ([]models.ExpiryWarning, error) {
+	sorted := []int{}
+	for _, days := range windows {
+		if days > 0 {
+			sorted = append(sorted, days)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	sort.Ints(sorted)
+
+	// lots already due are the expiration job's, not worth a warning
+	var warnings []models.ExpiryWarning
+	horizon := now.AddDate(0, 0, sorted[len(sorted)-1])
+	err := eachLot(ctx, db, policies, 0, policies.Cutoff(horizon), func(lot models.ExpiryCandidate, expiresOn time.Time) {
+		if !expiresOn.After(now) {
+			return
+		}
+		for _, days := range sorted {
+			if expiresOn.After(now.AddDate(0, 0, days)) {
+				continue
+			}
+			warnings = append(warnings, models.ExpiryWarning{
+				UserID:        lot.UserID,
+				TransactionID: lot.TransactionID,
+				WindowDays:    days,
+				Points:        lot.PointsEarned,
+				ExpiresOn:     expiresOn,
+			})
+			return
+		}
+	})
+	return warnings, err
+}
+
+// groupByUser splits warnings, which are ordered by user, into one slice per user
+func groupByUser(warnings []models.ExpiryWarning) [][]models.ExpiryWarning {
+	var groups [][]models.ExpiryWarning
+	for i, warning := range warnings {
+		if i == 0 || warning.UserID != warnings[i-1].UserID {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], warning)
+	}
+	return groups
+}
+
+func expiryNotification(lots []models.ExpiryWarning) notify.Notification {
+	total := 0
+	soonest := lots[0].ExpiresOn
+	items := make([]map[string]interface{}, len(lots))
+	for i, lot := range lots {
+		total += lot.Points
+		if lot.ExpiresOn.Before(soonest) {
+			soonest = lot.ExpiresOn
+		}
+		items[i] = map[string]interface{}{
+			"transaction_id": lot.TransactionID,
+			"points":         lot.Points,
+			"expires_on":     lot.ExpiresOn,
+			"window_days":    lot.WindowDays,
+		}
+	}
+
+	return notify.Notification{
+		ID:      uuid.New().String(),
+		Type:    NotificationPointsExpiring,
+		UserID:  lots[0].UserID,
+		Email:   lots[0].Email,
+		Subject: "Your points are about to expire",
+		Message: fmt.Sprintf("%d points expire soon, the first on %s. Redeem them before they lapse.", total, soonest.Format("02 Jan 2006")),
+		Data: map[string]interface{}{
+			"points":     total,
+			"expires_on": soonest,
+			"lots":       items,
+		},
+		CreatedOn: time.Now().UTC(),
+	}
+}
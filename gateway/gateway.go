@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database"
 	"github.com/lakshay88/reward-management-system/gateway/routers"
@@ -27,8 +28,11 @@ func (g *Gateway) RegisterGateWayService(cfg *config.AppConfig, db database.Data
 
 	// Initialize the chi engine
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
 	apiRouter := routers.NewRouter()
-	apiRouter.RegisterRoutes(r, cfg, db)
+	if err := apiRouter.RegisterRoutes(r, cfg, db); err != nil {
+		return err
+	}
 
 	// http server
 	srv := &http.Server{
@@ -1,11 +1,14 @@
 package routers
 
 import (
+	"fmt"
+
 	"github.com/go-chi/chi/v5"
 	auth "github.com/lakshay88/reward-management-system/authentation"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database"
 	"github.com/lakshay88/reward-management-system/handlers"
+	"github.com/lakshay88/reward-management-system/notify"
 )
 
 type Routers struct{}
@@ -14,8 +17,13 @@ func NewRouter() *Routers {
 	return &Routers{}
 }
 
-func (r *Routers) RegisterRoutes(router *chi.Mux, cfg *config.AppConfig, db database.Database) {
-	handlersInstance := handlers.NewHandlers()
+func (r *Routers) RegisterRoutes(router *chi.Mux, cfg *config.AppConfig, db database.Database) error {
+	// email verification codes are sent through it
+	notifier, err := notify.New(cfg.NotificationConfig, db)
+	if err != nil {
+		return fmt.Errorf("Failed to create notifier: %v", err)
+	}
+	handlersInstance := handlers.NewHandlers(cfg, notifier)
 
 	// User routes
 	// User registration and login routes
@@ -23,12 +31,28 @@ func (r *Routers) RegisterRoutes(router *chi.Mux, cfg *config.AppConfig, db data
 	router.Post("/login", handlersInstance.LoginRequest(cfg, db))
 	router.Post("/refresh-token", handlersInstance.RefreshToken(cfg, db))
 
-	authMiddleware := auth.AuthMiddleware()
+	authMiddleware := auth.AuthMiddleware(db)
 
 	router.With(authMiddleware).Get("/user", handlersInstance.GetUserByID(cfg, db))
+	router.With(authMiddleware).Put("/user", handlersInstance.UpdateUserProfile(cfg, db))
+	router.With(authMiddleware).Post("/user/verify-email", handlersInstance.VerifyEmail(cfg, db))
+	router.With(authMiddleware).Post("/user/change-password", handlersInstance.ChangePassword(cfg, db))
+	router.With(authMiddleware).Post("/user/close", handlersInstance.CloseAccount(cfg, db))
+
+	// User data export
+	router.With(authMiddleware).Post("/user/export", handlersInstance.RequestUserExport(cfg, db))
+	router.With(authMiddleware).Get("/user/export/{jobID}", handlersInstance.GetUserExport(cfg, db))
+	router.With(authMiddleware).Get("/user/export/{jobID}/download", handlersInstance.DownloadUserExport(cfg, db))
 	// Add Transaction
 	router.With(authMiddleware).Post("/transaction/add", handlersInstance.AddTransactions(cfg, db))
 
+	// Batch transaction ingestion
+	router.With(authMiddleware).Post("/transactions/batch", handlersInstance.BatchTransactions(cfg, db))
+
+	// Bulk transaction import
+	router.With(authMiddleware).Post("/transactions/import", handlersInstance.ImportTransactions(cfg, db))
+	router.With(authMiddleware).Get("/transactions/import/{jobID}", handlersInstance.GetTransactionImport(cfg, db))
+
 	// Get Points balance
 	router.With(authMiddleware).Get("/points/balance", handlersInstance.PointBalance(cfg, db))
 
@@ -37,4 +61,38 @@ func (r *Routers) RegisterRoutes(router *chi.Mux, cfg *config.AppConfig, db data
 
 	// Get Point History
 	router.With(authMiddleware).Post("/points/history", handlersInstance.GetPointsHistory(cfg, db))
+
+	// Notification preferences
+	router.With(authMiddleware).Get("/user/notifications/preferences", handlersInstance.GetNotificationPreferences(cfg, db))
+	router.With(authMiddleware).Put("/user/notifications/preferences", handlersInstance.UpdateNotificationPreferences(cfg, db))
+
+	// Monthly statement
+	router.With(authMiddleware).Get("/points/statement", handlersInstance.GetStatement(cfg, db))
+
+	// CSV / NDJSON exports
+	router.With(authMiddleware).Get("/points/history/export", handlersInstance.ExportPointsHistory(cfg, db))
+	router.With(authMiddleware).Get("/transactions/export", handlersInstance.ExportTransactions(cfg, db))
+
+	// Admin routes
+	adminMiddleware := auth.AdminMiddleware()
+	router.With(authMiddleware, adminMiddleware).Get("/admin/points/history/export", handlersInstance.ExportAllPointsHistory(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/transactions/export", handlersInstance.ExportAllTransactions(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/audit", handlersInstance.GetAuditEvents(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/audit/verify", handlersInstance.VerifyAuditChain(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Post("/admin/points/adjust", handlersInstance.AdjustPoints(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Post("/admin/transactions/{transactionID}/refund", handlersInstance.RefundTransaction(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/expiry/preview", handlersInstance.PreviewExpiry(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Put("/admin/users/{userID}/tier", handlersInstance.SetUserTier(cfg, db))
+
+	router.With(authMiddleware, adminMiddleware).Get("/admin/notifications/deliveries", handlersInstance.ListNotificationDeliveries(cfg, db))
+
+	// Merchant webhooks
+	router.With(authMiddleware, adminMiddleware).Post("/admin/webhooks", handlersInstance.CreateWebhook(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/webhooks", handlersInstance.ListWebhooks(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Delete("/admin/webhooks/{id}", handlersInstance.DeleteWebhook(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/webhooks/{id}/deliveries", handlersInstance.ListWebhookDeliveries(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Get("/admin/webhooks/deliveries/{deliveryID}", handlersInstance.GetWebhookDelivery(cfg, db))
+	router.With(authMiddleware, adminMiddleware).Post("/admin/webhooks/deliveries/{deliveryID}/redeliver", handlersInstance.RedeliverWebhook(cfg, db))
+
+	return nil
 }
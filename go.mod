@@ -7,6 +7,8 @@ require (
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/crypto v0.29.0
 	gopkg.in/yaml.v3 v3.0.1
 )
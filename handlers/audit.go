@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	auth "github.com/lakshay88/reward-management-system/authentation"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// auditedDB attributes the writes made while serving r to the caller and request ID. The caller is
+// named by user ID, the audit log never holds an email address.
+func auditedDB(r *http.Request, db database.Database) database.Database {
+	meta := models.AuditMeta{Actor: "anonymous", RequestID: middleware.GetReqID(r.Context())}
+	if userID, ok := auth.UserIDFromContext(r.Context()); ok {
+		meta.Actor = fmt.Sprintf("user:%d", userID)
+	}
+	return db.WithAuditMeta(meta)
+}
+
+func (h *Handlers) GetAuditEvents(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := models.AuditFilter{
+			Actor:      query.Get("actor"),
+			Action:     query.Get("action"),
+			TargetType: query.Get("target_type"),
+			TargetID:   query.Get("target_id"),
+			RequestID:  query.Get("request_id"),
+			StartDate:  query.Get("start_date"),
+			EndDate:    query.Get("end_date"),
+		}
+		filter.UserID, _ = strconv.Atoi(query.Get("user_id"))
+		filter.Page, _ = strconv.Atoi(query.Get("page"))
+		filter.PageSize, _ = strconv.Atoi(query.Get("page_size"))
+
+		if filter.Page < 1 {
+			filter.Page = 1
+		}
+		if filter.PageSize < 1 || filter.PageSize > 100 {
+			filter.PageSize = 20
+		}
+
+		events, err := db.GetAuditEvents(r.Context(), filter)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"events":    events,
+			"page":      filter.Page,
+			"page_size": filter.PageSize,
+		})
+	}
+}
+
+func (h *Handlers) VerifyAuditChain(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := db.VerifyAuditChain(r.Context())
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		status := http.StatusOK
+		if !result.Valid {
+			status = http.StatusConflict
+		}
+		utils.RespondWithJSON(w, status, result)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/handlers/validations"
+)
+
+const defaultMaxBatchItems = 1000
+
+// BatchTransactions records up to maxBatchItems transactions in one call and reports the outcome
+// of each item by its position, invalid or duplicate items do not fail the rest of the batch
+func (h *Handlers) BatchTransactions(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.BatchTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		maxItems := cfg.ImportConfig.MaxBatchItems
+		if maxItems <= 0 {
+			maxItems = defaultMaxBatchItems
+		}
+		if len(request.Transactions) == 0 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "No transactions in batch"})
+			return
+		}
+		if len(request.Transactions) > maxItems {
+			utils.RespondWithJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("Batch has %d transactions, the limit is %d", len(request.Transactions), maxItems),
+			})
+			return
+		}
+
+		results := make([]models.BatchTransactionResult, len(request.Transactions))
+		valid := make([]models.Transaction, 0, len(request.Transactions))
+		positions := make([]int, 0, len(request.Transactions))
+		for i, txn := range request.Transactions {
+			if err := validations.ValidateTransaction(txn); err != nil {
+				results[i] = models.BatchTransactionResult{Index: i, Status: models.BatchItemInvalid, TransactionID: txn.TransactionID, Error: err.Error()}
+				continue
+			}
+			valid = append(valid, txn)
+			positions = append(positions, i)
+		}
+
+		recorded, err := db.AddTransactionsBatch(r.Context(), valid)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+		for n, result := range recorded {
+			result.Index = positions[n]
+			results[positions[n]] = result
+		}
+
+		summary := map[string]int{}
+		for _, result := range results {
+			summary[result.Status]++
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"summary": summary,
+			"results": results,
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/expiry"
+)
+
+// PreviewExpiry reports which users and lots the expiration job would expire at ?as_of=YYYY-MM-DD
+// (now by default), without expiring anything
+func (h *Handlers) PreviewExpiry(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		asOf, err := expiry.ParseAsOf(r.URL.Query().Get("as_of"))
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		policies, err := expiry.PoliciesFromConfig(cfg)
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		preview, err := expiry.PreviewExpiry(r.Context(), db, policies, asOf)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, preview)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/dataexport"
+	"github.com/lakshay88/reward-management-system/jobs"
+)
+
+const userExportJobKind = "user-export"
+
+// RequestUserExport starts building the caller's data archive in the background, admins may name
+// any user
+func (h *Handlers) RequestUserExport(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input models.GetUserInput
+		if err := json.NewDecoder(r.Body).Decode(&input); (err != nil && err != io.EOF) || input.UserID < 0 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+		userID, ok := callerUserID(w, r, input.UserID, true)
+		if !ok {
+			return
+		}
+
+		if _, err := db.GetUserByID(r.Context(), userID, nil); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
+			return
+		}
+
+		job := h.jobs.Submit(userExportJobKind, userID, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			return dataexport.WriteUserArchiveFile(ctx, db, userID, cfg.ExportConfig.Directory, progress)
+		})
+
+		utils.RespondWithJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handlers) GetUserExport(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := h.userExport(w, r)
+		if !ok {
+			return
+		}
+
+		// the archive path is internal, only expose the download link
+		job.Result = nil
+		utils.RespondWithJSON(w, http.StatusOK, job)
+	}
+}
+
+func (h *Handlers) DownloadUserExport(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := h.userExport(w, r)
+		if !ok {
+			return
+		}
+
+		path, ok := job.Result.(string)
+		if !ok {
+			utils.RespondWithJSON(w, http.StatusConflict, map[string]string{"error": "Export is not ready", "status": string(job.Status)})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(path))
+		http.ServeFile(w, r, path)
+	}
+}
+
+// userExport returns the export job in the URL, only admins may see the exports of other users
+func (h *Handlers) userExport(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	job, exists := h.jobs.Get(chi.URLParam(r, "jobID"))
+	if !exists || job.Kind != userExportJobKind {
+		utils.RespondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Export not found"})
+		return job, false
+	}
+	if _, ok := callerUserID(w, r, job.Owner, true); !ok {
+		return job, false
+	}
+	return job, true
+}
+
+// removeUserExport deletes the archive of an export the job manager dropped
+func removeUserExport(job jobs.Job) {
+	path, ok := job.Result.(string)
+	if job.Kind != userExportJobKind || !ok {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove export archive %s: %v", path, err)
+	}
+}
@@ -1,23 +1,72 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	utils "github.com/lakshay88/reward-management-system/Utils"
 	auth "github.com/lakshay88/reward-management-system/authentation"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database"
 	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/expiry"
 	"github.com/lakshay88/reward-management-system/handlers/validations"
+	"github.com/lakshay88/reward-management-system/jobs"
+	"github.com/lakshay88/reward-management-system/notify"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type Handlers struct{}
+type Handlers struct {
+	jobs     *jobs.Manager
+	notifier notify.Notifier
+}
+
+func NewHandlers(cfg *config.AppConfig, notifier notify.Notifier) *Handlers {
+	h := &Handlers{jobs: jobs.NewManager(time.Duration(cfg.ExportConfig.RetentionInMin) * time.Minute), notifier: notifier}
+	h.jobs.OnEvict(removeUserExport)
+	return h
+}
+
+// callerUserID returns the ID of the account the request was authenticated as. A user_id named in
+// the request has to be that account, unless adminMayChoose lets admins name any account. The
+// request is answered when it returns false.
+func callerUserID(w http.ResponseWriter, r *http.Request, requested int, adminMayChoose bool) (int, bool) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized: no authenticated user"})
+		return 0, false
+	}
+	if requested == 0 || requested == userID {
+		return userID, true
+	}
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && adminMayChoose && auth.IsAdmin(claims.Username) {
+		return requested, true
+	}
+	utils.RespondWithJSON(w, http.StatusForbidden, map[string]string{"error": "Forbidden: this belongs to another user"})
+	return 0, false
+}
 
-func NewHandlers() *Handlers {
-	return &Handlers{}
+// dbErrorStatus is the status to answer a failed call with, 504 when a database call timed out
+func dbErrorStatus(err error, status int) int {
+	if errors.Is(err, database.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
+
+// respondIfTimedOut answers 504 when err is a database timeout, for the failures that are
+// otherwise reported with a fixed message, and reports whether it did
+func respondIfTimedOut(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, database.ErrTimeout) {
+		return false
+	}
+	utils.RespondWithJSON(w, http.StatusGatewayTimeout, map[string]string{"error": err.Error()})
+	return true
 }
 
 func (h *Handlers) LoginRequest(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
@@ -32,8 +81,11 @@ func (h *Handlers) LoginRequest(cfg *config.AppConfig, db database.Database) (ha
 
 		var user *models.User
 		// checking user exist or not
-		user, err = db.GetUserByEmail(loginRequest.UserEmail, user)
+		user, err = db.GetUserByEmail(r.Context(), loginRequest.UserEmail, user)
 		if err != nil {
+			if respondIfTimedOut(w, err) {
+				return
+			}
 			utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Invalid username or password"})
 			return
 		}
@@ -93,6 +145,8 @@ func (h *Handlers) RefreshToken(cfg *config.AppConfig, db database.Database) (ha
 // CreateUser handles the creation of a new user
 func (h *Handlers) CreateUser(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
 		var user models.User
 		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
@@ -105,10 +159,12 @@ func (h *Handlers) CreateUser(cfg *config.AppConfig, db database.Database) (hand
 		}
 
 		user.UserPassword = utils.HashPassword(user.UserPassword)
+		// the tier is the program's to grant, never the client's
+		user.Tier = defaultTier(cfg)
 
-		resp, err := db.CreateUser(&user)
+		resp, err := db.CreateUser(r.Context(), &user)
 		if err != nil {
-			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"Failed to create user error": err.Error()})
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"Failed to create user error": err.Error()})
 			return
 		}
 
@@ -116,6 +172,171 @@ func (h *Handlers) CreateUser(cfg *config.AppConfig, db database.Database) (hand
 	}
 }
 
+func (h *Handlers) UpdateUserProfile(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.UpdateProfileRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		if err := validations.ProfileUpdateValidation(request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"Validation Error": err.Error()})
+			return
+		}
+		userID, ok := callerUserID(w, r, request.UserID, false)
+		if !ok {
+			return
+		}
+
+		user, verificationToken, err := db.UpdateUserProfile(r.Context(), &models.User{ID: userID, Username: request.Username, Email: request.Email})
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"Failed to update user error": err.Error()})
+			return
+		}
+
+		response := map[string]interface{}{
+			"message": "Profile updated successfully",
+			"user":    user,
+		}
+		if verificationToken != "" {
+			// the token proves the new address is the user's, so it only ever goes to that address
+			err := h.notifier.Notify(r.Context(), emailVerification(user, verificationToken))
+			if err != nil {
+				utils.RespondWithJSON(w, http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("Profile updated but the verification email could not be sent, submit the email again: %v", err)})
+				return
+			}
+			response["message"] = "Profile updated, confirm the new email with the code sent to it to complete the change"
+		}
+		utils.RespondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+func emailVerification(user *models.User, token string) notify.Notification {
+	return notify.Notification{
+		ID:        uuid.New().String(),
+		Type:      notify.NotificationEmailVerification,
+		UserID:    user.ID,
+		Email:     user.PendingEmail,
+		Channel:   models.NotificationChannelEmail,
+		Subject:   "Confirm your new email address",
+		Message:   fmt.Sprintf("Use this code to confirm %s as the email address of your rewards account: %s", user.PendingEmail, token),
+		Data:      map[string]interface{}{"email": user.PendingEmail, "token": token},
+		CreatedOn: time.Now().UTC(),
+	}
+}
+
+func (h *Handlers) VerifyEmail(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		user, err := db.VerifyUserEmail(r.Context(), request.Token)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Email verified successfully",
+			"user":    user,
+		})
+	}
+}
+
+func (h *Handlers) ChangePassword(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		if err := validations.PasswordValidation(request.NewPassword); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"Validation Error": err.Error()})
+			return
+		}
+		userID, ok := callerUserID(w, r, request.UserID, false)
+		if !ok {
+			return
+		}
+
+		if err := checkUserPassword(r.Context(), db, userID, request.CurrentPassword); err != nil {
+			if respondIfTimedOut(w, err) {
+				return
+			}
+			utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Current password is incorrect"})
+			return
+		}
+
+		err := db.UpdateUserPassword(r.Context(), userID, utils.HashPassword(request.NewPassword))
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
+	}
+}
+
+func (h *Handlers) CloseAccount(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.CloseAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		userID, ok := callerUserID(w, r, request.UserID, false)
+		if !ok {
+			return
+		}
+
+		if err := checkUserPassword(r.Context(), db, userID, request.Password); err != nil {
+			if respondIfTimedOut(w, err) {
+				return
+			}
+			utils.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"error": "Password is incorrect"})
+			return
+		}
+
+		closure, err := db.CloseUserAccount(r.Context(), userID, cfg.AccountConfig.ClosurePolicy, cfg.AccountConfig.CashOutRate)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Account closed successfully",
+			"closure": closure,
+		})
+	}
+}
+
+// checkUserPassword confirms the password belongs to the given open account
+func checkUserPassword(ctx context.Context, db database.Database, userID int, password string) error {
+	user, err := db.GetUserByID(ctx, userID, nil)
+	if err != nil {
+		return err
+	}
+	user, err = db.GetUserByEmail(ctx, user.Email, user)
+	if err != nil {
+		return err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.UserPassword), []byte(password))
+}
+
 func (h *Handlers) GetUserByID(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var input models.GetUserInput
@@ -128,15 +349,15 @@ func (h *Handlers) GetUserByID(cfg *config.AppConfig, db database.Database) (han
 		var err error
 
 		if input.UserID != 0 {
-			user, err = db.GetUserByID(input.UserID, user)
+			user, err = db.GetUserByID(r.Context(), input.UserID, user)
 			if err != nil {
-				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"Failed to get user error": err.Error()})
+				utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"Failed to get user error": err.Error()})
 				return
 			}
 		} else if input.UserEmail != "" {
-			user, err = db.GetUserByEmail(input.UserEmail, user)
+			user, err = db.GetUserByEmail(r.Context(), input.UserEmail, user)
 			if err != nil {
-				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"Failed to get user by UserEmail error": err.Error()})
+				utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"Failed to get user by UserEmail error": err.Error()})
 				return
 			}
 			user.UserPassword = ""
@@ -150,6 +371,7 @@ func (h *Handlers) GetUserByID(cfg *config.AppConfig, db database.Database) (han
 
 func (h *Handlers) AddTransactions(cfg *config.AppConfig, db database.Database) (handlerFn http.HandlerFunc) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
 
 		var txn models.Transaction
 
@@ -167,9 +389,12 @@ func (h *Handlers) AddTransactions(cfg *config.AppConfig, db database.Database)
 			return
 		}
 
-		txnCreated, err := db.AddTransaction(&txn)
-		if err != nil {
-			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		txnCreated, err := db.AddTransaction(r.Context(), &txn)
+		if err == database.ErrDuplicateTransaction {
+			utils.RespondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		} else if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
 			return
 		}
 
@@ -199,16 +424,16 @@ func (h *Handlers) PointBalance(cfg *config.AppConfig, db database.Database) (ha
 			pointBalanceRequest.Limit = 10
 		}
 
-		balance, err := db.GetPointsBalance(pointBalanceRequest.UserID)
+		balance, err := db.GetPointsBalance(r.Context(), pointBalanceRequest.UserID)
 		if err != nil {
-			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
 			return
 		}
 
 		// Fetch paginated points history
-		history, err := db.GetPointsHistory(pointBalanceRequest.UserID, pointBalanceRequest.Page, pointBalanceRequest.Limit, "", "", "")
+		history, err := db.GetPointsHistory(r.Context(), pointBalanceRequest.UserID, pointBalanceRequest.Page, pointBalanceRequest.Limit, "", "", "")
 		if err != nil {
-			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
 			return
 		}
 
@@ -237,9 +462,9 @@ func (h *Handlers) GetPointsHistory(cfg *config.AppConfig, db database.Database)
 			request.PageSize = 10
 		}
 
-		transactions, err := db.GetPointsHistory(request.UserID, request.Page, request.PageSize, request.StartDate, request.EndDate, request.TransactionType)
+		transactions, err := db.GetPointsHistory(r.Context(), request.UserID, request.Page, request.PageSize, request.StartDate, request.EndDate, request.TransactionType)
 		if err != nil {
-			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
 			return
 		}
 
@@ -255,6 +480,7 @@ func (h *Handlers) GetPointsHistory(cfg *config.AppConfig, db database.Database)
 
 func (h *Handlers) RedeemPoints(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
 
 		var request models.RedeemPointsRequest
 		err := json.NewDecoder(r.Body).Decode(&request)
@@ -269,10 +495,15 @@ func (h *Handlers) RedeemPoints(cfg *config.AppConfig, db database.Database) htt
 			return
 		}
 
-		// getting points
-		totalAvailablePoints, err := db.GetAvailablePoints(request.UserID)
+		// getting points that have not expired under the user's expiry policies
+		policies, err := expiry.PoliciesFromConfig(cfg)
 		if err != nil {
-			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch points balance"})
+			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		totalAvailablePoints, err := expiry.AvailablePoints(r.Context(), db, policies, request.UserID, time.Now())
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": "Failed to fetch points balance"})
 			return
 		}
 		if request.PointsToRedeem > totalAvailablePoints {
@@ -280,15 +511,13 @@ func (h *Handlers) RedeemPoints(cfg *config.AppConfig, db database.Database) htt
 			return
 		}
 
-		remainingBalance, err := db.DeductPoints(request.UserID, request.PointsToRedeem)
-		if err != nil {
-			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		// the balance is checked again under its lock, it may have been spent since it was read
+		remainingBalance, err := db.DeductPoints(r.Context(), request.UserID, request.PointsToRedeem)
+		if errors.Is(err, database.ErrInsufficientPoints) || errors.Is(err, database.ErrNoPointsBalance) {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Insufficient points for redemption"})
 			return
-		}
-
-		err = db.LogPointsHistory(request.UserID, request.PointsToRedeem, "redeem", "Points redeemed for discount")
-		if err != nil {
-			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to log points history"})
+		} else if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
 			return
 		}
 
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/importer"
+)
+
+const transactionImportJobKind = "transaction-import"
+
+// ImportTransactions accepts a CSV or NDJSON upload, either as the "file" form field or as the raw
+// body. Small files are imported right away, large ones (or ?async=true) run as a background job.
+func (h *Handlers) ImportTransactions(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+		// an async import's report lists every row, only the uploader and admins may poll it
+		owner, ok := callerUserID(w, r, 0, false)
+		if !ok {
+			return
+		}
+
+		if cfg.ImportConfig.MaxUploadBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, cfg.ImportConfig.MaxUploadBytes)
+		}
+
+		var upload io.Reader = r.Body
+		fileName := ""
+		if file, header, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+			upload = file
+			fileName = header.Filename
+		}
+
+		format, err := importer.DetectFormat(r.URL.Query().Get("format"), r.Header.Get("Content-Type"), fileName)
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		// spool the upload so it can be counted and read after the request is over
+		spool, err := os.CreateTemp("", "transaction-import-*")
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to store upload"})
+			return
+		}
+		size, err := io.Copy(spool, upload)
+		if err != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to read upload: " + err.Error()})
+			return
+		}
+		spool.Close()
+
+		opts := importer.Options{BatchSize: cfg.ImportConfig.BatchSize}
+		async := r.URL.Query().Get("async") == "true" || (cfg.ImportConfig.AsyncThresholdBytes > 0 && size > cfg.ImportConfig.AsyncThresholdBytes)
+		if !async {
+			defer os.Remove(spool.Name())
+			report, err := importSpooledFile(r.Context(), db, spool.Name(), format, opts)
+			if err != nil {
+				utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
+				return
+			}
+			utils.RespondWithJSON(w, http.StatusOK, report)
+			return
+		}
+
+		job := h.jobs.Submit(transactionImportJobKind, owner, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			defer os.Remove(spool.Name())
+
+			file, err := os.Open(spool.Name())
+			if err != nil {
+				return nil, err
+			}
+			opts.TotalRows, err = importer.CountRows(file, format)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			opts.Progress = progress
+			return importSpooledFile(ctx, db, spool.Name(), format, opts)
+		})
+		utils.RespondWithJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *Handlers) GetTransactionImport(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, exists := h.jobs.Get(chi.URLParam(r, "jobID"))
+		if !exists || job.Kind != transactionImportJobKind {
+			utils.RespondWithJSON(w, http.StatusNotFound, map[string]string{"error": "Import not found"})
+			return
+		}
+		if _, ok := callerUserID(w, r, job.Owner, true); !ok {
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, job)
+	}
+}
+
+func importSpooledFile(ctx context.Context, db database.Database, path, format string, opts importer.Options) (*importer.Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return importer.Import(ctx, db, file, format, opts)
+}
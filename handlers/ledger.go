@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+func (h *Handlers) AdjustPoints(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.AdjustPointsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		if request.UserID <= 0 || request.Points == 0 || request.Reason == "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "user_id, non zero points and reason are required"})
+			return
+		}
+
+		balance, err := db.AdjustPoints(r.Context(), request.UserID, request.Points, request.Reason)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Points adjusted successfully",
+			"balance": balance,
+		})
+	}
+}
+
+func (h *Handlers) RefundTransaction(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.RefundTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+		if request.Reason == "" {
+			request.Reason = "Points reversed for refunded transaction"
+		}
+
+		event, err := db.RefundTransaction(r.Context(), chi.URLParam(r, "transactionID"), request.Reason)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusBadRequest), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Transaction refunded successfully",
+			"event":   event,
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// GetNotificationPreferences returns the caller's contact details and channel preferences
+func (h *Handlers) GetNotificationPreferences(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requested := 0
+		if value := r.URL.Query().Get("user_id"); value != "" {
+			var err error
+			if requested, err = strconv.Atoi(value); err != nil || requested <= 0 {
+				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user_id"})
+				return
+			}
+		}
+		userID, ok := callerUserID(w, r, requested, false)
+		if !ok {
+			return
+		}
+
+		settings, err := db.GetNotificationSettings(r.Context(), userID)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+		preferences, err := db.GetNotificationPreferences(r.Context(), userID)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"settings":         settings,
+			"preferences":      preferences,
+			"default_channels": cfg.NotificationConfig.DefaultChannels,
+		})
+	}
+}
+
+// UpdateNotificationPreferences saves the caller's contact details and opts them in or out of
+// channels, fields left empty keep their current value
+func (h *Handlers) UpdateNotificationPreferences(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.NotificationPreferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.UserID < 0 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+		userID, ok := callerUserID(w, r, request.UserID, false)
+		if !ok {
+			return
+		}
+
+		channels := map[string]bool{}
+		for _, channel := range cfg.NotificationConfig.Channels {
+			channels[channel] = true
+		}
+		for i, p := range request.Preferences {
+			request.Preferences[i].UserID = userID
+			if !channels[p.Channel] {
+				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown notification channel " + p.Channel})
+				return
+			}
+			if p.EventType == "" {
+				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "event_type is required, use * for every event"})
+				return
+			}
+		}
+
+		if _, err := db.GetUserByID(r.Context(), userID, nil); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+
+		settings, err := db.GetNotificationSettings(r.Context(), userID)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+		settings.UserID = userID
+		if request.Locale != "" {
+			settings.Locale = request.Locale
+		}
+		if request.Phone != "" {
+			settings.Phone = request.Phone
+		}
+		if request.DeviceToken != "" {
+			settings.DeviceToken = request.DeviceToken
+		}
+
+		if err := db.UpdateNotificationPreferences(r.Context(), settings, request.Preferences); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		preferences, err := db.GetNotificationPreferences(r.Context(), userID)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message":     "Notification preferences updated successfully",
+			"settings":    settings,
+			"preferences": preferences,
+		})
+	}
+}
+
+// ListNotificationDeliveries pages through the delivery log, optionally for a single user
+func (h *Handlers) ListNotificationDeliveries(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		userID, _ := strconv.Atoi(query.Get("user_id"))
+		page, _ := strconv.Atoi(query.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+
+		deliveries, err := db.GetNotificationDeliveries(r.Context(), userID, page, limit)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"deliveries": deliveries,
+			"page":       page,
+			"limit":      limit,
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/statement"
+)
+
+// GetStatement returns the caller's points statement for ?month=YYYY-MM (the current month by
+// default) as JSON, or as an HTML page with ?format=html. Admins may name any user with user_id.
+func (h *Handlers) GetStatement(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		requested := 0
+		if value := query.Get("user_id"); value != "" {
+			var err error
+			if requested, err = strconv.Atoi(value); err != nil || requested <= 0 {
+				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user_id"})
+				return
+			}
+		}
+		userID, ok := callerUserID(w, r, requested, true)
+		if !ok {
+			return
+		}
+
+		month := query.Get("month")
+		if month == "" {
+			month = time.Now().Format("2006-01")
+		}
+
+		format := query.Get("format")
+		if format == "" {
+			format = statement.FormatJSON
+		}
+		if format != statement.FormatJSON && format != statement.FormatHTML {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be json or html"})
+			return
+		}
+
+		if _, err := db.GetUserByID(r.Context(), userID, nil); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+
+		if _, _, err := statement.Month(month, time.Local); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		opts, err := statement.OptionsFromConfig(cfg)
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		result, err := statement.Generate(r.Context(), db, userID, month, opts)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		if format == statement.FormatJSON {
+			utils.RespondWithJSON(w, http.StatusOK, result)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		statement.Write(w, result, statement.FormatHTML)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/dataexport"
+)
+
+type streamFunc func(ctx context.Context, db database.Database, filter models.PointsHistoryRequest, format string, w io.Writer) error
+
+// ExportPointsHistory streams the caller's points history as CSV or NDJSON, admins may name any user
+func (h *Handlers) ExportPointsHistory(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return streamExport(db, "points-history", dataexport.StreamPointsHistory, true)
+}
+
+// ExportTransactions streams the caller's transactions as CSV or NDJSON, admins may name any user
+func (h *Handlers) ExportTransactions(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return streamExport(db, "transactions", dataexport.StreamTransactions, true)
+}
+
+// ExportAllPointsHistory streams the points history of every user, or of user_id when given
+func (h *Handlers) ExportAllPointsHistory(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return streamExport(db, "points-history", dataexport.StreamPointsHistory, false)
+}
+
+// ExportAllTransactions streams the transactions of every user, or of user_id when given
+func (h *Handlers) ExportAllTransactions(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return streamExport(db, "transactions", dataexport.StreamTransactions, false)
+}
+
+// streamExport reads the PointsHistoryRequest filters from the query string and streams the rows
+// straight to the response, nothing is buffered beyond a few hundred CSV records. A per user export
+// is of the caller's own rows unless an admin names another user.
+func streamExport(db database.Database, name string, stream streamFunc, perUser bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			format = dataexport.FormatCSV
+		}
+		if !dataexport.ValidFormat(format) {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv or ndjson"})
+			return
+		}
+
+		filter := models.PointsHistoryRequest{
+			StartDate:       query.Get("start_date"),
+			EndDate:         query.Get("end_date"),
+			TransactionType: query.Get("transaction_type"),
+		}
+		if userID := query.Get("user_id"); userID != "" {
+			id, err := strconv.Atoi(userID)
+			if err != nil || id <= 0 {
+				utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user_id"})
+				return
+			}
+			filter.UserID = id
+		}
+		if perUser {
+			userID, ok := callerUserID(w, r, filter.UserID, true)
+			if !ok {
+				return
+			}
+			filter.UserID = userID
+		}
+
+		fileName := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102150405"), format)
+		out := &streamWriter{ResponseWriter: w, contentType: dataexport.ContentType(format), fileName: fileName}
+		if err := stream(r.Context(), db, filter, format, out); err != nil {
+			if !out.started {
+				utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+				return
+			}
+			// the status line is already sent, all we can do is cut the stream short
+			log.Printf("Export of %s stopped: %v", name, err)
+			return
+		}
+		if !out.started {
+			out.start()
+		}
+	}
+}
+
+// streamWriter sends the download headers with the first write so an error raised before any row
+// was read can still be answered with a JSON error, and flushes every write to the client
+type streamWriter struct {
+	http.ResponseWriter
+	contentType string
+	fileName    string
+	started     bool
+}
+
+func (s *streamWriter) start() {
+	s.started = true
+	s.Header().Set("Content-Type", s.contentType)
+	s.Header().Set("Content-Disposition", "attachment; filename="+s.fileName)
+	s.WriteHeader(http.StatusOK)
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		s.start()
+	}
+	n, err := s.ResponseWriter.Write(p)
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const fallbackTier = "standard"
+
+// defaultTier is the tier new users start in, the first configured one
+func defaultTier(cfg *config.AppConfig) string {
+	if len(cfg.AccountConfig.Tiers) == 0 {
+		return fallbackTier
+	}
+	return cfg.AccountConfig.Tiers[0]
+}
+
+func validTier(cfg *config.AppConfig, tier string) bool {
+	if len(cfg.AccountConfig.Tiers) == 0 {
+		return tier == fallbackTier
+	}
+	for _, t := range cfg.AccountConfig.Tiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// SetUserTier moves a user to another tier, which changes the expiry policy of their points
+func (h *Handlers) SetUserTier(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+		if err != nil || userID <= 0 {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+			return
+		}
+
+		var request models.UserTierRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+		if !validTier(cfg, request.Tier) {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Unknown tier " + request.Tier})
+			return
+		}
+
+		if _, err := db.GetUserByID(r.Context(), userID, nil); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+
+		previous, err := db.SetUserTier(r.Context(), userID, request.Tier)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"message":       "Tier updated successfully",
+			"user_id":       userID,
+			"tier":          request.Tier,
+			"previous_tier": previous,
+		})
+	}
+}
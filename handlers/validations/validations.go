@@ -16,13 +16,28 @@ func UserValidation(usr models.User) error {
 		return errors.New("invalid email format")
 	}
 
-	if len(usr.UserPassword) < 8 {
+	return PasswordValidation(usr.UserPassword)
+}
+
+func PasswordValidation(password string) error {
+	if len(password) < 8 {
 		return errors.New("password must be at least 8 characters long")
 	}
 
 	return nil
 }
 
+func ProfileUpdateValidation(req models.UpdateProfileRequest) error {
+	if req.Username == "" && req.Email == "" {
+		return errors.New("username or email must be provided")
+	}
+	if req.Email != "" && !isValidEmail(req.Email) {
+		return errors.New("invalid email format")
+	}
+
+	return nil
+}
+
 func isValidEmail(email string) bool {
 	const emailRegex = `^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}$`
 	re := regexp.MustCompile(emailRegex)
@@ -42,6 +57,9 @@ func ValidateTransaction(t models.Transaction) error {
 	if t.ProductCode == "" {
 		return errors.New("product code is required")
 	}
+	if len(t.TransactionID) > 50 {
+		return errors.New("transaction ID must be at most 50 characters")
+	}
 
 	return nil
 }
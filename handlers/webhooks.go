@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/webhooks"
+)
+
+func (h *Handlers) CreateWebhook(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		var request models.CreateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+			return
+		}
+
+		target, err := url.Parse(request.URL)
+		if request.Merchant == "" || err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "merchant and a valid http(s) url are required"})
+			return
+		}
+
+		if request.Secret == "" {
+			request.Secret, err = webhooks.NewSecret()
+			if err != nil {
+				utils.RespondWithJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to generate webhook secret"})
+				return
+			}
+		}
+
+		subscription, err := db.CreateWebhookSubscription(r.Context(), &models.WebhookSubscription{
+			Merchant:   request.Merchant,
+			URL:        request.URL,
+			Secret:     request.Secret,
+			EventTypes: request.EventTypes,
+		})
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		// the secret is only ever returned on creation
+		utils.RespondWithJSON(w, http.StatusCreated, subscription)
+	}
+}
+
+func (h *Handlers) ListWebhooks(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, err := db.GetWebhookSubscriptions(r.Context(), r.URL.Query().Get("merchant"), false)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		for i := range subscriptions {
+			subscriptions[i].Secret = ""
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"subscriptions": subscriptions})
+	}
+}
+
+func (h *Handlers) DeleteWebhook(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid webhook id"})
+			return
+		}
+
+		if err := db.DeactivateWebhookSubscription(r.Context(), id); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Webhook subscription deactivated"})
+	}
+}
+
+func (h *Handlers) ListWebhookDeliveries(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid webhook id"})
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 100 {
+			pageSize = 20
+		}
+
+		deliveries, err := db.GetWebhookDeliveries(r.Context(), id, page, pageSize)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"deliveries": deliveries,
+			"page":       page,
+			"page_size":  pageSize,
+		})
+	}
+}
+
+func (h *Handlers) GetWebhookDelivery(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid delivery id"})
+			return
+		}
+
+		delivery, err := db.GetWebhookDelivery(r.Context(), id)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+		attempts, err := db.GetWebhookDeliveryAttempts(r.Context(), id)
+		if err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusInternalServerError), map[string]string{"error": err.Error()})
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"delivery": delivery,
+			"attempts": attempts,
+		})
+	}
+}
+
+func (h *Handlers) RedeliverWebhook(cfg *config.AppConfig, db database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db := auditedDB(r, db)
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+		if err != nil {
+			utils.RespondWithJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid delivery id"})
+			return
+		}
+
+		if err := db.RedeliverWebhook(r.Context(), id); err != nil {
+			utils.RespondWithJSON(w, dbErrorStatus(err, http.StatusNotFound), map[string]string{"error": err.Error()})
+			return
+		}
+		utils.RespondWithJSON(w, http.StatusAccepted, map[string]string{"message": "Webhook delivery queued for redelivery"})
+	}
+}
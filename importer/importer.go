@@ -0,0 +1,295 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/handlers/validations"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	DefaultBatchSize = 100
+)
+
+const (
+	RowImported  = "imported"
+	RowDuplicate = "duplicate"
+	RowInvalid   = "invalid"
+	RowFailed    = "failed"
+)
+
+type RowResult struct {
+	Row           int    `json:"row"`
+	Status        string `json:"status"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	PointsEarned  int    `json:"points_earned,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Rows       int         `json:"rows"`
+	Imported   int         `json:"imported"`
+	Duplicates int         `json:"duplicates"`
+	Invalid    int         `json:"invalid"`
+	Failed     int         `json:"failed"`
+	Results    []RowResult `json:"results"`
+}
+
+func (r *Report) add(result RowResult) {
+	r.Rows++
+	switch result.Status {
+	case RowImported:
+		r.Imported++
+	case RowDuplicate:
+		r.Duplicates++
+	case RowInvalid:
+		r.Invalid++
+	case RowFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// row is a parsed line of the input, err is set when it could not be parsed
+type row struct {
+	number int
+	txn    models.Transaction
+	err    error
+}
+
+// DetectFormat picks the format from an explicit value, a content type or a file name
+func DetectFormat(format, contentType, fileName string) (string, error) {
+	switch {
+	case format != "":
+	case strings.Contains(contentType, "csv"):
+		format = FormatCSV
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		format = FormatNDJSON
+	default:
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+
+	switch format {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON, "jsonl":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported import format %q, use csv or ndjson", format)
+	}
+}
+
+// CountRows counts the data rows of an input without importing it
+func CountRows(r io.Reader, format string) (int, error) {
+	count := 0
+	err := parse(r, format, func(row) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+type Options struct {
+	BatchSize int
+	// TotalRows is only used for progress reporting, 0 when unknown
+	TotalRows int
+	Progress  func(done, total int)
+}
+
+// Import validates and records every row of r in batches, a row whose transaction_id was already
+// recorded is reported as a duplicate so re-running an import is safe. Every row must carry its
+// transaction_id, one generated on import would record the row again on every run.
+func Import(ctx context.Context, db database.Database, r io.Reader, format string, opts Options) (*Report, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	report := &Report{Results: []RowResult{}}
+	batch := make([]row, 0, opts.BatchSize)
+	flush := func() {
+		for _, result := range importBatch(ctx, db, batch) {
+			report.add(result)
+		}
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(report.Rows, opts.TotalRows)
+		}
+	}
+
+	err := parse(r, format, func(parsed row) error {
+		batch = append(batch, parsed)
+		if len(batch) == opts.BatchSize {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	return report, nil
+}
+
+// importBatch validates the rows and records the valid ones with a single batch insert
+func importBatch(ctx context.Context, db database.Database, batch []row) []RowResult {
+	results := make([]RowResult, len(batch))
+	valid := make([]models.Transaction, 0, len(batch))
+	positions := make([]int, 0, len(batch))
+	for i, parsed := range batch {
+		results[i] = RowResult{Row: parsed.number, TransactionID: parsed.txn.TransactionID}
+		if parsed.err == nil && parsed.txn.TransactionID == "" {
+			parsed.err = fmt.Errorf("transaction_id is required")
+		}
+		if parsed.err == nil {
+			parsed.err = validations.ValidateTransaction(parsed.txn)
+		}
+		if parsed.err != nil {
+			results[i].Status = RowInvalid
+			results[i].Error = parsed.err.Error()
+			continue
+		}
+		valid = append(valid, parsed.txn)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return results
+	}
+
+	recorded, err := db.AddTransactionsBatch(ctx, valid)
+	for n, i := range positions {
+		result := &results[i]
+		if err != nil {
+			result.Status = RowFailed
+			result.Error = err.Error()
+			continue
+		}
+
+		switch recorded[n].Status {
+		case models.BatchItemCreated:
+			result.Status = RowImported
+			result.TransactionID = recorded[n].TransactionID
+			result.PointsEarned = recorded[n].PointsEarned
+		case models.BatchItemDuplicate:
+			result.Status = RowDuplicate
+		default:
+			result.Status = RowInvalid
+			result.Error = recorded[n].Error
+		}
+	}
+	return results
+}
+
+func parse(r io.Reader, format string, fn func(row) error) error {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r, fn)
+	case FormatNDJSON:
+		return parseNDJSON(r, fn)
+	default:
+		return fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+// parseCSV reads a CSV with a header row naming the transaction fields
+func parseCSV(r io.Reader, fn func(row) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read CSV header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"user_id", "transaction_amount", "category", "product_code", "transaction_id"} {
+		if _, exists := columns[required]; !exists {
+			return fmt.Errorf("CSV header is missing the %s column", required)
+		}
+	}
+
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		parsed := row{number: number}
+		if err != nil {
+			parsed.err = err
+		} else {
+			parsed.txn, parsed.err = csvTransaction(record, columns)
+		}
+		if err := fn(parsed); err != nil {
+			return err
+		}
+	}
+}
+
+func csvTransaction(record []string, columns map[string]int) (models.Transaction, error) {
+	field := func(name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var txn models.Transaction
+	var err error
+	if txn.UserID, err = strconv.Atoi(field("user_id")); err != nil {
+		return txn, fmt.Errorf("invalid user_id %q", field("user_id"))
+	}
+	if txn.TransactionAmount, err = strconv.ParseFloat(field("transaction_amount"), 64); err != nil {
+		return txn, fmt.Errorf("invalid transaction_amount %q", field("transaction_amount"))
+	}
+	txn.Category = field("category")
+	txn.ProductCode = field("product_code")
+	txn.TransactionID = field("transaction_id")
+	if date := field("transaction_date"); date != "" {
+		if txn.TransactionDate, err = time.Parse(time.RFC3339, date); err != nil {
+			return txn, fmt.Errorf("invalid transaction_date %q, use RFC3339", date)
+		}
+	}
+	return txn, nil
+}
+
+// parseNDJSON reads one JSON transaction per line, blank lines are skipped
+func parseNDJSON(r io.Reader, fn func(row) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	number := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		number++
+		parsed := row{number: number}
+		parsed.err = json.Unmarshal([]byte(line), &parsed.txn)
+		if err := fn(parsed); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
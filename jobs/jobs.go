@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// DefaultRetention is how long a finished job is kept when the manager is given no retention
+const DefaultRetention = time.Hour
+
+// Job is a snapshot of a background task, Owner is the user it was submitted for, 0 for none
+type Job struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	Owner      int         `json:"-"`
+	Status     Status      `json:"status"`
+	Done       int         `json:"done"`
+	Total      int         `json:"total"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedOn  time.Time   `json:"created_on"`
+	FinishedOn *time.Time  `json:"finished_on,omitempty"`
+}
+
+// RunFunc does the work of a job, reporting progress as it goes. The job outlives the request that
+// submitted it, so it runs under its own context rather than the request's.
+type RunFunc func(ctx context.Context, progress func(done, total int)) (interface{}, error)
+
+// Manager runs jobs in the background and keeps their state in memory until they have been
+// finished for longer than the retention
+type Manager struct {
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	retention time.Duration
+	onEvict   func(Job)
+}
+
+func NewManager(retention time.Duration) *Manager {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Manager{jobs: make(map[string]*Job), retention: retention}
+}
+
+// OnEvict registers fn to be called with every job dropped after the retention, for example to
+// remove the files it produced
+func (m *Manager) OnEvict(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = fn
+}
+
+func (m *Manager) Submit(kind string, owner int, run RunFunc) Job {
+	m.evict()
+
+	job := &Job{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Owner:     owner,
+		Status:    StatusPending,
+		CreatedOn: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(job, run)
+
+	return snapshot
+}
+
+func (m *Manager) Get(id string) (Job, bool) {
+	m.evict()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// evict drops the jobs finished longer than the retention ago
+func (m *Manager) evict() {
+	cutoff := time.Now().Add(-m.retention)
+
+	m.mu.Lock()
+	var evicted []Job
+	for id, job := range m.jobs {
+		if job.FinishedOn != nil && job.FinishedOn.Before(cutoff) {
+			evicted = append(evicted, *job)
+			delete(m.jobs, id)
+		}
+	}
+	onEvict := m.onEvict
+	m.mu.Unlock()
+
+	if onEvict != nil {
+		for _, job := range evicted {
+			onEvict(job)
+		}
+	}
+}
+
+func (m *Manager) run(job *Job, run RunFunc) {
+	m.mu.Lock()
+	job.Status = StatusRunning
+	m.mu.Unlock()
+
+	result, err := run(context.Background(), func(done, total int) {
+		m.mu.Lock()
+		job.Done = done
+		job.Total = total
+		m.mu.Unlock()
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finishedOn := time.Now()
+	job.FinishedOn = &finishedOn
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Result = result
+	job.Status = StatusCompleted
+}
@@ -0,0 +1,122 @@
+package leader
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+)
+
+const DefaultRetryInterval = 5 * time.Second
+
+// leaseChecks is how many retry intervals the lease of a lease based lock lasts, so a check that
+// runs late does not let the lease lapse while this instance still leads
+const leaseChecks = 3
+
+// Elector campaigns for a shared lock and reports whether this instance currently holds it. A
+// follower retries the lock every retry interval, so when the leader dies and its lock is
+// released another instance takes over within one interval. The leader checks its lock on the
+// same interval and steps down as soon as it can no longer prove it still holds it.
+type Elector struct {
+	id     string
+	locker database.Locker
+	retry  time.Duration
+
+	mu       sync.Mutex
+	leader   bool
+	onChange func(leader bool)
+}
+
+func NewElector(id string, locker database.Locker, retry time.Duration) *Elector {
+	if retry <= 0 {
+		retry = DefaultRetryInterval
+	}
+	if leaser, ok := locker.(interface{ SetLease(time.Duration) }); ok {
+		leaser.SetLease(leaseChecks * retry)
+	}
+	return &Elector{id: id, locker: locker, retry: retry}
+}
+
+// OnChange registers fn to be called whenever this instance gains or loses leadership
+func (e *Elector) OnChange(fn func(leader bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = fn
+}
+
+// IsLeader reports whether this instance held the lock at its last check
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns until ctx is done and then releases the lock if it is held
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx, e.retry)
+	defer cancel()
+
+	if e.IsLeader() {
+		if err := e.locker.Check(checkCtx); err != nil {
+			log.Printf("Instance %s lost leadership: %v", e.id, err)
+			e.set(false)
+		}
+		return
+	}
+
+	acquired, err := e.locker.TryLock(checkCtx)
+	if err != nil {
+		log.Printf("Instance %s could not campaign for leadership: %v", e.id, err)
+		return
+	}
+	if acquired {
+		log.Printf("Instance %s is now the leader", e.id)
+		e.set(true)
+	}
+}
+
+// resign releases the lock so a follower can take over without waiting for the session to die
+func (e *Elector) resign() {
+	if !e.IsLeader() {
+		return
+	}
+	e.set(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.retry)
+	defer cancel()
+	if err := e.locker.Unlock(ctx); err != nil {
+		log.Printf("Instance %s failed to release leadership: %v", e.id, err)
+		return
+	}
+	log.Printf("Instance %s released leadership", e.id)
+}
+
+func (e *Elector) set(leader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	onChange := e.onChange
+	e.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange(leader)
+	}
+}
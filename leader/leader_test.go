@@ -0,0 +1,175 @@
+package leader_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/dbtest"
+	"github.com/lakshay88/reward-management-system/leader"
+	"github.com/lakshay88/reward-management-system/scheduler"
+)
+
+const (
+	testRetry = 100 * time.Millisecond
+	// testPhase is how long the instances run before and after the failover
+	testPhase = 2500 * time.Millisecond
+)
+
+// testInstance is one scheduler replica competing for the lock
+type testInstance struct {
+	id      string
+	locker  database.Locker
+	elector *leader.Elector
+	jobs    *scheduler.Scheduler
+	runs    int64
+	dead    int32
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+// TestFailover runs two scheduler instances against the same lock, checks that only one of them
+// runs jobs at a time, then kills the leader's lock and checks the other one takes over
+func TestFailover(t *testing.T) {
+	for _, target := range dbtest.Targets {
+		t.Run(target.Name, func(t *testing.T) {
+			testFailover(t, target.Open(t))
+		})
+	}
+}
+
+func testFailover(t *testing.T, db database.Database) {
+	var running, overlaps int64
+	tick := func(ctx context.Context) error {
+		if atomic.AddInt64(&running, 1) > 1 {
+			atomic.AddInt64(&overlaps, 1)
+		}
+		defer atomic.AddInt64(&running, -1)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+		return nil
+	}
+
+	// the Postgres database outlives the test, a lock of its own keeps runs apart
+	lockName := "leader-test-" + uuid.NewString()
+	all := make([]*testInstance, 2)
+	for i := range all {
+		inst := &testInstance{id: fmt.Sprintf("instance-%d", i+1), done: make(chan struct{})}
+		inst.locker = db.NewLocker(lockName)
+		inst.elector = leader.NewElector(inst.id, inst.locker, testRetry)
+		inst.jobs = scheduler.New(0)
+		inst.jobs.SetLeader(inst.elector)
+		inst.elector.OnChange(func(isLeader bool) {
+			if !isLeader {
+				inst.jobs.CancelRunning()
+			}
+		})
+		err := inst.jobs.Register(scheduler.Job{Name: "tick", Schedule: "@every 1s", Enabled: true, Run: func(ctx context.Context) error {
+			atomic.AddInt64(&inst.runs, 1)
+			return tick(ctx)
+		}})
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+
+		ctx, stop := context.WithCancel(context.Background())
+		inst.stop = stop
+		go func() {
+			defer close(inst.done)
+			inst.elector.Run(ctx)
+		}()
+		inst.jobs.Start(ctx)
+		all[i] = inst
+	}
+	defer func() {
+		for _, inst := range all {
+			inst.stop()
+			inst.jobs.Wait()
+			<-inst.done
+		}
+	}()
+
+	// sample leadership far more often than it can change
+	var split int64
+	sampleCtx, stopSampling := context.WithCancel(context.Background())
+	var sampling sync.WaitGroup
+	defer func() {
+		stopSampling()
+		sampling.Wait()
+	}()
+	sampling.Add(1)
+	go func() {
+		defer sampling.Done()
+		for {
+			select {
+			case <-sampleCtx.Done():
+				return
+			case <-time.After(testRetry / 4):
+			}
+			if len(leaders(all)) > 1 {
+				atomic.AddInt64(&split, 1)
+			}
+		}
+	}()
+
+	time.Sleep(testPhase)
+	current := leaders(all)
+	if len(current) != 1 {
+		t.Fatalf("Expected one leader after %v, found %d", testPhase, len(current))
+	}
+	old := current[0]
+
+	// a dead process can't act on its stale view of leadership, so stop counting it
+	atomic.StoreInt32(&old.dead, 1)
+	terminator, ok := old.locker.(interface{ Terminate(context.Context) error })
+	if !ok {
+		t.Fatalf("%T cannot be killed from outside", old.locker)
+	}
+	if err := terminator.Terminate(context.Background()); err != nil {
+		t.Fatalf("Terminate: %v", err)
+	}
+	killedOn := time.Now()
+	// the old leader is gone for good, as if its process had died with the session
+	old.stop()
+
+	var successor *testInstance
+	for successor == nil && time.Since(killedOn) < 10*testRetry {
+		time.Sleep(testRetry / 4)
+		for _, inst := range leaders(all) {
+			if inst != old {
+				successor = inst
+			}
+		}
+	}
+	if successor == nil {
+		t.Fatalf("No instance took over within %v of the leader dying", 10*testRetry)
+	}
+
+	time.Sleep(testPhase)
+	stopSampling()
+	sampling.Wait()
+	if atomic.LoadInt64(&successor.runs) == 0 {
+		t.Errorf("%s took over but never ran the job", successor.id)
+	}
+	if split, overlaps := atomic.LoadInt64(&split), atomic.LoadInt64(&overlaps); split > 0 || overlaps > 0 {
+		t.Errorf("%d samples saw several leaders, %d job runs overlapped", split, overlaps)
+	}
+}
+
+func leaders(all []*testInstance) []*testInstance {
+	var current []*testInstance
+	for _, inst := range all {
+		if atomic.LoadInt32(&inst.dead) == 0 && inst.elector.IsLeader() {
+			current = append(current, inst)
+		}
+	}
+	return current
+}
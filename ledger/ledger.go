@@ -0,0 +1,91 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Apply folds a single ledger event into a balance
+func Apply(balance models.PointsBalance, event models.PointsEvent) models.PointsBalance {
+	switch event.EventType {
+	case models.PointsEventEarned:
+		balance.TotalPoints += event.Points
+	case models.PointsEventRedeemed:
+		balance.TotalPoints -= event.Points
+		balance.PointsRedeemed += event.Points
+	case models.PointsEventExpired, models.PointsEventRefunded:
+		balance.TotalPoints -= event.Points
+	case models.PointsEventAdjusted:
+		// adjustments carry their own sign
+		balance.TotalPoints += event.Points
+	}
+	return balance
+}
+
+// Project replays events, oldest first, into the balance they produce
+func Project(events []models.PointsEvent) models.PointsBalance {
+	var balance models.PointsBalance
+	for _, event := range events {
+		balance = Apply(balance, event)
+	}
+	return balance
+}
+
+type RebuildReport struct {
+	UsersChecked  int                         `json:"users_checked"`
+	Discrepancies []models.BalanceDiscrepancy `json:"discrepancies"`
+	Applied       bool                        `json:"applied"`
+	// Changed lists the users whose balance moved while they were being rebuilt, left as they are
+	Changed []int `json:"changed"`
+}
+
+// Rebuild replays every user's events and compares the projection with points_balance.
+// When apply is set mismatching balances are overwritten with the projection, unless the user's
+// balance or events changed since they were read.
+func Rebuild(ctx context.Context, db database.Database, apply bool) (*RebuildReport, error) {
+	userIDs, err := db.ListLedgerUserIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RebuildReport{Discrepancies: []models.BalanceDiscrepancy{}, Applied: apply, Changed: []int{}}
+	for _, userID := range userIDs {
+		events, err := db.GetPointsEvents(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		projected := Project(events)
+		var lastEventID int64
+		if len(events) > 0 {
+			lastEventID = events[len(events)-1].ID
+		}
+
+		// a user without a balance row is treated as a zero balance
+		stored, err := db.GetPointsBalance(ctx, userID)
+		if err != nil && !errors.Is(err, database.ErrNoPointsBalance) {
+			return nil, err
+		}
+		report.UsersChecked++
+		if stored == projected {
+			continue
+		}
+
+		report.Discrepancies = append(report.Discrepancies, models.BalanceDiscrepancy{
+			UserID:    userID,
+			Stored:    stored,
+			Projected: projected,
+		})
+		if apply {
+			err := db.SetPointsBalance(ctx, userID, stored, lastEventID, projected)
+			if errors.Is(err, database.ErrBalanceChanged) {
+				report.Changed = append(report.Changed, userID)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
@@ -1,11 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/lakshay88/reward-management-system/cli"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/expiry"
 	"github.com/lakshay88/reward-management-system/gateway"
+	"github.com/lakshay88/reward-management-system/leader"
+	"github.com/lakshay88/reward-management-system/notify"
+	"github.com/lakshay88/reward-management-system/outbox"
+	"github.com/lakshay88/reward-management-system/webhooks"
 )
 
 // Config Variable
@@ -30,12 +42,95 @@ func init() {
 		if err != nil {
 			log.Fatalf("Failed to connect to database: %v", err)
 		}
+	case "sqlite":
+		db, err = database.ConnectionToSQLite(cfg.Database)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+	case "memory":
+		db = database.NewMemoryDB()
+	default:
+		log.Fatalf("Unknown database driver %q", cfg.Database.Driver)
+	}
+	db, err = database.WithReplicas(db, cfg.Database)
+	if err != nil {
+		log.Fatalf("Invalid database replicas: %v", err)
+	}
+	db, err = database.WithTimeouts(db, cfg.Database.Timeouts)
+	if err != nil {
+		log.Fatalf("Invalid database timeouts: %v", err)
+	}
+
+	// handlers read the policies per request, catch a bad configuration before serving any
+	if _, err := expiry.PoliciesFromConfig(cfg); err != nil {
+		log.Fatalf("Invalid expiry policies: %v", err)
 	}
 }
 
 func main() {
 
 	defer db.Close()
+
+	// Run a CLI command instead of the server when one is given
+	if len(os.Args) > 1 {
+		// interrupting a command cancels the queries it is running
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := cli.Run(ctx, os.Args[1:], cfg, db); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	// Relaying domain events from the outbox
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// CLI commands such as migrate run whatever the schema version, the server needs it current
+	if err := database.CheckSchema(ctx, db, cfg.Database.Migrations); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+	if oc := cfg.OutboxConfig; oc.Enabled {
+		publisher, err := outbox.NewPublisher(oc)
+		if err != nil {
+			log.Fatalln("Failed to create outbox publisher -", err)
+		}
+		publisherName := oc.Publisher
+		if publisherName == "" {
+			publisherName = "inprocess"
+		}
+		destinations := []outbox.Destination{{Name: publisherName, Publisher: publisher}}
+		if cfg.WebhookConfig.Enabled {
+			destinations = append(destinations, outbox.Destination{Name: "webhooks", Publisher: webhooks.NewDispatcher(db)})
+		}
+		// Notifying users of the events they opted in to
+		if cfg.NotificationConfig.Notifier == "service" {
+			service, err := notify.NewService(db, cfg.NotificationConfig)
+			if err != nil {
+				log.Fatalln("Failed to create notification service -", err)
+			}
+			destinations = append(destinations, outbox.Destination{Name: "notifications", Publisher: service})
+		}
+		relay := outbox.NewRelay(db, destinations, oc.BatchSize, time.Duration(oc.PollIntervalInSec)*time.Second,
+			oc.MaxAttempts, time.Duration(oc.ClaimLeaseInSec)*time.Second)
+
+		// one instance relays at a time, the others take over when it goes away
+		lockName := oc.LockName
+		if lockName == "" {
+			lockName = "outbox-relay"
+		}
+		hostname, _ := os.Hostname()
+		elector := leader.NewElector(fmt.Sprintf("%s-%d", hostname, os.Getpid()), db.NewLocker(lockName), 0)
+		relay.SetLeader(elector)
+		go elector.Run(ctx)
+		go relay.Run(ctx)
+	}
+
+	// Delivering merchant webhooks
+	if cfg.WebhookConfig.Enabled {
+		go webhooks.NewWorker(db, cfg.WebhookConfig).Run(ctx)
+	}
+
 	// Starting Gateway service
 	// Instance of Gateway
 	gatewayInstance := gateway.NewGateway()
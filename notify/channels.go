@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Message is a rendered notification addressed to one recipient of a channel
+type Message struct {
+	NotificationID string `json:"notification_id"`
+	EventType      string `json:"event_type"`
+	To             string `json:"to"`
+	Subject        string `json:"subject"`
+	Body           string `json:"body"`
+}
+
+// Channel sends messages through one medium, email, SMS or push
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPChannel sends email through an SMTP server
+type SMTPChannel struct {
+	cfg config.SMTPConfig
+}
+
+func NewSMTPChannel(cfg config.SMTPConfig) *SMTPChannel {
+	return &SMTPChannel{cfg: cfg}
+}
+
+func (c *SMTPChannel) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if c.cfg.Username != "" {
+		auth = smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)
+	}
+
+	body := strings.Join([]string{
+		"From: " + c.cfg.From,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		msg.Body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
+	if err := smtp.SendMail(addr, auth, c.cfg.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("smtp: %v", err)
+	}
+	return nil
+}
+
+// HTTPChannel posts messages as JSON to an SMS or push provider API
+type HTTPChannel struct {
+	name     string
+	provider config.NotificationProvider
+	client   *http.Client
+}
+
+func NewHTTPChannel(name string, provider config.NotificationProvider) *HTTPChannel {
+	timeout := time.Duration(provider.TimeoutInSec) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPChannel{name: name, provider: provider, client: &http.Client{Timeout: timeout}}
+}
+
+func (c *HTTPChannel) Send(ctx context.Context, msg Message) error {
+	if c.provider.URL == "" {
+		return fmt.Errorf("%s: no provider url configured", c.name)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"from":    c.provider.From,
+		"to":      msg.To,
+		"title":   msg.Subject,
+		"message": msg.Body,
+		"id":      msg.NotificationID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.provider.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.provider.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.provider.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: provider responded %d", c.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// LogChannel is a local stand-in that writes messages to the process log
+type LogChannel struct {
+	Name string
+}
+
+func (c LogChannel) Send(ctx context.Context, msg Message) error {
+	log.Printf("[%s] to %s: %s - %s", c.Name, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileChannel is a local stand-in that appends messages as JSON lines to a shared file
+type FileChannel struct {
+	name string
+	file *FileNotifier
+}
+
+func (c FileChannel) Send(ctx context.Context, msg Message) error {
+	line, err := json.Marshal(struct {
+		Channel string `json:"channel"`
+		Message
+	}{c.name, msg})
+	if err != nil {
+		return err
+	}
+
+	c.file.mu.Lock()
+	defer c.file.mu.Unlock()
+	_, err = c.file.file.Write(append(line, '\n'))
+	return err
+}
+
+// MemoryChannel is a local stand-in that keeps every message, for tests and dry runs
+type MemoryChannel struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (c *MemoryChannel) Send(ctx context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func (c *MemoryChannel) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Message{}, c.messages...)
+}
+
+// NewChannels builds the configured channels, every one a stand-in when cfg.Stub is set
+func NewChannels(cfg config.NotificationConfig) (map[string]Channel, error) {
+	var stub *FileNotifier
+	if cfg.Stub && cfg.StubFilePath != "" {
+		var err error
+		if stub, err = NewFileNotifier(cfg.StubFilePath); err != nil {
+			return nil, err
+		}
+	}
+
+	channels := make(map[string]Channel, len(cfg.Channels))
+	for _, name := range cfg.Channels {
+		switch name {
+		case models.NotificationChannelEmail, models.NotificationChannelSMS, models.NotificationChannelPush:
+		default:
+			return nil, fmt.Errorf("unknown notification channel %q", name)
+		}
+
+		switch {
+		case cfg.Stub && stub != nil:
+			channels[name] = FileChannel{name: name, file: stub}
+		case cfg.Stub:
+			channels[name] = LogChannel{Name: name}
+		case name == models.NotificationChannelEmail:
+			channels[name] = NewSMTPChannel(cfg.SMTP)
+		case name == models.NotificationChannelSMS:
+			channels[name] = NewHTTPChannel(name, cfg.SMS)
+		case name == models.NotificationChannelPush:
+			channels[name] = NewHTTPChannel(name, cfg.Push)
+		}
+	}
+	return channels, nil
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+)
+
+// NotificationEmailVerification carries the token confirming a new email address, it goes to that
+// address alone
+const NotificationEmailVerification = "email.verification"
+
+// Notification is a message for a single user. Email is the address to write to, the one on file
+// when empty. Channel restricts the notification to one channel whatever the user's preferences,
+// for messages that cannot be opted out of.
+type Notification struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	UserID    int                    `json:"user_id"`
+	Email     string                 `json:"email,omitempty"`
+	Channel   string                 `json:"channel,omitempty"`
+	Subject   string                 `json:"subject"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedOn time.Time              `json:"created_on"`
+}
+
+// Notifier delivers notifications to users, an error means the notification should be retried
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the process log
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("Notification %s for user %d (%s): %s - %s", n.Type, n.UserID, n.Email, n.Subject, n.Message)
+	return nil
+}
+
+// FileNotifier appends every notification as one JSON line to a file, for local use
+type FileNotifier struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("could not open notification file: %v", err)
+	}
+	return &FileNotifier{file: file}, nil
+}
+
+func (f *FileNotifier) Notify(ctx context.Context, n Notification) error {
+	line, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.file.Write(append(line, '\n'))
+	return err
+}
+
+func (f *FileNotifier) Close() error {
+	return f.file.Close()
+}
+
+// New builds the notifier selected in the notification configuration
+func New(cfg config.NotificationConfig, db database.Database) (Notifier, error) {
+	switch cfg.Notifier {
+	case "service":
+		return NewService(db, cfg)
+	case "file":
+		return NewFileNotifier(cfg.FilePath)
+	case "log", "":
+		return LogNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Notifier)
+	}
+}
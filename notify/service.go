@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Service renders notifications from templates in the user's locale and sends them on every
+// channel the user is opted in to, logging each attempt in the delivery log. It is both a
+// Notifier and an outbox publisher, so domain events can be turned into notifications.
+type Service struct {
+	db        database.Database
+	channels  map[string]Channel
+	names     []string
+	defaults  map[string]bool
+	templates *Templates
+}
+
+func NewService(db database.Database, cfg config.NotificationConfig) (*Service, error) {
+	channels, err := NewChannels(cfg)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := LoadTemplates(cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	return NewServiceWithChannels(db, channels, cfg.DefaultChannels, templates), nil
+}
+
+// NewServiceWithChannels builds a service on the given channels, for example local stand-ins
+func NewServiceWithChannels(db database.Database, channels map[string]Channel, defaultChannels []string, templates *Templates) *Service {
+	s := &Service{db: db, channels: channels, defaults: map[string]bool{}, templates: templates}
+	for name := range channels {
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	for _, name := range defaultChannels {
+		s.defaults[name] = true
+	}
+	return s
+}
+
+// Notify sends n on the user's channels. It fails only when no channel could deliver it, so a
+// caller retrying on error does not send twice on a channel that already succeeded.
+func (s *Service) Notify(ctx context.Context, n Notification) error {
+	if n.Channel != "" && s.channels[n.Channel] == nil {
+		return fmt.Errorf("no %s channel to send %s notifications on", n.Channel, n.Type)
+	}
+	user, err := s.db.GetUserByID(ctx, n.UserID, nil)
+	if err != nil {
+		return err
+	}
+	if user.ClosedOn != nil {
+		return nil
+	}
+	settings, err := s.db.GetNotificationSettings(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	preferences, err := s.db.GetNotificationPreferences(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+
+	subject, body := n.Subject, n.Message
+	if s.templates != nil && s.templates.Has(n.Type) {
+		data := n.Data
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		if subject, body, err = s.templates.Render(settings.Locale, n.Type, data); err != nil {
+			return fmt.Errorf("could not render %s notification: %v", n.Type, err)
+		}
+	}
+
+	attempted, sent := 0, 0
+	var lastErr error
+	for _, name := range s.names {
+		if n.Channel != "" && name != n.Channel {
+			continue
+		}
+		if n.Channel == "" && !s.enabled(preferences, name, n.Type) {
+			continue
+		}
+
+		delivery := models.NotificationDelivery{
+			NotificationID: n.ID,
+			UserID:         n.UserID,
+			EventType:      n.Type,
+			Channel:        name,
+			Recipient:      recipient(name, n, user, settings),
+			Subject:        subject,
+		}
+		switch {
+		case delivery.Recipient == "":
+			delivery.Status = models.NotificationDeliverySkipped
+			delivery.Error = "no " + name + " address on file"
+		default:
+			attempted++
+			err := s.channels[name].Send(ctx, Message{
+				NotificationID: n.ID,
+				EventType:      n.Type,
+				To:             delivery.Recipient,
+				Subject:        subject,
+				Body:           body,
+			})
+			if err != nil {
+				delivery.Status = models.NotificationDeliveryFailed
+				delivery.Error = err.Error()
+				lastErr = err
+			} else {
+				delivery.Status = models.NotificationDeliverySent
+				sent++
+			}
+		}
+
+		if err := s.db.LogNotificationDelivery(ctx, delivery); err != nil {
+			log.Printf("Failed to log %s notification %s: %v", name, n.ID, err)
+		}
+	}
+
+	if attempted > 0 && sent == 0 {
+		return lastErr
+	}
+	return nil
+}
+
+// Publish turns domain events that have a template into notifications. Failures are recorded in
+// the delivery log rather than returned, so one unreachable user does not hold up the outbox.
+func (s *Service) Publish(ctx context.Context, event models.DomainEvent) error {
+	if s.templates == nil || !s.templates.Has(event.Type) {
+		return nil
+	}
+
+	err := s.Notify(ctx, Notification{
+		ID:     event.ID,
+		Type:   event.Type,
+		UserID: event.UserID,
+		Data: map[string]interface{}{
+			"points":         event.Points,
+			"balance":        event.Balance.TotalPoints,
+			"transaction_id": event.TransactionID,
+			"merchant":       event.Merchant,
+			"reason":         event.Reason,
+		},
+		CreatedOn: event.OccurredOn,
+	})
+	if err != nil {
+		log.Printf("Failed to notify user %d of %s: %v", event.UserID, event.Type, err)
+	}
+	return nil
+}
+
+// enabled applies the most specific preference: the event type, then "*", then the channel default
+func (s *Service) enabled(preferences []models.NotificationPreference, channel, eventType string) bool {
+	wildcard := (*bool)(nil)
+	for i := range preferences {
+		p := preferences[i]
+		if p.Channel != channel {
+			continue
+		}
+		if p.EventType == eventType {
+			return p.Enabled
+		}
+		if p.EventType == "*" {
+			wildcard = &preferences[i].Enabled
+		}
+	}
+	if wildcard != nil {
+		return *wildcard
+	}
+	return s.defaults[channel]
+}
+
+func recipient(channel string, n Notification, user *models.User, settings models.NotificationSettings) string {
+	switch channel {
+	case models.NotificationChannelEmail:
+		if n.Email != "" {
+			return n.Email
+		}
+		return user.Email
+	case models.NotificationChannelSMS:
+		return settings.Phone
+	case models.NotificationChannelPush:
+		return settings.DeviceToken
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var templateFuncs = template.FuncMap{
+	"date": func(value interface{}) string {
+		switch t := value.(type) {
+		case time.Time:
+			return t.Format("02 Jan 2006")
+		case *time.Time:
+			if t != nil {
+				return t.Format("02 Jan 2006")
+			}
+		case string:
+			if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+				return parsed.Format("02 Jan 2006")
+			}
+			return t
+		}
+		return ""
+	},
+}
+
+// Templates holds the subject and body template of every event type in every locale, loaded
+// from templates/<locale>/<event type>.tmpl
+type Templates struct {
+	defaultLocale string
+	sets          map[string]*template.Template
+}
+
+func LoadTemplates(defaultLocale string) (*Templates, error) {
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	t := &Templates{defaultLocale: defaultLocale, sets: map[string]*template.Template{}}
+	err := fs.WalkDir(templateFiles, "templates", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path.Ext(name) != ".tmpl" {
+			return err
+		}
+
+		locale := path.Base(path.Dir(name))
+		eventType := strings.TrimSuffix(path.Base(name), ".tmpl")
+		set, err := template.New(eventType).Funcs(templateFuncs).Option("missingkey=zero").ParseFS(templateFiles, name)
+		if err != nil {
+			return fmt.Errorf("could not parse notification template %s: %v", name, err)
+		}
+		t.sets[locale+"/"+eventType] = set
+		return nil
+	})
+	return t, err
+}
+
+// Render returns the subject and body of an event for a locale, falling back to the language
+// of the locale ("es" for "es-MX") and then to the default locale
+func (t *Templates) Render(locale, eventType string, data interface{}) (string, string, error) {
+	set := t.lookup(locale, eventType)
+	if set == nil {
+		return "", "", fmt.Errorf("no notification template for %s", eventType)
+	}
+
+	var subject, body bytes.Buffer
+	if err := set.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := set.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
+
+// Has reports whether the event type has a template in the default locale
+func (t *Templates) Has(eventType string) bool {
+	return t.sets[t.defaultLocale+"/"+eventType] != nil
+}
+
+func (t *Templates) lookup(locale, eventType string) *template.Template {
+	candidates := []string{locale}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		if set := t.sets[strings.ToLower(candidate)+"/"+eventType]; set != nil {
+			return set
+		}
+	}
+	return nil
+}
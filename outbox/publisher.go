@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Publisher delivers domain events to downstream consumers. Delivery is at least once,
+// consumers should deduplicate on the event ID.
+type Publisher interface {
+	Publish(ctx context.Context, event models.DomainEvent) error
+}
+
+// HandlerFunc consumes an event published in process
+type HandlerFunc func(ctx context.Context, event models.DomainEvent) error
+
+// InProcessPublisher hands events to handlers subscribed in the same process
+type InProcessPublisher struct {
+	mu       sync.RWMutex
+	handlers map[string][]HandlerFunc
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{handlers: make(map[string][]HandlerFunc)}
+}
+
+// Subscribe registers a handler for an event type, "*" receives every event
+func (p *InProcessPublisher) Subscribe(eventType string, handler HandlerFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[eventType] = append(p.handlers[eventType], handler)
+}
+
+func (p *InProcessPublisher) Publish(ctx context.Context, event models.DomainEvent) error {
+	p.mu.RLock()
+	handlers := append(append([]HandlerFunc{}, p.handlers[event.Type]...), p.handlers["*"]...)
+	p.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NDJSONPublisher appends every event as one JSON line to a file, for local use
+type NDJSONPublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewNDJSONPublisher(path string) (*NDJSONPublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event file: %v", err)
+	}
+	return &NDJSONPublisher{file: file}, nil
+}
+
+func (p *NDJSONPublisher) Publish(ctx context.Context, event models.DomainEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.file.Write(append(line, '\n'))
+	return err
+}
+
+func (p *NDJSONPublisher) Close() error {
+	return p.file.Close()
+}
+
+// NewPublisher builds the publisher selected in the outbox configuration
+func NewPublisher(cfg config.OutboxConfig) (Publisher, error) {
+	switch cfg.Publisher {
+	case "ndjson":
+		return NewNDJSONPublisher(cfg.FilePath)
+	case "inprocess", "":
+		return NewInProcessPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", cfg.Publisher)
+	}
+}
@@ -0,0 +1,151 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const (
+	DefaultMaxAttempts = 10
+	DefaultClaimLease  = time.Minute
+)
+
+// Destination is a publisher the relay tracks deliveries to by name, an event that reached it is
+// not published to it again when another destination fails
+type Destination struct {
+	Name      string
+	Publisher Publisher
+}
+
+// Leader reports whether this instance may relay, see leader.Elector
+type Leader interface {
+	IsLeader() bool
+}
+
+// Relay polls the outbox table and publishes pending events in order
+type Relay struct {
+	db           database.Database
+	destinations []Destination
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int
+	claimLease   time.Duration
+	leader       Leader
+}
+
+func NewRelay(db database.Database, destinations []Destination, batchSize int, pollInterval time.Duration, maxAttempts int, claimLease time.Duration) *Relay {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if claimLease <= 0 {
+		claimLease = DefaultClaimLease
+	}
+	return &Relay{db: db, destinations: destinations, batchSize: batchSize, pollInterval: pollInterval,
+		maxAttempts: maxAttempts, claimLease: claimLease}
+}
+
+// SetLeader makes the relay publish only while leader holds leadership, so one of several API
+// instances relays at a time and the events of a user keep their order
+func (r *Relay) SetLeader(leader Leader) {
+	r.leader = leader
+}
+
+// Run relays events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		claimed := 0
+		if r.leader == nil || r.leader.IsLeader() {
+			var err error
+			claimed, err = r.RelayBatch(ctx)
+			if err != nil {
+				log.Println("Error relaying outbox events:", err)
+			}
+		}
+
+		// keep draining while full batches come back
+		if claimed == r.batchSize && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch claims one batch, publishes it and returns how many events were claimed. An event
+// that fails is retried on a later batch and the user's later events wait behind it, so a user's
+// events are never delivered out of order. Other users' events go on. An event that failed
+// maxAttempts times is marked dead and no longer holds its user's events up.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	events, err := r.db.ClaimOutboxEvents(ctx, r.batchSize, r.claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	// users with an event that failed in this batch, their later events stay claimed until the
+	// claim runs out and are retried after it
+	blocked := map[int]bool{}
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return len(events), nil
+		}
+		if blocked[event.Event.UserID] {
+			continue
+		}
+
+		if err := r.relay(ctx, event); err != nil {
+			dead, markErr := r.db.MarkOutboxEventFailed(ctx, event.ID, err.Error(), r.maxAttempts)
+			if markErr != nil {
+				log.Println("Error recording outbox failure:", markErr)
+			}
+			if dead {
+				log.Printf("Outbox event %d (%s) failed %d times and is marked dead: %v", event.ID, event.Event.ID, r.maxAttempts, err)
+				continue
+			}
+			log.Printf("Outbox event %d (%s) failed, retrying later: %v", event.ID, event.Event.ID, err)
+			blocked[event.Event.UserID] = true
+			continue
+		}
+		if err := r.db.MarkOutboxEventPublished(ctx, event.ID); err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+// relay publishes the event to every destination it has not reached yet
+func (r *Relay) relay(ctx context.Context, event models.OutboxEvent) error {
+	delivered := make(map[string]bool, len(event.DeliveredTo))
+	for _, name := range event.DeliveredTo {
+		delivered[name] = true
+	}
+
+	for _, destination := range r.destinations {
+		if delivered[destination.Name] {
+			continue
+		}
+		if err := destination.Publisher.Publish(ctx, event.Event); err != nil {
+			return err
+		}
+		if err := r.db.MarkOutboxEventDelivered(ctx, event.ID, destination.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
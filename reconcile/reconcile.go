@@ -0,0 +1,149 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+const correctionReason = "Balance corrected by reconciliation"
+
+type Mismatch struct {
+	UserID     int                  `json:"user_id"`
+	Expected   models.PointsBalance `json:"expected"`
+	Stored     models.PointsBalance `json:"stored"`
+	Difference int                  `json:"difference"`
+	Fixed      bool                 `json:"fixed"`
+	// Changed is set when the balance moved between the check and its correction, it was left as it
+	// is and the next run checks it again
+	Changed bool `json:"changed"`
+}
+
+type Report struct {
+	GeneratedOn  time.Time  `json:"generated_on"`
+	UsersChecked int        `json:"users_checked"`
+	Mismatches   []Mismatch `json:"mismatches"`
+}
+
+// Expected recomputes a balance from what was earned in transactions and spent per points history
+func Expected(s models.BalanceSources) models.PointsBalance {
+	return models.PointsBalance{
+		TotalPoints:    s.Earned - s.Redeemed - s.Expired - s.Forfeited - s.Refunded + s.Adjusted,
+		PointsRedeemed: s.Redeemed,
+	}
+}
+
+// Run compares every user's stored balance with the recomputed one, writing corrections when fix is set
+func Run(ctx context.Context, db database.Database, fix bool) (*Report, error) {
+	sources, err := db.GetBalanceSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{GeneratedOn: time.Now(), Mismatches: []Mismatch{}}
+	for _, s := range sources {
+		report.UsersChecked++
+
+		expected := Expected(s)
+		if expected == s.Stored {
+			continue
+		}
+
+		mismatch := Mismatch{
+			UserID:     s.UserID,
+			Expected:   expected,
+			Stored:     s.Stored,
+			Difference: expected.TotalPoints - s.Stored.TotalPoints,
+		}
+		if fix {
+			err := db.ApplyReconciliationCorrection(ctx, s.UserID, s.Stored, expected, correctionReason)
+			if errors.Is(err, database.ErrBalanceChanged) {
+				mismatch.Changed = true
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to correct user %d: %v", s.UserID, err)
+			} else {
+				mismatch.Fixed = true
+			}
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	return report, nil
+}
+
+func WriteJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func WriteCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	header := []string{"user_id", "expected_total_points", "stored_total_points", "difference",
+		"expected_points_redeemed", "stored_points_redeemed", "fixed", "changed"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, m := range report.Mismatches {
+		record := []string{
+			strconv.Itoa(m.UserID),
+			strconv.Itoa(m.Expected.TotalPoints),
+			strconv.Itoa(m.Stored.TotalPoints),
+			strconv.Itoa(m.Difference),
+			strconv.Itoa(m.Expected.PointsRedeemed),
+			strconv.Itoa(m.Stored.PointsRedeemed),
+			strconv.FormatBool(m.Fixed),
+			strconv.FormatBool(m.Changed),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Write encodes the report as csv or json
+func Write(w io.Writer, report *Report, format string) error {
+	switch format {
+	case "csv":
+		return WriteCSV(w, report)
+	case "json", "":
+		return WriteJSON(w, report)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// WriteReportFile stores the report in dir with a timestamped name and returns its path
+func WriteReportFile(dir string, report *Report, format string) (string, error) {
+	if format == "" {
+		format = "json"
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("could not create report directory: %v", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("reconciliation-%s.%s", report.GeneratedOn.Format("20060102150405"), format))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("could not create report file: %v", err)
+	}
+	defer file.Close()
+
+	if err := Write(file, report, format); err != nil {
+		return "", err
+	}
+	return path, file.Close()
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	auth "github.com/lakshay88/reward-management-system/authentation"
 	"github.com/lakshay88/reward-management-system/config"
 	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/expiry"
+	"github.com/lakshay88/reward-management-system/leader"
+	"github.com/lakshay88/reward-management-system/notify"
+	"github.com/lakshay88/reward-management-system/reconcile"
+	"github.com/lakshay88/reward-management-system/scheduler"
+	"github.com/lakshay88/reward-management-system/statement"
 )
 
 var (
-	db  database.Database
-	cfg *config.AppConfig
+	db       database.Database
+	cfg      *config.AppConfig
+	notifier notify.Notifier
+	policies expiry.Policies
 )
 
 func init() {
@@ -33,75 +49,231 @@ func init() {
 		if err != nil {
 			log.Fatalf("Failed to connect to database: %v", err)
 		}
+	case "sqlite":
+		db, err = database.ConnectionToSQLite(cfg.Database)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+	case "memory":
+		db = database.NewMemoryDB()
+	default:
+		log.Fatalf("Unknown database driver %q", cfg.Database.Driver)
+	}
+	db, err = database.WithReplicas(db, cfg.Database)
+	if err != nil {
+		log.Fatalf("Invalid database replicas: %v", err)
+	}
+	db, err = database.WithTimeouts(db, cfg.Database.Timeouts)
+	if err != nil {
+		log.Fatalf("Invalid database timeouts: %v", err)
+	}
+	if err := database.CheckSchema(context.Background(), db, cfg.Database.Migrations); err != nil {
+		log.Fatalf("Database schema check failed: %v", err)
+	}
+	db = db.WithAuditMeta(models.AuditMeta{Actor: "reward-expiration-scheduler"})
+
+	notifier, err = notify.New(cfg.NotificationConfig, db)
+	if err != nil {
+		log.Fatalf("Failed to set up notifications: %v", err)
+	}
+
+	policies, err = expiry.PoliciesFromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Invalid expiry policies: %v", err)
 	}
 	log.Println("fetching configurations- Completed")
 }
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print what the expiration job would expire and exit without writing anything")
+	asOf := flag.String("as-of", "", "date the dry run expires points as of, YYYY-MM-DD or RFC 3339, defaults to now")
+	flag.Parse()
 
 	defer db.Close()
 
-	timePeroid := time.Duration(cfg.SchedulerConfig.SchedulerRunnerTimeInMin) * time.Minute
-	ticker := time.NewTicker(timePeroid)
-	defer ticker.Stop()
+	if *dryRun {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := previewExpiration(ctx, *asOf); err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		return
+	}
 
-	// Channel to catch OS signals for graceful shutdown
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	sc := cfg.SchedulerConfig
+	jobs := scheduler.New(sc.HistorySize)
+	for _, job := range []scheduler.Job{
+		scheduler.JobFromConfig("expiry", sc.Jobs, sc.SchedulerRunnerTimeInMin, StartExpirationJob),
+		scheduler.JobFromConfig("expiry-warnings", sc.Jobs, sc.ExpiryWarningIntervalInMin, StartExpiryWarningJob),
+		scheduler.JobFromConfig("reconciliation", sc.Jobs, sc.ReconciliationIntervalInMin, StartReconciliationJob),
+		// the statement job is a no-op until a month without statements is over
+		scheduler.JobFromConfig("statements", sc.Jobs, sc.StatementIntervalInMin, StartStatementJob),
+		// tiers are set by admins, there is nothing to recalculate until a rule derives them
+	} {
+		if err := jobs.Register(job); err != nil {
+			log.Fatalf("Failed to register job: %v", err)
+		}
+		log.Printf("Registered job %s, schedule %q, enabled %t", job.Name, job.Schedule, job.Enabled)
+	}
 
-	done := make(chan bool)
-
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				// Trigger the expiration job
-				err := StartExpirationJob()
-				if err != nil {
-					fmt.Println("Error in expiration job:", err)
-				}
-			case <-done:
-				fmt.Println("Expiration job stopped.")
-				return
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the election outlives the jobs so the lock is only released once every run has returned
+	electionCtx, stopElection := context.WithCancel(context.Background())
+	var electionDone chan struct{}
+	if le := sc.LeaderElection; le.Enabled {
+		hostname, _ := os.Hostname()
+		id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		elector := leader.NewElector(id, db.NewLocker(le.LockName), time.Duration(le.RetryIntervalInSec)*time.Second)
+		elector.OnChange(func(isLeader bool) {
+			// a run left going after stepping down would overlap the new leader's
+			if !isLeader {
+				jobs.CancelRunning()
 			}
+		})
+		jobs.SetLeader(elector)
+		electionDone = make(chan struct{})
+		go func() {
+			defer close(electionDone)
+			elector.Run(electionCtx)
+		}()
+		log.Printf("Leader election enabled, instance %s campaigning for lock %q", id, le.LockName)
+	}
+	jobs.Start(ctx)
+
+	// Job status and controls for admins
+	var adminServer *http.Server
+	if sc.AdminPort > 0 {
+		router := chi.NewRouter()
+		router.Use(middleware.RequestID, auth.AuthMiddleware(db), auth.AdminMiddleware())
+		scheduler.NewAPI(ctx, jobs).RegisterRoutes(router)
+
+		adminServer = &http.Server{
+			Addr:         fmt.Sprintf("0.0.0.0:%d", sc.AdminPort),
+			Handler:      router,
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
 		}
-	}()
+		go func() {
+			log.Println("Scheduler admin API started on port", sc.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start scheduler admin API: %v", err)
+			}
+		}()
+	}
+
+	// Channel to catch OS signals for graceful shutdown
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Wait for shutdown signal
 	<-signalChan
 	fmt.Println("Shutdown signal received. Initiating graceful shutdown...")
 
-	// Stop ticker and finish ongoing job
-	ticker.Stop()
-	done <- true
+	if adminServer != nil {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Scheduler admin API shutdown failed: %v", err)
+		}
+		cancelShutdown()
+	}
+
+	// Stop scheduling and wait for running jobs to return
+	cancel()
+	jobs.Wait()
+	stopElection()
+	if electionDone != nil {
+		<-electionDone
+	}
 
 	fmt.Println("Graceful shutdown completed.")
 }
 
-func StartExpirationJob() error {
+func StartExpirationJob(ctx context.Context) error {
 	log.Println("Running expiration job...")
 
-	now := time.Now()
-	expirationTime := now.AddDate(-cfg.SchedulerConfig.ExpireTimeYear, cfg.SchedulerConfig.ExpireTimeMonth, cfg.SchedulerConfig.ExpireTimeDay)
+	report, err := expiry.Expire(ctx, db, policies, cfg.SchedulerConfig.ExpiryBatchSize)
+	if err != nil {
+		if report != nil && report.Batches > 0 {
+			log.Printf("Expiration job stopped after %d batches, %d transactions expired, the next run resumes from its checkpoint",
+				report.Batches, report.Transactions)
+		}
+		return err
+	}
+
+	log.Printf("Expiration job completed, cutoff %v, %d transactions and %d points expired in %d batches",
+		report.Cutoff.Format(time.RFC3339), report.Transactions, report.Points, report.Batches)
+	return nil
+}
 
-	// Fetch transactions older than the expiration time
-	transactions, err := db.TransactionOlderThanGivenTime(expirationTime)
+// previewExpiration prints the lots the expiration job would expire at asOf as JSON
+func previewExpiration(ctx context.Context, asOf string) error {
+	at, err := expiry.ParseAsOf(asOf)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Process each transaction to expire points
-	for _, txn := range transactions {
-		err := db.ExpirePoints(txn.UserID, txn.TransactionID, txn.PointsEarned, txn.TransactionDate)
-		if err != nil {
-			log.Printf("Error expiring points for user %d, transaction %s: %v", txn.UserID, txn.TransactionID, err)
-		}
+	preview, err := expiry.PreviewExpiry(ctx, db, policies, at)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(preview); err != nil {
+		return err
+	}
+	log.Printf("Dry run as of %v: %d points from %d transactions of %d users would expire",
+		preview.AsOf.Format(time.RFC3339), preview.Points, preview.Transactions, preview.Users)
+	return nil
+}
+
+func StartReconciliationJob(ctx context.Context) error {
+	log.Println("Running reconciliation job...")
+
+	report, err := reconcile.Run(ctx, db, cfg.SchedulerConfig.ReconciliationAutoFix)
+	if err != nil {
+		return err
+	}
+
+	path, err := reconcile.WriteReportFile(cfg.SchedulerConfig.ReconciliationReportDir, report, cfg.SchedulerConfig.ReconciliationReportFormat)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reconciliation job completed, %d users checked, %d mismatches, report - %s", report.UsersChecked, len(report.Mismatches), path)
+	return nil
+}
+
+func StartStatementJob(ctx context.Context) error {
+	month := statement.PreviousMonth(time.Now())
+
+	opts, err := statement.OptionsFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	report, written, err := statement.WriteMonthlyStatements(ctx, db, month, cfg.StatementConfig.Directory, cfg.StatementConfig.Format, opts)
+	if err != nil {
+		return err
+	}
+	if !written {
+		return nil
 	}
-	if len(transactions) > 0 {
-		log.Println("Expiration job completed total transaction updated - %s.", len(transactions))
-	} else {
 
-		log.Println("Expiration job completed, Not transaction updated.")
+	log.Printf("Statement job completed, %d statements for %s written to %s", report.Statements, report.Period, report.Directory)
+	return nil
+}
+
+func StartExpiryWarningJob(ctx context.Context) error {
+	log.Println("Running expiry warning job...")
+
+	report, err := expiry.Warn(ctx, db, notifier, policies, cfg.SchedulerConfig.ExpiryWarningDays)
+	if err != nil {
+		return err
 	}
+
+	log.Printf("Expiry warning job completed, %d new warnings, %d sent to %d users, %d failed to send",
+		report.Recorded, report.Notified, report.Users, report.FailedToSend)
 	return nil
 }
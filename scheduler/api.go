@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	utils "github.com/lakshay88/reward-management-system/Utils"
+)
+
+// API serves the scheduler's job status and controls over HTTP
+type API struct {
+	// ctx is the scheduler's context, manual runs must outlive the request that started them
+	ctx       context.Context
+	scheduler *Scheduler
+}
+
+func NewAPI(ctx context.Context, s *Scheduler) *API {
+	return &API{ctx: ctx, scheduler: s}
+}
+
+// RegisterRoutes mounts the job endpoints on router, authentication is left to the caller
+func (a *API) RegisterRoutes(router chi.Router) {
+	router.Get("/jobs", a.ListJobs)
+	router.Get("/jobs/{name}", a.GetJob)
+	router.Post("/jobs/{name}/trigger", a.TriggerJob)
+	router.Post("/jobs/{name}/pause", a.PauseJob)
+	router.Post("/jobs/{name}/resume", a.ResumeJob)
+	router.Post("/jobs/{name}/cancel", a.CancelJob)
+}
+
+func (a *API) ListJobs(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"leader": a.scheduler.IsLeader(),
+		"jobs":   a.scheduler.Jobs(),
+	})
+}
+
+// GetJob returns a job's status and its recorded runs, newest first
+func (a *API) GetJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	status, err := a.scheduler.Job(name)
+	if err != nil {
+		utils.RespondWithJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	history, err := a.scheduler.History(name)
+	if err != nil {
+		utils.RespondWithJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"job":     status,
+		"history": history,
+	})
+}
+
+func (a *API) TriggerJob(w http.ResponseWriter, r *http.Request) {
+	a.control(w, r, "Job triggered", func(name string) error {
+		return a.scheduler.Trigger(a.ctx, name)
+	})
+}
+
+// PauseJob stops scheduled runs of a job until it is resumed, a run in progress carries on
+func (a *API) PauseJob(w http.ResponseWriter, r *http.Request) {
+	a.control(w, r, "Job paused", func(name string) error {
+		return a.scheduler.SetEnabled(name, false)
+	})
+}
+
+func (a *API) ResumeJob(w http.ResponseWriter, r *http.Request) {
+	a.control(w, r, "Job resumed", func(name string) error {
+		return a.scheduler.SetEnabled(name, true)
+	})
+}
+
+func (a *API) CancelJob(w http.ResponseWriter, r *http.Request) {
+	a.control(w, r, "Job cancelled", a.scheduler.Cancel)
+}
+
+// control applies action to the job named in the path and responds with its new status
+func (a *API) control(w http.ResponseWriter, r *http.Request, message string, action func(name string) error) {
+	name := chi.URLParam(r, "name")
+	if _, err := a.scheduler.Job(name); err != nil {
+		utils.RespondWithJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := action(name); err != nil {
+		utils.RespondWithJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+
+	status, _ := a.scheduler.Job(name)
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message": message,
+		"job":     status,
+	})
+}
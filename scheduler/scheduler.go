@@ -0,0 +1,402 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunTimedOut  = "timed_out"
+	RunSkipped   = "skipped"
+	RunCancelled = "cancelled"
+
+	DefaultHistorySize = 20
+)
+
+// specParser accepts standard five field expressions and descriptors such as @hourly or @every 5m
+var specParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// JobFunc does one run of a job, it should return soon after ctx is done
+type JobFunc func(ctx context.Context) error
+
+// Job is a named unit of work run on a cron schedule
+type Job struct {
+	Name     string
+	Schedule string
+	// Timeout cancels the run's context, 0 means no timeout
+	Timeout time.Duration
+	Enabled bool
+	Run     JobFunc
+}
+
+// Run is one execution of a job
+type Run struct {
+	Job        string     `json:"job"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedOn  time.Time  `json:"started_on"`
+	FinishedOn *time.Time `json:"finished_on,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+}
+
+// JobStatus describes a registered job and its latest run
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	TimeoutInSec int64      `json:"timeout_in_sec"`
+	Enabled      bool       `json:"enabled"`
+	Running      bool       `json:"running"`
+	NextRunOn    *time.Time `json:"next_run_on,omitempty"`
+	LastRun      *Run       `json:"last_run,omitempty"`
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	running  bool
+	cancel   context.CancelFunc
+	// cancelled marks the running run as stopped on purpose rather than failed
+	cancelled bool
+	next      time.Time
+	history   []Run
+}
+
+// Leader reports whether this instance may run jobs, see the leader package
+type Leader interface {
+	IsLeader() bool
+}
+
+// Scheduler runs registered jobs on their schedules. A job never overlaps itself: a run that is
+// due while the previous one is still going is recorded as skipped.
+type Scheduler struct {
+	mu          sync.Mutex
+	entries     map[string]*entry
+	historySize int
+	leader      Leader
+	wg          sync.WaitGroup
+}
+
+func New(historySize int) *Scheduler {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Scheduler{entries: map[string]*entry{}, historySize: historySize}
+}
+
+// SetLeader makes the scheduler run jobs only while leader holds leadership, so several instances
+// can share a database without running the same job twice. Without one every instance runs jobs.
+func (s *Scheduler) SetLeader(leader Leader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leader = leader
+}
+
+// IsLeader reports whether this instance currently runs jobs
+func (s *Scheduler) IsLeader() bool {
+	s.mu.Lock()
+	leader := s.leader
+	s.mu.Unlock()
+	return leader == nil || leader.IsLeader()
+}
+
+// Register adds a job, its schedule is validated here so a bad expression fails at startup
+func (s *Scheduler) Register(job Job) error {
+	schedule, err := specParser.Parse(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q for job %s: %v", job.Schedule, job.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.entries[job.Name] = &entry{job: job, schedule: schedule}
+	return nil
+}
+
+// Start runs every job on its schedule until ctx is done, Wait blocks until in-flight runs finish
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.entries {
+		s.wg.Add(1)
+		go s.loop(ctx, name)
+	}
+}
+
+// Wait blocks until the schedule loops and every run they started have returned
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, name string) {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		e := s.entries[name]
+		e.next = e.schedule.Next(time.Now())
+		wait := time.Until(e.next)
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		enabled := e.job.Enabled
+		s.mu.Unlock()
+		// followers keep their schedule so they are ready to take over, they just don't run
+		if enabled && s.IsLeader() {
+			s.start(ctx, name, "schedule")
+		}
+	}
+}
+
+// Trigger starts a run of the job right away, whether or not it is enabled
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	s.mu.Lock()
+	_, exists := s.entries[name]
+	s.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("job %s not found", name)
+	}
+	if !s.IsLeader() {
+		return fmt.Errorf("this instance is not the leader, trigger job %s on the leader", name)
+	}
+
+	if !s.start(ctx, name, "manual") {
+		return fmt.Errorf("job %s is already running", name)
+	}
+	return nil
+}
+
+// start launches a run in the background, it returns false when the job was still running
+func (s *Scheduler) start(ctx context.Context, name, trigger string) bool {
+	s.mu.Lock()
+	e := s.entries[name]
+	run := Run{Job: name, Trigger: trigger, StartedOn: time.Now()}
+	if e.running {
+		finished := run.StartedOn
+		run.Status, run.FinishedOn = RunSkipped, &finished
+		run.Error = "previous run still in progress"
+		s.record(e, run)
+		s.mu.Unlock()
+		log.Printf("Job %s skipped, previous run still in progress", name)
+		return false
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	e.running, e.cancel = true, cancel
+	job := e.job
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		s.execute(runCtx, e, job, run)
+	}()
+	return true
+}
+
+func (s *Scheduler) execute(ctx context.Context, e *entry, job Job, run Run) {
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if job.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+	}
+	defer cancel()
+
+	log.Printf("Job %s started (%s)", job.Name, run.Trigger)
+	err := safeRun(runCtx, job.Run)
+
+	finished := time.Now()
+	run.FinishedOn = &finished
+	run.DurationMs = finished.Sub(run.StartedOn).Milliseconds()
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		run.Status = RunTimedOut
+		run.Error = fmt.Sprintf("timed out after %v", job.Timeout)
+		if err != nil {
+			run.Error += ": " + err.Error()
+		}
+	case s.wasCancelled(e):
+		run.Status = RunCancelled
+		if err != nil {
+			run.Error = err.Error()
+		}
+	case err != nil:
+		run.Status = RunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = RunSucceeded
+	}
+	log.Printf("Job %s %s in %dms %s", job.Name, run.Status, run.DurationMs, run.Error)
+
+	s.mu.Lock()
+	e.running, e.cancel, e.cancelled = false, nil, false
+	s.record(e, run)
+	s.mu.Unlock()
+}
+
+// CancelRunning cancels the context of every run in progress, for example when this instance
+// loses leadership and another one is about to start the same jobs
+func (s *Scheduler) CancelRunning() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, e := range s.entries {
+		if e.cancel != nil {
+			log.Printf("Cancelling running job %s", name)
+			e.cancelled = true
+			e.cancel()
+		}
+	}
+}
+
+// Cancel stops the run of a job that is in progress, the job decides how soon it returns
+func (s *Scheduler) Cancel(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[name]
+	if !exists {
+		return fmt.Errorf("job %s not found", name)
+	}
+	if e.cancel == nil {
+		return fmt.Errorf("job %s is not running", name)
+	}
+
+	log.Printf("Cancelling running job %s", name)
+	e.cancelled = true
+	e.cancel()
+	return nil
+}
+
+func (s *Scheduler) wasCancelled(e *entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return e.cancelled
+}
+
+// safeRun turns a panic in a job into an error so one bad run does not stop the scheduler
+func safeRun(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// record keeps the newest runs of a job, s.mu must be held
+func (s *Scheduler) record(e *entry, run Run) {
+	e.history = append(e.history, run)
+	if len(e.history) > s.historySize {
+		e.history = e.history[len(e.history)-s.historySize:]
+	}
+}
+
+// SetEnabled switches scheduled runs of a job on or off, manual triggers still work
+func (s *Scheduler) SetEnabled(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[name]
+	if !exists {
+		return fmt.Errorf("job %s not found", name)
+	}
+	e.job.Enabled = enabled
+	return nil
+}
+
+// History returns the recorded runs of a job, newest first
+func (s *Scheduler) History(name string) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[name]
+	if !exists {
+		return nil, fmt.Errorf("job %s not found", name)
+	}
+
+	runs := make([]Run, len(e.history))
+	for i, run := range e.history {
+		runs[len(runs)-1-i] = run
+	}
+	return runs, nil
+}
+
+// Jobs lists every registered job by name
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.entries))
+	for name, e := range s.entries {
+		statuses = append(statuses, status(name, e))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Job returns the status of one job
+func (s *Scheduler) Job(name string) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, exists := s.entries[name]
+	if !exists {
+		return JobStatus{}, fmt.Errorf("job %s not found", name)
+	}
+	return status(name, e), nil
+}
+
+// status describes an entry, s.mu must be held
+func status(name string, e *entry) JobStatus {
+	status := JobStatus{
+		Name:         name,
+		Schedule:     e.job.Schedule,
+		TimeoutInSec: int64(e.job.Timeout / time.Second),
+		Enabled:      e.job.Enabled,
+		Running:      e.running,
+	}
+	if !e.next.IsZero() {
+		next := e.next
+		status.NextRunOn = &next
+	}
+	if len(e.history) > 0 {
+		last := e.history[len(e.history)-1]
+		status.LastRun = &last
+	}
+	return status
+}
+
+// JobFromConfig builds a job from its entry in schedulerConfig.jobs. A job without an entry runs
+// every intervalInMin minutes, the interval settings from before cron schedules, and is disabled
+// when that is 0.
+func JobFromConfig(name string, jobs map[string]config.JobConfig, intervalInMin int, run JobFunc) Job {
+	job := Job{Name: name, Run: run}
+	if jobCfg, exists := jobs[name]; exists {
+		job.Schedule = jobCfg.Schedule
+		job.Timeout = time.Duration(jobCfg.TimeoutInSec) * time.Second
+		job.Enabled = jobCfg.Enabled
+		return job
+	}
+
+	job.Schedule = fmt.Sprintf("@every %dm", intervalInMin)
+	job.Enabled = intervalInMin > 0
+	if !job.Enabled {
+		job.Schedule = "@daily"
+	}
+	return job
+}
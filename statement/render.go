@@ -0,0 +1,88 @@
+package statement
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+const (
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+var htmlTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("02 Jan 2006") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Points statement {{.Period}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border-bottom: 1px solid #ddd; padding: 6px; text-align: left; }
+td.num, th.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Points statement</h1>
+<p>User {{.UserID}}, {{date .PeriodStart}} to {{.PeriodEnd.AddDate 0 0 -1 | date}}</p>
+
+<table>
+<tr><th>Opening balance</th><td class="num">{{.OpeningBalance}}</td></tr>
+<tr><th>Earned</th><td class="num">{{.Totals.Earned}}</td></tr>
+<tr><th>Redeemed</th><td class="num">-{{.Totals.Redeemed}}</td></tr>
+<tr><th>Expired</th><td class="num">-{{.Totals.Expired}}</td></tr>
+<tr><th>Refunded</th><td class="num">-{{.Totals.Refunded}}</td></tr>
+<tr><th>Adjusted</th><td class="num">{{.Totals.Adjusted}}</td></tr>
+<tr><th>Closing balance</th><td class="num">{{.ClosingBalance}}</td></tr>
+</table>
+
+<h2>Activity</h2>
+{{if .Lines}}
+<table>
+<tr><th>Date</th><th>Type</th><th>Reason</th><th>Transaction</th><th class="num">Points</th><th class="num">Balance</th></tr>
+{{range .Lines}}<tr><td>{{date .Date}}</td><td>{{.Type}}</td><td>{{.Reason}}</td><td>{{.TransactionID}}</td><td class="num">{{.Points}}</td><td class="num">{{.Balance}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No activity in this period.</p>
+{{end}}
+
+<h2>Points expiring soon</h2>
+{{if .ExpiringSoon}}
+<table>
+<tr><th>Transaction</th><th>Expires on</th><th class="num">Points</th></tr>
+{{range .ExpiringSoon}}<tr><td>{{.TransactionID}}</td><td>{{date .ExpiresOn}}</td><td class="num">{{.Points}}</td></tr>
+{{end}}<tr><th colspan="2">Total</th><td class="num">{{.ExpiringTotal}}</td></tr>
+</table>
+{{else}}
+<p>No points expiring soon.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// Extension returns the file extension of a statement format
+func Extension(format string) string {
+	if format == FormatHTML {
+		return FormatHTML
+	}
+	return FormatJSON
+}
+
+// Write renders the statement as json or html
+func Write(w io.Writer, statement *Statement, format string) error {
+	switch format {
+	case FormatJSON, "":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statement)
+	case FormatHTML:
+		return htmlTemplate.Execute(w, statement)
+	default:
+		return fmt.Errorf("unknown statement format %q, use json or html", format)
+	}
+}
@@ -0,0 +1,239 @@
+package statement
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+	"github.com/lakshay88/reward-management-system/expiry"
+	"github.com/lakshay88/reward-management-system/ledger"
+)
+
+const monthLayout = "2006-01"
+
+// DefaultExpiringWithinDays is used when statementConfig.expiringWithinDays is not set
+const DefaultExpiringWithinDays = 30
+
+// Line is a single ledger entry of the period, Points carries the sign of its effect on the balance
+type Line struct {
+	Date          time.Time `json:"date"`
+	Type          string    `json:"type"`
+	Points        int       `json:"points"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Reason        string    `json:"reason"`
+	Balance       int       `json:"balance"`
+}
+
+type ExpiringPoints struct {
+	TransactionID string    `json:"transaction_id"`
+	Points        int       `json:"points"`
+	ExpiresOn     time.Time `json:"expires_on"`
+}
+
+type Totals struct {
+	Earned   int `json:"earned"`
+	Redeemed int `json:"redeemed"`
+	Expired  int `json:"expired"`
+	Adjusted int `json:"adjusted"`
+	Refunded int `json:"refunded"`
+}
+
+type Statement struct {
+	UserID         int              `json:"user_id"`
+	Period         string           `json:"period"`
+	PeriodStart    time.Time        `json:"period_start"`
+	PeriodEnd      time.Time        `json:"period_end"`
+	OpeningBalance int              `json:"opening_balance"`
+	ClosingBalance int              `json:"closing_balance"`
+	Totals         Totals           `json:"totals"`
+	Lines          []Line           `json:"lines"`
+	ExpiringSoon   []ExpiringPoints `json:"expiring_soon"`
+	ExpiringTotal  int              `json:"expiring_total"`
+	GeneratedOn    time.Time        `json:"generated_on"`
+}
+
+// Options tells the generator when points expire, it must match the expiration scheduler
+type Options struct {
+	// Policies date the points expiring soon, none are listed without them
+	Policies       *expiry.Policies
+	ExpiringWithin time.Duration
+}
+
+// OptionsFromConfig builds the options from the program's expiry policies
+func OptionsFromConfig(cfg *config.AppConfig) (Options, error) {
+	days := cfg.StatementConfig.ExpiringWithinDays
+	if days <= 0 {
+		days = DefaultExpiringWithinDays
+	}
+	policies, err := expiry.PoliciesFromConfig(cfg)
+	if err != nil {
+		return Options{}, err
+	}
+	return Options{
+		Policies:       &policies,
+		ExpiringWithin: time.Duration(days) * 24 * time.Hour,
+	}, nil
+}
+
+// Month returns the calendar month "2006-01" as a half open [start, end) range in loc
+func Month(month string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(monthLayout, month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q, use YYYY-MM", month)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// PreviousMonth returns the month before the one containing t, as "2006-01"
+func PreviousMonth(t time.Time) string {
+	firstOfMonth := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return firstOfMonth.AddDate(0, -1, 0).Format(monthLayout)
+}
+
+// Generate builds the statement of a user for a calendar month from the points ledger
+func Generate(ctx context.Context, db database.Database, userID int, month string, opts Options) (*Statement, error) {
+	start, end, err := Month(month, time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := db.GetPointsEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Statement{
+		UserID:       userID,
+		Period:       month,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		Lines:        []Line{},
+		ExpiringSoon: []ExpiringPoints{},
+		GeneratedOn:  time.Now(),
+	}
+
+	var balance models.PointsBalance
+	for _, event := range events {
+		if !event.CreatedOn.Before(end) {
+			break
+		}
+
+		before := balance.TotalPoints
+		balance = ledger.Apply(balance, event)
+		if event.CreatedOn.Before(start) {
+			continue
+		}
+
+		line := Line{
+			Date:          event.CreatedOn,
+			Type:          event.EventType,
+			Points:        balance.TotalPoints - before,
+			TransactionID: event.TransactionID,
+			Reason:        event.Reason,
+			Balance:       balance.TotalPoints,
+		}
+		statement.Lines = append(statement.Lines, line)
+		statement.Totals.add(line)
+	}
+	statement.ClosingBalance = balance.TotalPoints
+	statement.OpeningBalance = statement.ClosingBalance - statement.Totals.net()
+
+	if opts.Policies != nil {
+		expiring, err := expiry.ExpiringBetween(ctx, db, *opts.Policies, userID, end, end.Add(opts.ExpiringWithin))
+		if err != nil {
+			return nil, err
+		}
+		for _, lot := range expiring {
+			statement.ExpiringSoon = append(statement.ExpiringSoon, ExpiringPoints{
+				TransactionID: lot.TransactionID,
+				Points:        lot.Points,
+				ExpiresOn:     lot.ExpiresOn,
+			})
+			statement.ExpiringTotal += lot.Points
+		}
+	}
+	return statement, nil
+}
+
+func (t *Totals) add(line Line) {
+	switch line.Type {
+	case models.PointsEventEarned:
+		t.Earned += line.Points
+	case models.PointsEventRedeemed:
+		t.Redeemed -= line.Points
+	case models.PointsEventExpired:
+		t.Expired -= line.Points
+	case models.PointsEventRefunded:
+		t.Refunded -= line.Points
+	case models.PointsEventAdjusted:
+		t.Adjusted += line.Points
+	}
+}
+
+func (t Totals) net() int {
+	return t.Earned - t.Redeemed - t.Expired - t.Refunded + t.Adjusted
+}
+
+type BulkReport struct {
+	Period     string `json:"period"`
+	Directory  string `json:"directory"`
+	Statements int    `json:"statements"`
+}
+
+// WriteMonthlyStatements writes a statement file for every user with ledger activity into
+// dir/<month>. The directory only appears once every statement was written, so an existing
+// directory means the month is done and a later run skips it.
+func WriteMonthlyStatements(ctx context.Context, db database.Database, month, dir, format string, opts Options) (*BulkReport, bool, error) {
+	target := filepath.Join(dir, month)
+	if _, err := os.Stat(target); err == nil {
+		return nil, false, nil
+	}
+
+	userIDs, err := db.ListLedgerUserIDs(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	staging := target + ".partial"
+	if err := os.RemoveAll(staging); err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(staging, 0o750); err != nil {
+		return nil, false, fmt.Errorf("could not create statement directory: %v", err)
+	}
+
+	for _, userID := range userIDs {
+		statement, err := Generate(ctx, db, userID, month, opts)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to generate statement of user %d: %v", userID, err)
+		}
+
+		path := filepath.Join(staging, fmt.Sprintf("statement-%d.%s", userID, Extension(format)))
+		if err := writeFile(path, statement, format); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := os.Rename(staging, target); err != nil {
+		return nil, false, fmt.Errorf("could not publish statements: %v", err)
+	}
+	return &BulkReport{Period: month, Directory: target, Statements: len(userIDs)}, true, nil
+}
+
+func writeFile(path string, statement *Statement, format string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create statement file: %v", err)
+	}
+	defer file.Close()
+
+	if err := Write(file, statement, format); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"context"
+
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Dispatcher is an outbox publisher that fans domain events out into webhook deliveries
+type Dispatcher struct {
+	db database.Database
+}
+
+func NewDispatcher(db database.Database) *Dispatcher {
+	return &Dispatcher{db: db}
+}
+
+// Publish queues a delivery for every active subscription of the event's merchant interested in
+// it. An event without a merchant, such as a redemption or a manual adjustment, concerns no
+// merchant and is not delivered to any.
+func (d *Dispatcher) Publish(ctx context.Context, event models.DomainEvent) error {
+	if event.Merchant == "" {
+		return nil
+	}
+	subscriptions, err := d.db.GetWebhookSubscriptions(ctx, event.Merchant, true)
+	if err != nil {
+		return err
+	}
+
+	var subscriptionIDs []int
+	for _, subscription := range subscriptions {
+		if Matches(subscription, event.Type) {
+			subscriptionIDs = append(subscriptionIDs, subscription.ID)
+		}
+	}
+	return d.db.CreateWebhookDeliveries(ctx, event, subscriptionIDs)
+}
+
+// Matches reports whether a subscription's event type filter accepts eventType
+func Matches(subscription models.WebhookSubscription, eventType string) bool {
+	if len(subscription.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range subscription.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
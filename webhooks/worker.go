@@ -0,0 +1,167 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lakshay88/reward-management-system/config"
+	"github.com/lakshay88/reward-management-system/database"
+	"github.com/lakshay88/reward-management-system/database/models"
+)
+
+// Worker sends due webhook deliveries, retrying failures with exponential backoff
+type Worker struct {
+	db     database.Database
+	client *http.Client
+	cfg    config.WebhookConfig
+}
+
+func NewWorker(db database.Database, cfg config.WebhookConfig) *Worker {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.BaseBackoffInSec <= 0 {
+		cfg.BaseBackoffInSec = 30
+	}
+	if cfg.MaxBackoffInSec <= 0 {
+		cfg.MaxBackoffInSec = 3600
+	}
+	if cfg.TimeoutInSec <= 0 {
+		cfg.TimeoutInSec = 10
+	}
+	if cfg.PollIntervalInSec <= 0 {
+		cfg.PollIntervalInSec = 5
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+
+	return &Worker{
+		db:     db,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutInSec) * time.Second},
+		cfg:    cfg,
+	}
+}
+
+// Run delivers webhooks until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(w.cfg.PollIntervalInSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := w.DeliverDue(ctx); err != nil {
+			log.Println("Error delivering webhooks:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes one attempt for each delivery whose retry time has come. The batch is claimed
+// for as long as sending all of it may take, so workers in other instances skip it.
+func (w *Worker) DeliverDue(ctx context.Context) error {
+	lease := time.Duration(w.cfg.BatchSize*w.cfg.TimeoutInSec)*time.Second + time.Minute
+	deliveries, err := w.db.ClaimDueWebhookDeliveries(ctx, w.cfg.BatchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	subscriptions := map[int]*models.WebhookSubscription{}
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		delivery := &deliveries[i]
+		subscription, cached := subscriptions[delivery.SubscriptionID]
+		if !cached {
+			subscription, err = w.db.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+			if err != nil {
+				return err
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+
+		if err := w.attempt(ctx, subscription, delivery); err != nil {
+			log.Printf("Error recording webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) attempt(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) error {
+	started := time.Now()
+	delivery.Attempts++
+	attempt := models.WebhookDeliveryAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts, AttemptedOn: started}
+
+	if !subscription.Active {
+		attempt.Error = "subscription is inactive"
+	} else {
+		attempt.ResponseStatus, attempt.Error = w.send(ctx, subscription, delivery)
+	}
+	attempt.DurationMs = time.Since(started).Milliseconds()
+
+	delivery.ResponseStatus = attempt.ResponseStatus
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.NextAttemptOn = nil
+	case delivery.Attempts >= w.cfg.MaxAttempts || !subscription.Active:
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.NextAttemptOn = nil
+	default:
+		next := time.Now().Add(w.Backoff(delivery.Attempts))
+		delivery.NextAttemptOn = &next
+	}
+
+	return w.db.RecordWebhookAttempt(ctx, delivery, attempt)
+}
+
+// send posts the signed payload and returns the response status and an error message for failures
+func (w *Worker) send(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, string) {
+	timestamp := time.Now().Unix()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, delivery.EventID)
+	request.Header.Set(TimestampHeader, fmt.Sprint(timestamp))
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Sprintf("unexpected response status %d", response.StatusCode)
+	}
+	return response.StatusCode, ""
+}
+
+// Backoff is the wait before the next attempt, doubling from the base up to the configured maximum
+func (w *Worker) Backoff(attempts int) time.Duration {
+	backoff := time.Duration(w.cfg.BaseBackoffInSec) * time.Second
+	maxBackoff := time.Duration(w.cfg.MaxBackoffInSec) * time.Second
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}